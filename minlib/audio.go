@@ -0,0 +1,409 @@
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ID3v2: http://id3.org/id3v2.4.0-structure
+// Header: "ID3", major version, revision, flags, size (4 syncsafe bytes).
+// Frames: [id:4][size:4, syncsafe in v2.4][flags:2][data], v2.2 frames
+// have a 3 byte id and size and no flags. Text frames start with the
+// encoding of the text.
+// FLAC: https://xiph.org/flac/format.html
+// "fLaC", then metadata blocks: [last flag and type:1][size:3][data].
+// The VORBIS_COMMENT block (type 4) and the Ogg comment header hold the
+// Vorbis comments: [vendor length:4, little endian][vendor][count:4] and
+// count [length:4][FIELD=value].
+// Ogg: https://xiph.org/ogg/doc/framing.html
+// BWF: EBU Tech 3285, the bext chunk of a WAV file holds the
+// OriginationDate ("yyyy-mm-dd") and OriginationTime ("hh-mm-ss") at 320.
+
+// maxOggPages limits the pages read to find the comment header.
+const maxOggPages = 1 << 10
+
+// maxAudioTagSize limits the size of ID3 tags and Vorbis comments read into
+// memory, which may embed cover art.
+const maxAudioTagSize = 16 << 20
+
+// audioTimeLayouts are the formats of the ID3 and Vorbis dates after
+// parseISOTime.
+var audioTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02",
+}
+
+// parseAudioTime parses an ID3 or Vorbis comment date. Dates without a day,
+// such as the release year of music, are rejected.
+func parseAudioTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := parseISOTime(s); err == nil {
+		return t, nil
+	}
+	for _, layout := range audioTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return zeroTime, &ErrNoOriginalTime{"invalid date " + s}
+}
+
+// id3TimeCandidates returns the recording time of an ID3v2 tag: TDRC in
+// v2.4, TYER with TDAT (DDMM) and TIME (HHMM) in v2.3, TYE, TDA and TIM in
+// v2.2.
+func id3TimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	frames, err := readID3Frames(r)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []TimeCandidate
+	if s, ok := frames["TDRC"]; ok {
+		if t, err := parseAudioTime(s); err == nil {
+			candidates = append(candidates, TimeCandidate{t, SourceID3, "TDRC"})
+		}
+	}
+	for _, ids := range [][3]string{{"TYER", "TDAT", "TIME"}, {"TYE", "TDA", "TIM"}} {
+		year, date := frames[ids[0]], frames[ids[1]]
+		if len(year) != 4 || len(date) != 4 {
+			continue
+		}
+		s, layout := year+date, "20060201"
+		if clock := frames[ids[2]]; len(clock) == 4 {
+			s, layout = s+clock, layout+"1504"
+		}
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			candidates = append(candidates, TimeCandidate{t, SourceID3, ids[1]})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, &ErrNoOriginalTime{"no recording date in ID3 tag"}
+	}
+	return candidates, nil
+}
+
+// readID3Frames returns the text frames of the ID3v2 tag at the start of
+// r.
+func readID3Frames(r io.ReadSeeker) (map[string]string, error) {
+	hdr, err := readAt(r, 0, 10)
+	if err != nil {
+		return nil, err
+	}
+	if string(hdr[0:3]) != "ID3" {
+		return nil, formatError("id3", 0, "no ID3v2 tag")
+	}
+	version, flags := hdr[3], hdr[5]
+	size := syncsafe(hdr[6:10])
+	if size > maxAudioTagSize {
+		return nil, limitError("id3", 0, "tag size")
+	}
+	data, err := readAt(r, 10, int(size))
+	if err != nil {
+		return nil, err
+	}
+	if flags&0x80 != 0 && version < 4 {
+		// unsynchronisation of the whole tag
+		data = bytes.ReplaceAll(data, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && version >= 3 {
+		// extended header, its size includes itself in v2.4
+		if len(data) < 4 {
+			return nil, truncatedError("id3", 10)
+		}
+		n := int(binary.BigEndian.Uint32(data))
+		if version == 3 {
+			n += 4
+		} else {
+			n = int(syncsafe(data[0:4]))
+		}
+		if n < 0 || n > len(data) {
+			return nil, formatError("id3", 10, "invalid extended header")
+		}
+		data = data[n:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	frames := make(map[string]string)
+	for len(data) >= headerLen && data[0] != 0 {
+		id := string(data[:idLen])
+		var n int
+		switch version {
+		case 2:
+			n = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			n = int(binary.BigEndian.Uint32(data[4:8]))
+		default:
+			n = int(syncsafe(data[4:8]))
+		}
+		if n < 0 || n > len(data)-headerLen {
+			break
+		}
+		frame := data[headerLen : headerLen+n]
+		if version >= 4 && data[9]&0x01 != 0 && len(frame) >= 4 {
+			// data length indicator
+			frame = frame[4:]
+		}
+		if version >= 4 && data[9]&0x02 != 0 {
+			frame = bytes.ReplaceAll(frame, []byte{0xFF, 0x00}, []byte{0xFF})
+		}
+		if id[0] == 'T' && len(frame) > 0 {
+			if _, ok := frames[id]; !ok {
+				frames[id] = id3Text(frame)
+			}
+		}
+		data = data[headerLen+n:]
+	}
+	return frames, nil
+}
+
+// syncsafe decodes a 28 bit integer stored in the low 7 bits of 4 bytes.
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// id3Text decodes the first string of a text frame.
+func id3Text(frame []byte) string {
+	enc, b := frame[0], frame[1:]
+	var s string
+	switch enc {
+	case 1, 2:
+		// UTF-16 with a byte order mark, UTF-16BE
+		var order binary.ByteOrder = binary.BigEndian
+		if len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE {
+			order, b = binary.LittleEndian, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+			b = b[2:]
+		}
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u = append(u, order.Uint16(b[i:]))
+		}
+		s = string(utf16.Decode(u))
+	case 0:
+		// ISO-8859-1
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		s = string(r)
+	default:
+		s = string(b)
+	}
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// parseVorbisComments returns the fields of a Vorbis comment block, keyed
+// by their upper case name.
+func parseVorbisComments(data []byte) (map[string]string, error) {
+	le := binary.LittleEndian
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := le.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return nil, false
+		}
+		field := data[4 : 4+n]
+		data = data[4+n:]
+		return field, true
+	}
+	if _, ok := next(); !ok {
+		return nil, truncatedError("vorbis", -1)
+	}
+	if len(data) < 4 {
+		return nil, truncatedError("vorbis", -1)
+	}
+	count := le.Uint32(data)
+	data = data[4:]
+	fields := make(map[string]string)
+	for i := uint32(0); i < count; i++ {
+		field, ok := next()
+		if !ok {
+			return nil, truncatedError("vorbis", -1)
+		}
+		if k := bytes.IndexByte(field, '='); k > 0 {
+			name := strings.ToUpper(string(field[:k]))
+			if _, ok := fields[name]; !ok {
+				fields[name] = string(field[k+1:])
+			}
+		}
+	}
+	return fields, nil
+}
+
+func vorbisTimeCandidates(comments []byte) ([]TimeCandidate, error) {
+	fields, err := parseVorbisComments(comments)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := fields["DATE"]; ok {
+		if t, err := parseAudioTime(s); err == nil {
+			return []TimeCandidate{{t, SourceVorbis, "DATE"}}, nil
+		}
+	}
+	return nil, &ErrNoOriginalTime{"no DATE Vorbis comment"}
+}
+
+// flacTimeCandidates returns the DATE Vorbis comment of a FLAC file. An ID3
+// tag in front of the stream is skipped.
+func flacTimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	offset := int64(0)
+	if hdr, err := readAt(r, 0, 10); err == nil && string(hdr[0:3]) == "ID3" {
+		offset = 10 + int64(syncsafe(hdr[6:10]))
+	}
+	magic, err := readAt(r, offset, 4)
+	if err != nil {
+		return nil, err
+	}
+	if string(magic) != "fLaC" {
+		return nil, formatError("flac", offset, "no fLaC marker")
+	}
+	for offset += 4; ; {
+		hdr, err := readAt(r, offset, 4)
+		if err != nil {
+			return nil, err
+		}
+		size := int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+		if hdr[0]&0x7f == 4 {
+			data, err := readAt(r, offset+4, int(size))
+			if err != nil {
+				return nil, err
+			}
+			return vorbisTimeCandidates(data)
+		}
+		if hdr[0]&0x80 != 0 {
+			return nil, &ErrNoOriginalTime{"no VORBIS_COMMENT block"}
+		}
+		offset += 4 + size
+	}
+}
+
+// oggTimeCandidates returns the DATE of the comment header of an Ogg Vorbis
+// or Opus stream, the second packet of the first logical stream.
+func oggTimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	var packets [][]byte
+	var packet []byte
+	var serial uint32
+	for offset, page := int64(0), 0; len(packets) < 2; page++ {
+		if page >= maxOggPages {
+			return nil, limitError("ogg", offset, "too many pages")
+		}
+		// capture pattern, version, header type, granule position (8),
+		// serial number, sequence number, CRC, segment count
+		hdr, err := readAt(r, offset, 27)
+		if err != nil {
+			return nil, err
+		}
+		if string(hdr[0:4]) != "OggS" {
+			return nil, formatError("ogg", offset, "lost capture pattern")
+		}
+		segments, err := readAt(r, offset+27, int(hdr[26]))
+		if err != nil {
+			return nil, err
+		}
+		offset += 27 + int64(len(segments))
+		if page == 0 {
+			serial = binary.LittleEndian.Uint32(hdr[14:18])
+		}
+		own := binary.LittleEndian.Uint32(hdr[14:18]) == serial
+		for _, n := range segments {
+			if own {
+				data, err := readAt(r, offset, int(n))
+				if err != nil {
+					return nil, err
+				}
+				if packet = append(packet, data...); len(packet) > maxAudioTagSize {
+					return nil, limitError("ogg", offset, "packet size")
+				}
+				if n < 255 {
+					packets, packet = append(packets, packet), nil
+				}
+			}
+			offset += int64(n)
+		}
+	}
+
+	comments := packets[1]
+	switch {
+	case bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		comments = comments[7:]
+	case bytes.HasPrefix(comments, []byte("OpusTags")):
+		comments = comments[8:]
+	default:
+		return nil, formatError("ogg", -1, "no Vorbis or Opus comment header")
+	}
+	return vorbisTimeCandidates(comments)
+}
+
+// wavTimeCandidates returns the BWF origination date and the INFO creation
+// date of a WAV file.
+func wavTimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	riff, err := readRIFFChunkHeader(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if riff.id != "RIFF" || riff.list != "WAVE" {
+		return nil, formatError("riff", 0, "not a WAV file")
+	}
+
+	var candidates []TimeCandidate
+	var icrd string
+	err = walkRIFFChunks(r, riff.childOffset(), riff.end(), func(c *riffChunk) error {
+		switch {
+		case c.id == "bext" && c.size >= 338:
+			b, err := readAt(r, c.dataOffset()+320, 18)
+			if err != nil {
+				return err
+			}
+			if t, err := parseBWFTime(b); err == nil {
+				candidates = append(candidates, TimeCandidate{t, SourceRIFF, "bext"})
+			}
+		case c.id == "LIST" && c.list == "INFO":
+			return walkRIFFChunks(r, c.childOffset(), c.end(), func(c *riffChunk) error {
+				if c.id == "ICRD" {
+					icrd = readRIFFString(r, c)
+					return errStopWalk
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if icrd != "" {
+		if t, err := parseAVITime(icrd); err == nil {
+			candidates = append(candidates, TimeCandidate{t, SourceRIFF, "ICRD"})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, &ErrNoOriginalTime{"no date in WAV chunks"}
+	}
+	return candidates, nil
+}
+
+// parseBWFTime parses the OriginationDate and OriginationTime of a bext
+// chunk. Any of '-', '_', ':', ' ' and '.' separates the fields.
+func parseBWFTime(b []byte) (time.Time, error) {
+	s := []byte(string(b))
+	for _, i := range []int{4, 7, 10 + 2, 10 + 5} {
+		s[i] = '-'
+	}
+	return time.ParseInLocation("2006-01-0215-04-05", string(s), time.Local)
+}
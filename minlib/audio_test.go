@@ -0,0 +1,151 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// id3Tag returns an ID3v2 tag of the given major version holding frames.
+func id3Tag(version byte, frames ...[]byte) []byte {
+	data := bytes.Join(frames, nil)
+	n := len(data)
+	return append([]byte{'I', 'D', '3', version, 0, 0,
+		byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}, data...)
+}
+
+// id3Frame returns a text frame of an ID3v2.3 or v2.4 tag, ISO-8859-1
+// encoded.
+func id3Frame(version byte, id, text string) []byte {
+	n := 1 + len(text)
+	size := be32(uint32(n))
+	if version == 4 {
+		size = []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	}
+	f := append([]byte(id), size...)
+	f = append(f, 0, 0, 0)
+	return append(f, text...)
+}
+
+// vorbisComments returns a Vorbis comment block of the fields.
+func vorbisComments(fields ...string) []byte {
+	le := binary.LittleEndian
+	b := le.AppendUint32(nil, 6)
+	b = append(b, "minlib"...)
+	b = le.AppendUint32(b, uint32(len(fields)))
+	for _, f := range fields {
+		b = le.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+// oggPage returns an Ogg page of the stream serial holding the packets.
+func oggPage(serial, sequence uint32, packets ...[]byte) []byte {
+	var segments, data []byte
+	for _, p := range packets {
+		n := len(p)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		data = append(data, p...)
+	}
+	le := binary.LittleEndian
+	page := append([]byte("OggS"), 0, 0)
+	page = le.AppendUint64(page, 0)
+	page = le.AppendUint32(page, serial)
+	page = le.AppendUint32(page, sequence)
+	page = le.AppendUint32(page, crc32.ChecksumIEEE(data))
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	return append(page, data...)
+}
+
+func TestAudioOriginalTime(t *testing.T) {
+	local := time.Date(2019, 5, 6, 7, 8, 9, 0, time.Local)
+
+	flacBlock := func(typ byte, last bool, data []byte) []byte {
+		if last {
+			typ |= 0x80
+		}
+		return append([]byte{typ, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}, data...)
+	}
+	flac := bytes.Join([][]byte{
+		[]byte("fLaC"),
+		flacBlock(0, false, make([]byte, 34)),
+		flacBlock(4, true, vorbisComments("TITLE=memo", "date=2019-05-06T07:08:09")),
+	}, nil)
+
+	bigComment := vorbisComments("ARTIST=someone", "DATE=2019-05-06 07:08:09", "COVER="+string(make([]byte, 600)))
+	ogg := bytes.Join([][]byte{
+		oggPage(7, 0, append([]byte("OpusHead"), make([]byte, 11)...)),
+		oggPage(8, 0, []byte("\x01other stream")),
+		oggPage(7, 1, append([]byte("OpusTags"), bigComment...)),
+	}, nil)
+
+	bext := make([]byte, 602)
+	copy(bext[320:], "2019-05-0607:08:09")
+	wav := chunk("RIFF", []byte("WAVE"), chunk("fmt ", make([]byte, 16)), chunk("bext", bext),
+		chunk("LIST", []byte("INFO"), chunk("ICRD", []byte("2019-05-06\x00"))), chunk("data", make([]byte, 4)))
+
+	// unsynchronisation inserts a 0 after every 0xFF
+	frames := bytes.Join([][]byte{id3Frame(3, "TIT2", "\xffmemo"), id3Frame(3, "TYER", "2019"),
+		id3Frame(3, "TDAT", "0605"), id3Frame(3, "TIME", "0708")}, nil)
+	unsynced := id3Tag(3, bytes.ReplaceAll(frames, []byte{0xff}, []byte{0xff, 0}))
+	unsynced[5] = 0x80
+
+	cases := []struct {
+		name string
+		data []byte
+		want []TimeCandidate
+	}{
+		{"memo.mp3", append(id3Tag(4, id3Frame(4, "TIT2", "memo"), id3Frame(4, "TDRC", "2019-05-06T07:08:09")), 0xFF, 0xFB, 0x90, 0x64),
+			[]TimeCandidate{{local, SourceID3, "TDRC"}}},
+		{"v23.mp3", id3Tag(3, id3Frame(3, "TYER", "2019"), id3Frame(3, "TDAT", "0605"), id3Frame(3, "TIME", "0708")),
+			[]TimeCandidate{{local.Add(-9 * time.Second), SourceID3, "TDAT"}}},
+		{"unsynced.mp3", unsynced, []TimeCandidate{{local.Add(-9 * time.Second), SourceID3, "TDAT"}}},
+		{"memo.flac", flac, []TimeCandidate{{local, SourceVorbis, "DATE"}}},
+		{"id3.flac", append(id3Tag(4), flac...), []TimeCandidate{{local, SourceVorbis, "DATE"}}},
+		{"memo.opus", ogg, []TimeCandidate{{local, SourceVorbis, "DATE"}}},
+		{"memo.wav", wav, []TimeCandidate{
+			{local, SourceRIFF, "bext"},
+			{time.Date(2019, 5, 6, 0, 0, 0, 0, time.Local), SourceRIFF, "ICRD"},
+		}},
+	}
+	dir := t.TempDir()
+	for _, c := range cases {
+		p := filepath.Join(dir, c.name)
+		if err := os.WriteFile(p, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := ResolveFileTime(p)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		got := r.Candidates[:len(r.Candidates)-1] // without the mtime
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Time.Equal(c.want[i].Time) || got[i].Source != c.want[i].Source || got[i].Detail != c.want[i].Detail {
+				t.Errorf("%s: got %v, want %v", c.name, got[i], c.want[i])
+			}
+		}
+	}
+
+	// music with the release year only
+	data := id3Tag(4, id3Frame(4, "TDRC", "1999"))
+	if _, err := ReaderOriginalTime(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("release year: got no error")
+	}
+}
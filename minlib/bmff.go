@@ -0,0 +1,222 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ISO Base Media File Format: ISO/IEC 14496-12
+// Boxes are laid out as [size:4][type:4]([largesize:8])([usertype:16])[payload]
+
+type bmffBox struct {
+	typ    string
+	offset int64 // offset of the box header
+	size   int64 // total size of the box, including the header
+	hdrLen int64
+	uuid   string // hex encoded extended type of uuid boxes
+}
+
+func (b *bmffBox) dataOffset() int64 {
+	return b.offset + b.hdrLen
+}
+
+func (b *bmffBox) end() int64 {
+	return b.offset + b.size
+}
+
+var errStopWalk = errors.New("stop walk")
+
+// Limits of a box tree: boxes walked in a container and nesting of the
+// containers walked recursively.
+const (
+	maxBoxesPerWalk = 1 << 18
+	maxBoxDepth     = 16
+)
+
+// readAt reads exactly n bytes at offset off from r. Reading past the end
+// of r returns a FormatError wrapping ErrTruncated.
+func readAt(r io.ReadSeeker, off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 {
+		return nil, formatError("", off, fmt.Sprintf("invalid read of %d bytes", n))
+	}
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, truncatedError("", off)
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// streamSize returns the size of r by seeking to its end.
+func streamSize(r io.ReadSeeker) (int64, error) {
+	return r.Seek(0, io.SeekEnd)
+}
+
+// readBoxHeader reads the header of the box starting at offset. limit is
+// the end of the enclosing box (or of the file).
+func readBoxHeader(r io.ReadSeeker, offset, limit int64) (*bmffBox, error) {
+	if limit-offset < 8 {
+		return nil, truncatedError("bmff", offset)
+	}
+	hdr, err := readAt(r, offset, 8)
+	if err != nil {
+		return nil, err
+	}
+	b := &bmffBox{
+		typ:    string(hdr[4:8]),
+		offset: offset,
+		size:   int64(binary.BigEndian.Uint32(hdr[0:4])),
+		hdrLen: 8,
+	}
+	switch b.size {
+	case 0:
+		// box extends to the end of the enclosing box
+		b.size = limit - offset
+	case 1:
+		ext, err := readAt(r, offset+8, 8)
+		if err != nil {
+			return nil, err
+		}
+		b.hdrLen = 16
+		b.size = int64(binary.BigEndian.Uint64(ext))
+	}
+	if b.typ == "uuid" {
+		ext, err := readAt(r, offset+b.hdrLen, 16)
+		if err != nil {
+			return nil, err
+		}
+		b.uuid = fmt.Sprintf("%x", ext)
+		b.hdrLen += 16
+	}
+	if b.size < b.hdrLen || b.size > limit-offset {
+		return nil, formatError("bmff", offset, fmt.Sprintf("invalid size %d for box %q", b.size, b.typ))
+	}
+	return b, nil
+}
+
+// walkBoxes calls fn for every box in [start, end). Returning errStopWalk
+// from fn stops the walk without an error. At most maxBoxesPerWalk boxes
+// are visited.
+func walkBoxes(r io.ReadSeeker, start, end int64, fn func(b *bmffBox) error) error {
+	for offset, n := start, 0; end-offset >= 8; n++ {
+		if n >= maxBoxesPerWalk {
+			return limitError("bmff", offset, "too many boxes")
+		}
+		b, err := readBoxHeader(r, offset, end)
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			if err == errStopWalk {
+				return nil
+			}
+			return err
+		}
+		offset = b.end()
+	}
+	return nil
+}
+
+// findBox returns the first box of type typ in [start, end).
+func findBox(r io.ReadSeeker, start, end int64, typ string) (*bmffBox, error) {
+	var found *bmffBox
+	err := walkBoxes(r, start, end, func(b *bmffBox) error {
+		if b.typ == typ {
+			found = b
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("bmff: box %q not found", typ)
+	}
+	return found, nil
+}
+
+// boxPayload reads the whole payload of b.
+func boxPayload(r io.ReadSeeker, b *bmffBox, max int64) ([]byte, error) {
+	n := b.size - b.hdrLen
+	if n > max {
+		return nil, limitError("bmff", b.offset, fmt.Sprintf("box %q of %d bytes", b.typ, n))
+	}
+	return readAt(r, b.dataOffset(), int(n))
+}
+
+// bmffCursor reads big-endian fields from a box payload. Reads past the end
+// of the payload set err and return zero values.
+type bmffCursor struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (c *bmffCursor) next(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if n < 0 || len(c.b)-c.off < n {
+		c.err = truncatedError("bmff", -1)
+		return nil
+	}
+	p := c.b[c.off : c.off+n]
+	c.off += n
+	return p
+}
+
+func (c *bmffCursor) u8() uint8 {
+	if p := c.next(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (c *bmffCursor) u16() uint16 {
+	if p := c.next(2); p != nil {
+		return binary.BigEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (c *bmffCursor) u32() uint32 {
+	if p := c.next(4); p != nil {
+		return binary.BigEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (c *bmffCursor) u64() uint64 {
+	if p := c.next(8); p != nil {
+		return binary.BigEndian.Uint64(p)
+	}
+	return 0
+}
+
+// uint reads an n-byte unsigned integer, n being 0, 2, 4 or 8.
+func (c *bmffCursor) uint(n int) uint64 {
+	switch n {
+	case 0:
+		return 0
+	case 2:
+		return uint64(c.u16())
+	case 4:
+		return uint64(c.u32())
+	case 8:
+		return c.u64()
+	}
+	c.err = formatError("bmff", -1, fmt.Sprintf("unsupported field size %d", n))
+	return 0
+}
+
+func (c *bmffCursor) skip(n int) {
+	c.next(n)
+}
@@ -0,0 +1,220 @@
+package minlib
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// PDF: the document information dictionary holds the /CreationDate, as
+// D:YYYYMMDDHHmmSSOHH'mm' (ISO 32000-1, 7.9.4); the fields after the year
+// are optional. The dictionary is found by searching the start and the end
+// of the file, where writers put it; dictionaries in compressed object
+// streams are not found.
+// OOXML: docProps/core.xml of the zip archive holds dcterms:created, in
+// W3CDTF (ISO 8601).
+
+// pdfSearchSize is the size of the head and the tail of a PDF file searched
+// for the document information.
+const pdfSearchSize = 1 << 20
+
+// maxOOXMLCoreSize limits the size of docProps/core.xml.
+const maxOOXMLCoreSize = 1 << 20
+
+// pdfTimeCandidates returns the /CreationDate of a PDF file. When a file
+// was updated incrementally, the information at the end of the file is the
+// latest.
+func pdfTimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	regions := []int64{0}
+	if size > pdfSearchSize {
+		regions = []int64{size - pdfSearchSize, 0}
+	}
+	for _, offset := range regions {
+		n := size - offset
+		if n > pdfSearchSize {
+			n = pdfSearchSize
+		}
+		data, err := readAt(r, offset, int(n))
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := findPDFCreationDate(data); ok {
+			return []TimeCandidate{{t, SourcePDF, "CreationDate"}}, nil
+		}
+	}
+	return nil, &ErrNoOriginalTime{"no /CreationDate in PDF"}
+}
+
+// findPDFCreationDate returns the last valid /CreationDate of data.
+func findPDFCreationDate(data []byte) (time.Time, bool) {
+	key := []byte("/CreationDate")
+	for end := len(data); ; {
+		i := bytes.LastIndex(data[:end], key)
+		if i < 0 {
+			return zeroTime, false
+		}
+		end = i
+		s, ok := pdfString(bytes.TrimLeft(data[i+len(key):], " \t\r\n"))
+		if !ok {
+			continue
+		}
+		if t, err := parsePDFTime(s); err == nil {
+			return t, true
+		}
+	}
+}
+
+// pdfString decodes the literal or hexadecimal string at the start of b.
+// UTF-16 strings are recognized by their byte order mark.
+func pdfString(b []byte) (string, bool) {
+	if len(b) == 0 {
+		return "", false
+	}
+	var s []byte
+	switch b[0] {
+	case '(':
+		for i := 1; i < len(b) && len(s) < 128; i++ {
+			switch c := b[i]; c {
+			case ')':
+				return decodePDFText(s), true
+			case '\\':
+				// escaped character, octal codes are not used in dates
+				if i++; i < len(b) {
+					s = append(s, b[i])
+				}
+			default:
+				s = append(s, c)
+			}
+		}
+	case '<':
+		end := bytes.IndexByte(b, '>')
+		if end < 0 || end > 256 {
+			return "", false
+		}
+		digits := bytes.Join(bytes.Fields(b[1:end]), nil)
+		if len(digits)%2 == 1 {
+			digits = append(digits, '0')
+		}
+		s = make([]byte, hex.DecodedLen(len(digits)))
+		if _, err := hex.Decode(s, digits); err != nil {
+			return "", false
+		}
+		return decodePDFText(s), true
+	}
+	return "", false
+}
+
+func decodePDFText(b []byte) string {
+	if len(b) < 2 || b[0] != 0xFE || b[1] != 0xFF {
+		return string(b)
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 2; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// parsePDFTime parses a PDF date. Dates without a day are rejected, dates
+// without a zone are in local time.
+func parsePDFTime(s string) (time.Time, error) {
+	if len(s) >= 2 && s[:2] == "D:" {
+		s = s[2:]
+	}
+	digits := len(s)
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			digits = i
+			break
+		}
+	}
+	if digits < 8 || digits%2 == 1 || digits > 14 {
+		return zeroTime, &ErrNoOriginalTime{"invalid PDF date " + s}
+	}
+	// pad the missing fields with midnight
+	value := s[:digits] + "000000"[:14-digits]
+
+	loc := time.Local
+	if zone := s[digits:]; zone != "" {
+		switch zone[0] {
+		case 'Z':
+			loc = time.UTC
+		case '+', '-':
+			var hm []int
+			for _, f := range bytes.FieldsFunc([]byte(zone[1:]), func(r rune) bool { return r == '\'' }) {
+				n, err := strconv.Atoi(string(f))
+				if err != nil {
+					return zeroTime, err
+				}
+				hm = append(hm, n)
+			}
+			if len(hm) == 1 && hm[0] >= 100 {
+				// +HHmm
+				hm = []int{hm[0] / 100, hm[0] % 100}
+			}
+			offset := 0
+			if len(hm) > 0 {
+				offset = hm[0] * 3600
+			}
+			if len(hm) > 1 {
+				offset += hm[1] * 60
+			}
+			if zone[0] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone("", offset)
+		}
+	}
+	return time.ParseInLocation("20060102150405", value, loc)
+}
+
+// ooxmlTimeCandidates returns the dcterms:created date of the core
+// properties of an Office Open XML document.
+func ooxmlTimeCandidates(ra io.ReaderAt, size int64) ([]TimeCandidate, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	var core *zip.File
+	for _, f := range zr.File {
+		if f.Name == "docProps/core.xml" {
+			core = f
+			break
+		}
+	}
+	if core == nil {
+		return nil, &ErrNoOriginalTime{"no docProps/core.xml"}
+	}
+	if core.UncompressedSize64 > maxOOXMLCoreSize {
+		return nil, limitError("ooxml", -1, "docProps/core.xml size")
+	}
+	rc, err := core.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var props struct {
+		Created string `xml:"http://purl.org/dc/terms/ created"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(rc, maxOOXMLCoreSize)).Decode(&props); err != nil {
+		return nil, formatError("ooxml", -1, err.Error())
+	}
+	if props.Created == "" {
+		return nil, &ErrNoOriginalTime{"no dcterms:created"}
+	}
+	t, err := parseISOTime(props.Created)
+	if err != nil {
+		return nil, err
+	}
+	return []TimeCandidate{{t, SourceOOXML, "dcterms:created"}}, nil
+}
@@ -0,0 +1,87 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPDFOriginalTime(t *testing.T) {
+	pdf := func(info string, padding int) []byte {
+		return bytes.Join([][]byte{
+			[]byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n"),
+			make([]byte, padding),
+			[]byte("2 0 obj\n<< /Producer (Scanner) " + info + " >>\nendobj\ntrailer\n<< /Root 1 0 R /Info 2 0 R >>\n%%EOF\n"),
+		}, nil)
+	}
+	cases := []struct {
+		data []byte
+		want time.Time
+	}{
+		{pdf("/CreationDate (D:20190506070809+02'00')", 0), time.Date(2019, 5, 6, 7, 8, 9, 0, time.FixedZone("", 2*3600))},
+		{pdf("/CreationDate(D:20190506070809Z)", 0), time.Date(2019, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{pdf("/CreationDate (D:201905060708-0530)", pdfSearchSize), time.Date(2019, 5, 6, 7, 8, 0, 0, time.FixedZone("", -5*3600-1800))},
+		{pdf("/CreationDate (D:20190506)", 0), time.Date(2019, 5, 6, 0, 0, 0, 0, time.Local)},
+		{pdf("/CreationDate <FEFF0044003A00320030003100390030003500300036>", 0), time.Date(2019, 5, 6, 0, 0, 0, 0, time.Local)},
+	}
+	for i, c := range cases {
+		got, err := ReaderOriginalTime(bytes.NewReader(c.data), int64(len(c.data)))
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("%d: got %v, want %v", i, got, c.want)
+		}
+	}
+
+	for _, info := range []string{"/CreationDate (D:2019)", "/ModDate (D:20190506)", "/CreationDate (\\\\)"} {
+		data := pdf(info, 0)
+		if _, err := ReaderOriginalTime(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("%s: got no error", info)
+		}
+	}
+}
+
+func TestOOXMLOriginalTime(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`},
+		{"word/document.xml", `<w:document/>`},
+		{"docProps/core.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+  xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/"
+  xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <dc:creator>someone</dc:creator>
+  <dcterms:created xsi:type="dcterms:W3CDTF">2019-05-06T07:08:09Z</dcterms:created>
+  <dcterms:modified xsi:type="dcterms:W3CDTF">2020-01-02T03:04:05Z</dcterms:modified>
+</cp:coreProperties>`},
+	} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	r := bytes.NewReader(data)
+	if typ, _ := DetectMediaType(r); typ != MediaDOCX {
+		t.Errorf("got type %s, want %s", typ, MediaDOCX)
+	}
+	got, err := ReaderOriginalTime(r, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2019, 5, 6, 7, 8, 9, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,390 @@
+package minlib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock profile files list the cameras as JSON:
+//
+//	{"cameras": [
+//	  {"make": "NIKON CORPORATION", "serial": "3012345", "offset": "-2m13s"},
+//	  {"model": "ILCE-7M3", "from": "2021-06-01", "until": "2021-06-08", "offset": "1h0m4s"}
+//	]}
+//
+// or as the equivalent TOML array of tables:
+//
+//	[[cameras]]
+//	make = "NIKON CORPORATION"
+//	serial = "3012345"
+//	offset = "-2m13s"
+//
+// Offsets are Go durations. Dates are ISO 8601 times, TOML dates may be
+// bare; times without a zone are local, like camera clocks.
+
+// ClockProfile is the clock error of a camera. Empty Make, Model and
+// SerialNumber match any camera.
+type ClockProfile struct {
+	Make         string
+	Model        string
+	SerialNumber string
+	// From and Until limit the profile to the times in [From, Until) read
+	// from the camera clock. They are compared with the wall clock of the
+	// camera, ignoring zones. Zero values are unbounded.
+	From, Until time.Time
+	// Offset is added to the times of the camera clock.
+	Offset time.Duration
+}
+
+// matches reports whether the profile applies to a file of the camera
+// taken at t, by the camera clock.
+func (p *ClockProfile) matches(c cameraID, t time.Time) bool {
+	t = wallClock(t)
+	switch {
+	case p.Make != "" && !strings.EqualFold(p.Make, c.make):
+		return false
+	case p.Model != "" && !strings.EqualFold(p.Model, c.model):
+		return false
+	case p.SerialNumber != "" && p.SerialNumber != c.serial:
+		return false
+	case !p.From.IsZero() && t.Before(wallClock(p.From)):
+		return false
+	case !p.Until.IsZero() && !t.Before(wallClock(p.Until)):
+		return false
+	}
+	return true
+}
+
+// wallClock returns the date and clock of t in UTC, for comparing times as
+// read from a clock whatever their zones.
+func wallClock(t time.Time) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	return time.Date(year, month, day, hour, min, sec, t.Nanosecond(), time.UTC)
+}
+
+// specificity is the number of camera fields and bounds p is keyed by.
+func (p *ClockProfile) specificity() int {
+	n := 0
+	for _, set := range []bool{p.Make != "", p.Model != "", p.SerialNumber != "", !p.From.IsZero(), !p.Until.IsZero()} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// ClockProfiles corrects the file times of cameras whose clocks were off.
+type ClockProfiles []ClockProfile
+
+// LoadClockProfiles reads the clock profiles of the JSON or TOML file p.
+func LoadClockProfiles(p string) (ClockProfiles, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClockProfiles(data)
+}
+
+// ParseClockProfiles parses JSON or TOML clock profiles. JSON is recognized
+// by its leading '{'.
+func ParseClockProfiles(data []byte) (ClockProfiles, error) {
+	var fields []clockProfileFields
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var v struct {
+			Cameras []clockProfileFields `json:"cameras"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		fields = v.Cameras
+	} else {
+		var err error
+		if fields, err = parseClockProfilesTOML(data); err != nil {
+			return nil, err
+		}
+	}
+
+	profiles := make(ClockProfiles, len(fields))
+	for i, f := range fields {
+		p, err := f.profile()
+		if err != nil {
+			return nil, fmt.Errorf("clock profile %d: %w", i+1, err)
+		}
+		profiles[i] = *p
+	}
+	return profiles, nil
+}
+
+// clockProfileFields is a clock profile as written in a file.
+type clockProfileFields struct {
+	Make   string `json:"make"`
+	Model  string `json:"model"`
+	Serial string `json:"serial"`
+	From   string `json:"from"`
+	Until  string `json:"until"`
+	Offset string `json:"offset"`
+}
+
+func (f *clockProfileFields) profile() (*ClockProfile, error) {
+	if f.Offset == "" {
+		return nil, errors.New("no offset")
+	}
+	offset, err := time.ParseDuration(f.Offset)
+	if err != nil {
+		return nil, err
+	}
+	p := &ClockProfile{Make: f.Make, Model: f.Model, SerialNumber: f.Serial, Offset: offset}
+	if f.From != "" {
+		if p.From, err = parseISOTime(f.From); err != nil {
+			return nil, err
+		}
+	}
+	if f.Until != "" {
+		if p.Until, err = parseISOTime(f.Until); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// parseClockProfilesTOML reads the [[cameras]] tables of a TOML document.
+// Only the TOML used by clock profiles is supported: comments, table
+// headers and key/value pairs of strings, dates and numbers.
+func parseClockProfilesTOML(data []byte) ([]clockProfileFields, error) {
+	var profiles []clockProfileFields
+	var cur *clockProfileFields
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		if text[0] == '[' {
+			if text != "[[cameras]]" {
+				return nil, fmt.Errorf("clock profiles: line %d: unexpected table %s", line, text)
+			}
+			profiles = append(profiles, clockProfileFields{})
+			cur = &profiles[len(profiles)-1]
+			continue
+		}
+		i := strings.IndexByte(text, '=')
+		if i < 0 || cur == nil {
+			return nil, fmt.Errorf("clock profiles: line %d: expected a key of a [[cameras]] table", line)
+		}
+		key := strings.Trim(strings.TrimSpace(text[:i]), `"`)
+		value, err := tomlValue(strings.TrimSpace(text[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("clock profiles: line %d: %w", line, err)
+		}
+		switch key {
+		case "make":
+			cur.Make = value
+		case "model":
+			cur.Model = value
+		case "serial":
+			cur.Serial = value
+		case "from":
+			cur.From = value
+		case "until":
+			cur.Until = value
+		case "offset":
+			cur.Offset = value
+		default:
+			return nil, fmt.Errorf("clock profiles: line %d: unknown key %s", line, key)
+		}
+	}
+	return profiles, s.Err()
+}
+
+// tomlValue returns the string of a TOML value followed by an optional
+// comment. Bare dates may separate the time with a space.
+func tomlValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return "", errors.New("unterminated string")
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], nil
+	}
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if len(s) > 10 && s[10] == ' ' {
+		s = s[:10] + "T" + s[11:]
+	}
+	return s, nil
+}
+
+// Offset returns the offset of the most specific profile matching the
+// camera at the camera time t. The first profile wins a tie.
+func (ps ClockProfiles) Offset(cameraMake, model, serial string, t time.Time) (time.Duration, bool) {
+	p := ps.find(cameraID{cameraMake, model, serial}, t)
+	if p == nil {
+		return 0, false
+	}
+	return p.Offset, true
+}
+
+func (ps ClockProfiles) find(c cameraID, t time.Time) *ClockProfile {
+	var best *ClockProfile
+	for i := range ps {
+		p := &ps[i]
+		if p.matches(c, t) && (best == nil || p.specificity() > best.specificity()) {
+			best = p
+		}
+	}
+	return best
+}
+
+// ResolveFileTime is like the function ResolveFileTime, with the times of
+// the camera clock corrected by the profile of the camera of p.
+func (ps ClockProfiles) ResolveFileTime(p string) (*TimeResolution, error) {
+	return ps.resolveTime(osFS{}, p)
+}
+
+// ResolveFSTime is like the function ResolveFSTime, with the times of the
+// camera clock corrected by the profile of the camera of the file.
+func (ps ClockProfiles) ResolveFSTime(fsys fs.FS, name string) (*TimeResolution, error) {
+	return ps.resolveTime(ioFS{fsys}, name)
+}
+
+func (ps ClockProfiles) resolveTime(fsys fileSystem, name string) (*TimeResolution, error) {
+	r, err := resolveTime(fsys, name)
+	if err != nil || len(ps) == 0 {
+		return r, err
+	}
+	var camera time.Time
+	for _, c := range r.Candidates {
+		if isCameraClockSource(c.Source) {
+			camera = c.Time
+			break
+		}
+	}
+	if camera.IsZero() {
+		return r, nil
+	}
+	p := ps.find(fileCamera(fsys, name), camera)
+	if p == nil || p.Offset == 0 {
+		return r, nil
+	}
+
+	candidates := make([]TimeCandidate, len(r.Candidates))
+	for i, c := range r.Candidates {
+		if isCameraClockSource(c.Source) {
+			c.Time = c.Time.Add(p.Offset)
+		}
+		candidates[i] = c
+	}
+	r = newTimeResolution(candidates)
+	r.ClockOffset = p.Offset
+	return r, nil
+}
+
+// isCameraClockSource reports whether times of the source were set by the
+// clock of the recording device.
+func isCameraClockSource(s TimeSource) bool {
+	switch s {
+	case SourceExif, SourceQuickTime, SourceRIFF, SourceMPEGTS, SourceMatroska, SourceXMP:
+		return true
+	}
+	return false
+}
+
+// cameraID identifies the camera a file was recorded with.
+type cameraID struct {
+	make, model, serial string
+}
+
+// fileCamera returns the camera of the file name from its Exif metadata,
+// or from the Apple QuickTime metadata of movies.
+func fileCamera(fsys fileSystem, name string) cameraID {
+	m, err := openMedia(fsys, name)
+	if err != nil {
+		return cameraID{}
+	}
+	defer m.Close()
+	switch m.typ {
+	case MediaQuickTime, MediaMP4:
+		if movie, err := parseMOV(m.reader()); err == nil {
+			return cameraID{
+				make:  movie.metadata["com.apple.quicktime.make"],
+				model: movie.metadata["com.apple.quicktime.model"],
+			}
+		}
+		return cameraID{}
+	}
+	if x, err := m.exif(); err == nil {
+		return cameraID{x.Make, x.Model, x.SerialNumber}
+	}
+	return cameraID{}
+}
+
+// DeriveClockProfile returns the profile correcting the camera of file p
+// to the clock of the camera of file reference, both files showing the same
+// moment. The profile is keyed by the make, model and serial number of the
+// camera of p.
+func DeriveClockProfile(reference, p string) (*ClockProfile, error) {
+	return deriveClockProfile(osFS{}, reference, p)
+}
+
+// FSDeriveClockProfile is like DeriveClockProfile for files of fsys.
+func FSDeriveClockProfile(fsys fs.FS, reference, name string) (*ClockProfile, error) {
+	return deriveClockProfile(ioFS{fsys}, reference, name)
+}
+
+func deriveClockProfile(fsys fileSystem, reference, name string) (*ClockProfile, error) {
+	want, err := cameraClockTime(fsys, reference)
+	if err != nil {
+		return nil, err
+	}
+	got, err := cameraClockTime(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	c := fileCamera(fsys, name)
+	if c == (cameraID{}) {
+		return nil, errors.New(name + ": unknown camera")
+	}
+	return &ClockProfile{
+		Make:         c.make,
+		Model:        c.model,
+		SerialNumber: c.serial,
+		Offset:       want.Sub(got),
+	}, nil
+}
+
+// cameraClockTime returns the most trusted time of the file name set by
+// the camera clock.
+func cameraClockTime(fsys fileSystem, name string) (time.Time, error) {
+	r, err := resolveTime(fsys, name)
+	if err != nil {
+		return zeroTime, err
+	}
+	for _, c := range r.Candidates {
+		if isCameraClockSource(c.Source) {
+			return c.Time, nil
+		}
+	}
+	return zeroTime, &ErrNoOriginalTime{name + ": no camera time"}
+}
@@ -0,0 +1,161 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseClockProfiles(t *testing.T) {
+	want := ClockProfiles{
+		{Make: "NIKON CORPORATION", SerialNumber: "3012345", Offset: -2*time.Minute - 13*time.Second},
+		{Model: "ILCE-7M3", From: time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local),
+			Until: time.Date(2021, 6, 8, 12, 0, 0, 0, time.UTC), Offset: time.Hour + 4*time.Second},
+	}
+	json := `{"cameras": [
+		{"make": "NIKON CORPORATION", "serial": "3012345", "offset": "-2m13s"},
+		{"model": "ILCE-7M3", "from": "2021-06-01", "until": "2021-06-08T12:00:00Z", "offset": "1h0m4s"}
+	]}`
+	toml := `# clocks of the wedding shoot
+[[cameras]]
+make = "NIKON CORPORATION"
+serial = '3012345'
+offset = "-2m13s" # behind
+
+[[cameras]]
+model = "ILCE-7M3"
+from = 2021-06-01
+until = 2021-06-08 12:00:00Z
+offset = "1h0m4s"
+`
+	for _, data := range []string{json, toml} {
+		got, err := ParseClockProfiles([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+		for i := range want {
+			if !got[i].From.Equal(want[i].From) || !got[i].Until.Equal(want[i].Until) ||
+				got[i].Make != want[i].Make || got[i].Model != want[i].Model ||
+				got[i].SerialNumber != want[i].SerialNumber || got[i].Offset != want[i].Offset {
+				t.Errorf("profile %d: got %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+
+	for _, data := range []string{
+		`{"cameras": [{"make": "Canon"}]}`,
+		`{"cameras": [{"offset": "2 minutes"}]}`,
+		"[[cameras]]\nlens = \"50mm\"\noffset = \"1m\"",
+		"[cameras]\noffset = \"1m\"",
+		"offset = \"1m\"",
+	} {
+		if _, err := ParseClockProfiles([]byte(data)); err == nil {
+			t.Errorf("%q: got no error", data)
+		}
+	}
+}
+
+func TestClockProfilesOffset(t *testing.T) {
+	june := time.Date(2021, 6, 3, 10, 0, 0, 0, time.Local)
+	ps := ClockProfiles{
+		{Make: "Sony", Offset: time.Minute},
+		{Make: "SONY", Model: "ILCE-7M3", Offset: 2 * time.Minute},
+		{Make: "SONY", Model: "ILCE-7M3", From: june.AddDate(0, 0, -2), Until: june.AddDate(0, 0, 5), Offset: 3 * time.Minute},
+		{SerialNumber: "3012345", Offset: 4 * time.Minute},
+	}
+	cases := []struct {
+		make, model, serial string
+		t                   time.Time
+		want                time.Duration
+		ok                  bool
+	}{
+		{"SONY", "ILCE-7M3", "", june, 3 * time.Minute, true},
+		{"SONY", "ILCE-7M3", "", june.AddDate(0, 1, 0), 2 * time.Minute, true},
+		{"SONY", "ILCE-6000", "", june, time.Minute, true},
+		{"NIKON CORPORATION", "NIKON D750", "3012345", june, 4 * time.Minute, true},
+		{"Canon", "Canon EOS R5", "", june, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := ps.Offset(c.make, c.model, c.serial, c.t)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s %s: got %v, %v; want %v, %v", c.make, c.model, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestClockProfilesResolve(t *testing.T) {
+	camera := func(model, serial, date string) *fstest.MapFile {
+		tiff := buildTIFF(binary.LittleEndian, &tiffIFD{
+			entries: []tiffEntry{asciiTag(0x010f, "NIKON CORPORATION"), asciiTag(0x0110, model)},
+			subs: map[uint16]*tiffIFD{
+				0x8769: {entries: []tiffEntry{asciiTag(0x9003, date), asciiTag(0xa431, serial)}},
+			},
+		})
+		return &fstest.MapFile{Data: buildJPEG(exifAPP1(tiff))}
+	}
+	fsys := fstest.MapFS{
+		"a/DSC_0001.JPG": camera("NIKON D750", "3012345", "2021:06:03 10:02:13"),
+		"b/DSC_0001.JPG": camera("NIKON Z 6", "6000001", "2021:06:03 10:00:00"),
+	}
+
+	p, err := FSDeriveClockProfile(fsys, "b/DSC_0001.JPG", "a/DSC_0001.JPG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ClockProfile{Make: "NIKON CORPORATION", Model: "NIKON D750", SerialNumber: "3012345", Offset: -2*time.Minute - 13*time.Second}
+	if *p != want {
+		t.Errorf("got profile %+v, want %+v", *p, want)
+	}
+
+	ps := ClockProfiles{*p}
+	r, err := ps.ResolveFSTime(fsys, "a/DSC_0001.JPG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2021, 6, 3, 10, 0, 0, 0, time.Local); !r.Time.Equal(want) || r.ClockOffset != p.Offset {
+		t.Errorf("got %v corrected by %v, want %v", r.Time, r.ClockOffset, want)
+	}
+	if last := r.Candidates[len(r.Candidates)-1]; last.Source != SourceMtime || !last.Time.IsZero() {
+		t.Errorf("the modification time was corrected: %v", last)
+	}
+	r, err = ps.ResolveFSTime(fsys, "b/DSC_0001.JPG")
+	if err != nil || r.ClockOffset != 0 {
+		t.Errorf("other camera corrected: %+v, %v", r, err)
+	}
+
+	// the bounds are compared with the wall clock of the camera, whatever
+	// the zone of its OffsetTimeOriginal: 5 hours east of the local zone,
+	// 00:30 is the day before in local time, 5 hours west 23:30 the day
+	// after
+	_, local := time.Date(2021, 6, 3, 12, 0, 0, 0, time.Local).Zone()
+	off, date := local+5*3600, "2021:06:03 00:30:00"
+	if off > 14*3600 {
+		off, date = local-5*3600, "2021:06:03 23:30:00"
+	}
+	sign := "+"
+	if off < 0 {
+		sign, off = "-", -off
+	}
+	offset := fmt.Sprintf("%s%02d:%02d", sign, off/3600, off/60%60)
+	tiff := buildTIFF(binary.LittleEndian, &tiffIFD{
+		entries: []tiffEntry{asciiTag(0x010f, "NIKON CORPORATION")},
+		subs: map[uint16]*tiffIFD{
+			0x8769: {entries: []tiffEntry{asciiTag(0x9003, date), asciiTag(0x9011, offset)}},
+		},
+	})
+	fsys["c/DSC_0001.JPG"] = &fstest.MapFile{Data: buildJPEG(exifAPP1(tiff))}
+	ps = ClockProfiles{{Make: "NIKON CORPORATION", From: time.Date(2021, 6, 3, 0, 0, 0, 0, time.Local),
+		Until: time.Date(2021, 6, 4, 0, 0, 0, 0, time.Local), Offset: time.Minute}}
+	r, err = ps.ResolveFSTime(fsys, "c/DSC_0001.JPG")
+	if err != nil || r.ClockOffset != time.Minute {
+		t.Errorf("zoned camera time: got %+v, %v, want a 1m correction", r, err)
+	}
+}
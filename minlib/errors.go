@@ -0,0 +1,52 @@
+package minlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is wrapped by the FormatError of data ending inside a
+// structure.
+var ErrTruncated = errors.New("truncated data")
+
+// ErrLimit is wrapped by the FormatError of data exceeding a parser limit,
+// such as a nesting depth or a number of entries.
+var ErrLimit = errors.New("parser limit exceeded")
+
+// FormatError reports malformed metadata. Use errors.Is with ErrTruncated
+// or ErrLimit to tell why the data was rejected.
+type FormatError struct {
+	// Format names the structure being parsed: "exif", "jpeg", "bmff",
+	// "heif", "mov", "riff", "xmp" ...
+	Format string
+	// Offset is the position of the error in the stream, or -1.
+	Offset int64
+	Err    error
+}
+
+func (e *FormatError) Error() string {
+	s := e.Err.Error()
+	if e.Offset >= 0 {
+		s = fmt.Sprintf("%s at offset %d", s, e.Offset)
+	}
+	if e.Format != "" {
+		s = e.Format + ": " + s
+	}
+	return s
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+func formatError(format string, offset int64, msg string) error {
+	return &FormatError{format, offset, errors.New(msg)}
+}
+
+func truncatedError(format string, offset int64) error {
+	return &FormatError{format, offset, ErrTruncated}
+}
+
+func limitError(format string, offset int64, what string) error {
+	return &FormatError{format, offset, fmt.Errorf("%w: %s", ErrLimit, what)}
+}
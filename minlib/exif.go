@@ -6,10 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path"
-	"path/filepath"
-	"strconv"
+	"io/fs"
 	"strings"
 	"time"
 )
@@ -18,9 +15,6 @@ import (
 // exiftool -htmlDump FILE
 // hexdump -C FILE
 
-// AVI RIFF File Reference: https://msdn.microsoft.com/en-us/library/ms779636.aspx
-// Nikon Tags: https://www.sno.phy.queensu.ca/~phil/exiftool/TagNames/Nikon.html#AVITags
-
 type ErrNoOriginalTime struct {
 	s string
 }
@@ -35,372 +29,308 @@ func (err *ErrNoOriginalTime) Error() string {
 
 var zeroTime = time.Time{}
 
+// FileTime returns the best known time for the file at path: its original
+// time from embedded or XMP metadata, then the time of its Google Takeout
+// sidecar, then the time found in its name, then its modification time.
+// Use ResolveFileTime to know where the time comes from.
 func FileTime(path string) (time.Time, error) {
-	created, err := FileOriginalTime(path)
-
+	r, err := ResolveFileTime(path)
 	if err != nil {
-		if fi, err := os.Stat(path); err == nil {
-			return fi.ModTime(), nil
-		}
+		return zeroTime, err
 	}
-	return created, err
+	return r.Time, nil
 }
 
 // FileOriginalTime returns the original time for file p.
 func FileOriginalTime(p string) (time.Time, error) {
-	ext := strings.ToLower(filepath.Ext(p))
-	switch ext {
-	case ".mov", ".mp4", ".m4v", ".m4a":
-		return movOriginalTime(p)
-	case ".jpg", ".jpeg", ".arw", ".nef":
-		r, err := os.Open(p)
-		if err != nil {
-			return zeroTime, err
-		}
-		defer r.Close()
-		t, err := ExtractExifDateTime(r)
-		if err != nil {
-			return guessTimeFromFilename(p)
-		}
-		return t, nil
-	case ".avi":
-		// Currently only support *.avi created by Nikon
-		return aviOriginalTime(p)
-	default:
-		return guessTimeFromFilename(p)
-	}
+	return originalTime(osFS{}, p)
 }
 
-// func imageOriginalTime(p string) (time.Time, error) {
-// 	f, err := os.Open(p)
-// 	if err != nil {
-// 		return time.Time{}, err
-// 	}
-
-// 	x, err := exif.Decode(f)
-// 	if err != nil {
-// 		return guessTimeFromFilename(p)
-// 	}
-// 	if t, err := x.DateTime(); err == nil {
-// 		return t, err
-// 	} else {
-// 		return guessTimeFromFilename(p)
-// 	}
-// }
-
-func movOriginalTime(p string) (originalTime time.Time, err error) {
-	ATOM_HEADER_SIZE := 8
-	// difference between Unix epoch and QuickTime epoch, in seconds
-	EPOCH_ADJUSTER := 2082844800
-	// EPOCH_ADJUSTER := 0
+// FSOriginalTime returns the original time for the file name of fsys,
+// looking up its XMP sidecar in fsys.
+func FSOriginalTime(fsys fs.FS, name string) (time.Time, error) {
+	return originalTime(ioFS{fsys}, name)
+}
 
-	// open file and search for moov item
-	in, err := os.Open(p)
+// ReaderOriginalTime returns the original time recorded in the metadata of
+// the size bytes of r.
+func ReaderOriginalTime(r io.ReaderAt, size int64) (time.Time, error) {
+	m, err := newMediaReader(r, size, "")
 	if err != nil {
-		return
-	}
-	defer in.Close()
-
-	atomHeader := make([]byte, ATOM_HEADER_SIZE)
-	dword := make([]byte, 4)
-	for {
-		_, err = in.Read(atomHeader)
-		if err != nil {
-			return
-		}
-		if bytes.Compare(atomHeader[4:8], []byte("moov")) == 0 {
-			break
-		} else {
-			atomSize := int64(binary.BigEndian.Uint32(atomHeader[0:4]))
-			in.Seek(atomSize-8, 1)
-		}
+		return zeroTime, err
 	}
+	return m.originalTime()
+}
 
-	// found 'moov', look for 'mvhd' and timestamps
-	_, err = in.Read(atomHeader)
-	if err != nil {
-		return
-	}
-	if bytes.Compare(atomHeader[4:8], []byte("cmov")) == 0 {
-		err = &ErrNoOriginalTime{"moov atom is compressed"}
-		return
-	} else if bytes.Compare(atomHeader[4:8], []byte("mvhd")) != 0 {
-		err = &ErrNoOriginalTime{"expected to find 'mvhd' header"}
-		return
-	} else {
-		in.Seek(4, 1)
-		if _, err = in.Read(dword); err != nil {
-			return
-		}
-		timestamp := int64(binary.BigEndian.Uint32(dword))
-		timestamp -= int64(EPOCH_ADJUSTER)
-		if timestamp <= 0 {
-			return guessTimeFromFilename(p)
-		}
-		originalTime = time.Unix(timestamp, 0)
-
-		// if _, err = in.Read(dword); err != nil {
-		// 	return nil, err
-		// }
-		// modificationDate := time.Unix(int64(binary.BigEndian.Uint32(dword[0:4])), 0)
-
-		return
+func originalTime(fsys fileSystem, name string) (time.Time, error) {
+	if t, err := metadataOriginalTime(fsys, name); err == nil {
+		return t, nil
 	}
+	return guessTimeFromFilename(name)
 }
 
-func aviOriginalTime(p string) (originalTime time.Time, err error) {
-	// open file and search for moov item
-	in, err := os.Open(p)
+// metadataOriginalTime returns the original time recorded in the metadata
+// of name, falling back to its XMP sidecar.
+func metadataOriginalTime(fsys fileSystem, name string) (time.Time, error) {
+	m, err := openMedia(fsys, name)
 	if err != nil {
-		return
-	}
-	defer in.Close()
-
-	dword := make([]byte, 4)
-	if _, err = in.Read(dword); err != nil {
-		return
-	}
-
-	if bytes.Compare(dword, []byte("RIFF")) != 0 {
-		err = &ErrNoOriginalTime{"Invalid AVI file: No RIFF"}
-		return
-	}
-	if _, err = in.Read(dword); err != nil {
-		return
-	}
-	if _, err = in.Read(dword); err != nil {
-		return
+		return zeroTime, err
 	}
-	if bytes.Compare(dword[:3], []byte("AVI")) != 0 {
-		err = &ErrNoOriginalTime{"Invalid AVI file: No AVI"}
-		return
+	defer m.Close()
+	t, err := m.originalTime()
+	if err == nil {
+		return t, nil
 	}
-	return handleRIFFList(in)
-}
-
-func handleRIFFList(in io.ReadSeeker) (originalTime time.Time, err error) {
-	dword := make([]byte, 4)
-	for {
-		if _, err = in.Read(dword); err != nil {
-			return
-		}
-		if bytes.Compare(dword, []byte("LIST")) != 0 {
-			err = &ErrNoOriginalTime{"Invalid AVI file: No LIST"}
-			return
-		}
-
-		if _, err = in.Read(dword); err != nil {
-			return
-		}
-		listSize := int64(binary.LittleEndian.Uint32(dword))
-		if _, err = in.Read(dword); err != nil {
-			return
-		}
-		listType := string(dword)
-
-		if listType == "ncdt" {
-			// fmt.Println("found it!")
-			return handleRIFFChunk(in)
+	if sidecar, ok := findXMPSidecar(fsys, name); ok {
+		if xmp, xerr := sidecarXMP(fsys, sidecar); xerr == nil {
+			if t, xerr := xmp.OriginalTime(); xerr == nil {
+				return t, nil
+			}
 		}
-		// fmt.Println(listType, listSize)
-		in.Seek(listSize-4, os.SEEK_CUR)
 	}
+	return zeroTime, err
 }
 
-func handleRIFFChunk(in io.ReadSeeker) (originalTime time.Time, err error) {
-	dword := make([]byte, 4)
-	for {
-		if _, err = in.Read(dword); err != nil {
-			return
-		}
-		ckID := string(dword)
-		if _, err = in.Read(dword); err != nil {
-			return
-		}
-		ckSize := binary.LittleEndian.Uint32(dword)
-		if ckID != "nctg" {
-			in.Seek(int64(ckSize), os.SEEK_CUR)
-			continue
+// originalTime returns the original time recorded in the container, Exif
+// or XMP metadata of m.
+func (m *mediaReader) originalTime() (time.Time, error) {
+	candidates, err := m.timeCandidates()
+	if err == nil {
+		return candidates[0].Time, nil
+	}
+	if xmp, xerr := m.xmp(); xerr == nil {
+		if t, xerr := xmp.OriginalTime(); xerr == nil {
+			return t, nil
 		}
-
-		// process nctg data
-		return handleRIFFChunkTags(in)
 	}
+	return zeroTime, err
 }
 
-func handleRIFFChunkTags(in io.ReadSeeker) (originalTime time.Time, err error) {
-	word := make([]byte, 2)
-	for {
-		if _, err = in.Read(word); err != nil {
-			return
-		}
-		tagID := binary.LittleEndian.Uint16(word)
-		if _, err = in.Read(word); err != nil {
-			return
+// timeCandidates returns the times recorded in the container or Exif
+// metadata of m, most trusted first. It never returns an empty slice
+// without an error.
+func (m *mediaReader) timeCandidates() ([]TimeCandidate, error) {
+	switch m.typ {
+	case MediaQuickTime, MediaMP4, MediaM4A:
+		return movTimeCandidates(m.reader())
+	case MediaJPEG, MediaTIFF, MediaWebP, MediaHEIC, MediaHEIF, MediaAVIF, MediaCR3, MediaRAF:
+		x, err := m.exif()
+		if err != nil {
+			return nil, err
 		}
-		tagSize := binary.LittleEndian.Uint16(word)
-		if tagID != 0x0013 {
-			in.Seek(int64(tagSize), os.SEEK_CUR)
-			continue
+		candidates := x.timeCandidates()
+		if len(candidates) == 0 {
+			return nil, &ErrNoOriginalTime{"no date in Exif"}
 		}
-
-		tagData := make([]byte, tagSize)
-		if _, err = in.Read(tagData); err != nil {
-			return
+		return candidates, nil
+	case MediaPNG:
+		png, err := m.parsedPNG()
+		if err != nil {
+			return nil, err
 		}
-		return parseTime(string(tagData))
+		return png.timeCandidates()
+	case MediaAVI:
+		return aviTimeCandidates(m.reader())
+	case MediaMPEGTS:
+		return mtsTimeCandidates(m.reader())
+	case MediaMatroska, MediaWebM:
+		return matroskaTimeCandidates(m.reader())
+	case MediaMP3:
+		return id3TimeCandidates(m.reader())
+	case MediaFLAC:
+		return flacTimeCandidates(m.reader())
+	case MediaOgg:
+		return oggTimeCandidates(m.reader())
+	case MediaWAV:
+		return wavTimeCandidates(m.reader())
+	case MediaPDF:
+		return pdfTimeCandidates(m.reader())
+	case MediaDOCX, MediaXLSX, MediaPPTX:
+		return ooxmlTimeCandidates(m.ra, m.size)
+	default:
+		return nil, &ErrNoOriginalTime{"unsupported file type"}
 	}
 }
 
-func guessTimeFromFilename(p string) (time.Time, error) {
-	// fmt.Printf("guessTimeFromFilename: %s\n", p)
-	name := path.Base(p)
-
-	// Try parse time
-	var digits bytes.Buffer
-	for _, c := range name {
-		if c >= '0' && c <= '9' && digits.Len() < 14 {
-			digits.WriteRune(c)
-		}
-	}
-
-	if digits.Len() < 8 {
-		return time.Time{}, &ErrNoOriginalTime{}
-	}
-	s := digits.String()
-
-	layout := "20060102150405"
-	if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
-		return t, err
-	}
-
-	// Try parse date
-	layout = "20060102"
-	if t, err := time.ParseInLocation(layout, s[:8], time.Local); err == nil {
-		return t, err
-	}
-
-	// Try timestamp
-	digits.Reset()
-	// Read a continuous of digits
-	started := false
-	for _, c := range name {
-		if c >= '0' && c <= '9' && digits.Len() < 14 {
-			started = true
-			digits.WriteRune(c)
-		} else {
-			if started {
-				break
-			}
+// modificationTimes returns the times of the last modification recorded in
+// the metadata of m. They are no original times and rank after the file
+// name.
+func (m *mediaReader) modificationTimes() []TimeCandidate {
+	switch m.typ {
+	case MediaPNG:
+		if png, err := m.parsedPNG(); err == nil && !png.modTime.IsZero() {
+			return []TimeCandidate{{png.modTime, SourceModified, "tIME"}}
 		}
 	}
+	return nil
+}
 
-	// timestamp of 1980.1.1 is 315504000000.0 ms
-	if digits.Len() < 12 {
-		return time.Time{}, &ErrNoOriginalTime{}
-	}
-	s = digits.String()
+// func imageOriginalTime(p string) (time.Time, error) {
+// 	f, err := os.Open(p)
+// 	if err != nil {
+// 		return time.Time{}, err
+// 	}
 
-	timestamp, err := strconv.ParseUint(s, 10, 64)
-	if err != nil {
-		return time.Time{}, &ErrNoOriginalTime{}
-	}
-	originalTime := time.Unix(int64(timestamp/1000.0), int64(timestamp%1000*1000*1000))
-	return originalTime, nil
-}
+// 	x, err := exif.Decode(f)
+// 	if err != nil {
+// 		return guessTimeFromFilename(p)
+// 	}
+// 	if t, err := x.DateTime(); err == nil {
+// 		return t, err
+// 	} else {
+// 		return guessTimeFromFilename(p)
+// 	}
+// }
 
 // ExtractExifDateTime extract Exif date time from the reader r
 // `exiftool -htmlDump /path/to/file` is very usefull
+// r does not need to implement io.Seeker, see DecodeExif.
 func ExtractExifDateTime(r io.Reader) (time.Time, error) {
-	head := make([]byte, 2)
-	n, err := r.Read(head)
+	x, err := DecodeExif(r)
 	if err != nil {
 		return zeroTime, err
 	}
-	if n < len(head) {
-		return zeroTime, errors.New("invalid image file: header too short")
-	}
+	return x.OriginalTime()
+}
 
-	switch string(head) {
-	case "\xFF\xD8":
-		return handleJPG(r)
-	case "II", "MM":
-		s := r.(io.Seeker)
-		s.Seek(-2, io.SeekCurrent)
-		return parseTIFF(r, 0)
-	default:
-		// fmt.Fprintf(os.Stderr, "%x\n", head)
-		return zeroTime, errors.New("header error")
+func handleJPG(r io.Reader) (*Exif, error) {
+	app1, err := readJPEGAPP1(r)
+	if err != nil {
+		return nil, err
+	}
+	if app1.exif == nil {
+		return nil, errors.New("exif: failed to find exif intro marker")
 	}
+	return parseTIFF(bytes.NewReader(app1.exif), 0)
 }
 
-func handleJPG(r io.Reader) (time.Time, error) {
+const (
+	exifMarker = "Exif\x00\x00"
+	xmpMarker  = "http://ns.adobe.com/xap/1.0/\x00"
+)
+
+// jpegAPP1 holds the payloads of the Exif and XMP APP1 segments of a JPEG.
+type jpegAPP1 struct {
+	exif []byte // TIFF stream following the Exif marker
+	xmp  []byte // XMP packet following the XMP marker
+}
 
+// readJPEGAPP1 reads the APP1 segments of the JPEG stream r, positioned
+// right after the SOI marker, until the start of the image data.
+func readJPEGAPP1(r io.Reader) (*jpegAPP1, error) {
+	app1 := &jpegAPP1{}
 	marker := make([]byte, 2)
-	for {
-		n, err := r.Read(marker)
+	for app1.exif == nil || app1.xmp == nil {
+		n, err := io.ReadFull(r, marker)
 		if err != nil {
-			return zeroTime, err
+			if app1.exif != nil || app1.xmp != nil {
+				break
+			}
+			return nil, err
+		}
+		if n < len(marker) || marker[0] != 0xFF {
+			return nil, formatError("jpeg", -1, "bad marker")
 		}
-		if n < len(marker) {
-			return zeroTime, errors.New("invalid image file: header too short")
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			// start of scan or end of image
+			break
 		}
 
 		// Extract app1 size
 		var size uint16
 		err = binary.Read(r, binary.BigEndian, &size)
 		if err != nil {
-			return zeroTime, err
+			return nil, truncatedError("jpeg", -1)
+		}
+		if size < 2 {
+			return nil, formatError("jpeg", -1, "bad segment size")
 		}
 
-		switch string(marker) {
-		case "\xFF\xE1":
-			// Found App1
-			app1Data := make([]byte, size-2)
-			n, err = io.ReadFull(r, app1Data)
-			if err != nil {
-				return zeroTime, errors.New("exif: no enough app1 data")
-			}
-			app1Reader := bytes.NewReader(app1Data)
-
-			// read/check for exif special mark
-			const EXIF_MARKER = "Exif\x00\x00"
-			exif := make([]byte, len(EXIF_MARKER))
-			n, err = io.ReadFull(app1Reader, exif)
-			if err != nil {
-				return zeroTime, errors.New("exif: failed to find exif intro marker")
-			}
-
-			if !bytes.Equal(exif, []byte(EXIF_MARKER)) {
-				return zeroTime, errors.New("exif: failed to find exif intro marker")
+		if marker[1] != 0xE1 {
+			// skip this APP data
+			if err := skipBytes(r, int64(size)-2); err != nil {
+				return nil, err
 			}
+			continue
+		}
 
-			return parseTIFF(app1Reader, int64(len(EXIF_MARKER)))
-		default:
-			// skip this APP data
-			s := r.(io.Seeker)
-			s.Seek(int64(size)-2, os.SEEK_CUR)
+		// Found App1
+		app1Data := make([]byte, size-2)
+		if _, err = io.ReadFull(r, app1Data); err != nil {
+			return nil, truncatedError("jpeg", -1)
+		}
+		switch {
+		case app1.exif == nil && bytes.HasPrefix(app1Data, []byte(exifMarker)):
+			app1.exif = app1Data[len(exifMarker):]
+		case app1.xmp == nil && bytes.HasPrefix(app1Data, []byte(xmpMarker)):
+			app1.xmp = app1Data[len(xmpMarker):]
 		}
 	}
+	return app1, nil
 }
 
-func parseTIFF(app1Reader io.Reader, headerOffset int64) (time.Time, error) {
+// skipBytes skips n bytes of r, seeking when possible.
+func skipBytes(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekCurrent)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
+
+// subIFDs maps the pointer tags to the IFDs they point to.
+var subIFDs = map[uint16]IFD{
+	0x8769: ExifIFD,
+	0x8825: GPSIFD,
+	0xa005: InteropIFD,
+}
+
+// maxTagValueSize limits the size of tag values loaded into memory; larger
+// values only have their offset recorded.
+const maxTagValueSize = 1 << 20
+
+// Limits of a TIFF stream: values beyond maxTIFFValueBytes only have their
+// offset recorded, more tags or deeper IFDs are rejected.
+const (
+	maxTIFFValueBytes = 64 << 20
+	maxTIFFTags       = 1 << 16
+	maxIFDDepth       = 8
+)
+
+type tiffReader struct {
+	r            io.ReadSeeker
+	size         int64 // size of the stream r
+	endian       binary.ByteOrder
+	headerOffset int64
+	visited      map[int64]bool
+	exif         *Exif
+
+	depth  int   // nesting of the IFD being read
+	tags   int   // number of tags read
+	loaded int64 // bytes of tag values loaded
+}
+
+// parseTIFF decodes the TIFF stream starting at headerOffset in app1Reader,
+// which must be positioned at headerOffset. IFD0, IFD1 and their sub-IFDs
+// are visited.
+func parseTIFF(app1Reader io.ReadSeeker, headerOffset int64) (*Exif, error) {
 
 	tiff := make([]byte, 4)
 	_, err := io.ReadFull(app1Reader, tiff)
 	if err != nil {
-		return zeroTime, errors.New("exif: failed to find tiff")
+		return nil, truncatedError("exif", headerOffset)
 	}
 	isLittleEndian := false
 	switch string(tiff) {
-	case "II*\x00":
-		// TIFF - Little endian (Intel)
+	case "II*\x00", "IIRO", "IIRS", "IIU\x00":
+		// TIFF - Little endian (Intel), Olympus ORF and Panasonic RW2
 		isLittleEndian = true
-	case "MM\x00*":
-		// TIFF - Big endian (Motorola)
+	case "MM\x00*", "MMOR":
+		// TIFF - Big endian (Motorola), Olympus ORF
 	default:
 		// Not TIFF, assume JPEG
-		return zeroTime, errors.New("is not tiff")
+		return nil, formatError("exif", headerOffset, "is not tiff")
 	}
 
 	var endian binary.ByteOrder
@@ -410,61 +340,122 @@ func parseTIFF(app1Reader io.Reader, headerOffset int64) (time.Time, error) {
 		endian = binary.BigEndian
 	}
 
-	var offset int32
+	var offset uint32
+	err = binary.Read(app1Reader, endian, &offset)
+	if err != nil {
+		return nil, truncatedError("exif", headerOffset+4)
+	}
+	size, err := streamSize(app1Reader)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		err = binary.Read(app1Reader, endian, &offset)
+	t := &tiffReader{
+		r:            app1Reader,
+		size:         size,
+		endian:       endian,
+		headerOffset: headerOffset,
+		visited:      make(map[int64]bool),
+		exif:         newExif(endian),
+	}
+	for ifd := IFD0; offset != 0 && ifd <= IFD1; ifd++ {
+		// fmt.Printf("offset: %04x\n", offset)
+		next, err := t.parseDirEntry(int64(offset), ifd)
 		if err != nil {
-			return zeroTime, errors.New("exif: no next IFD offset")
-		}
-		if offset == 0 {
-			return zeroTime, errors.New("no time found")
+			if ifd == IFD0 {
+				return nil, err
+			}
+			break
 		}
-
-		// fmt.Printf("offset: %04x\n", offset)
-
-		s := app1Reader.(io.Seeker)
-		s.Seek(headerOffset, io.SeekStart)
-		s.Seek(int64(offset), io.SeekCurrent)
-
-		return parseDirEntry(app1Reader, endian, headerOffset)
+		offset = next
 	}
-
+	t.parseMakerNote()
+	t.exif.decode()
+	return t.exif, nil
 }
 
-func parseDirEntry(app1Reader io.Reader, endian binary.ByteOrder, headerOffset int64) (time.Time, error) {
-	var dirEntryCount int16
-	binary.Read(app1Reader, endian, &dirEntryCount)
-	// fmt.Printf("dirEntryCount: %d\n", dirEntryCount)
-	s := app1Reader.(io.Seeker)
-
-	for i := 0; i < int(dirEntryCount); i++ {
-		var tag, dtype uint16
-		var length, valueOffset uint32
-		binary.Read(app1Reader, endian, &tag)
-		binary.Read(app1Reader, endian, &dtype)
-		binary.Read(app1Reader, endian, &length)
-		binary.Read(app1Reader, endian, &valueOffset)
-		// fmt.Printf("tag: %04x valueOffset: %04x\n", tag, valueOffset)
-		switch tag {
-		case 0x0132, 0x9003:
-			s.Seek(headerOffset, io.SeekStart)
-			s.Seek(int64(valueOffset), io.SeekCurrent)
-			timeData := make([]byte, length)
-			_, err := io.ReadFull(app1Reader, timeData)
-			if err != nil {
-				return zeroTime, err
+// parseDirEntry reads the IFD at ifdOffset (relative to the TIFF header),
+// stores its entries as ifd and follows sub-IFD pointers. It returns the
+// offset of the next IFD.
+func (t *tiffReader) parseDirEntry(ifdOffset int64, ifd IFD) (uint32, error) {
+	if t.visited[ifdOffset] {
+		return 0, formatError("exif", ifdOffset, "IFD loop")
+	}
+	t.visited[ifdOffset] = true
+	if t.depth >= maxIFDDepth {
+		return 0, limitError("exif", ifdOffset, "IFD nesting")
+	}
+
+	start := t.headerOffset + ifdOffset
+	head, err := t.read(start, 2)
+	if err != nil {
+		return 0, err
+	}
+	dirEntryCount := int(t.endian.Uint16(head))
+	if t.tags += dirEntryCount; t.tags > maxTIFFTags {
+		return 0, limitError("exif", ifdOffset, "too many tags")
+	}
+	entries, err := t.read(start+2, 12*dirEntryCount+4)
+	if err != nil {
+		return 0, err
+	}
+	next := t.endian.Uint32(entries[len(entries)-4:])
+
+	var subs []*Tag
+	for i := 0; i < dirEntryCount; i++ {
+		e := entries[12*i : 12*i+12]
+		tag := &Tag{
+			ID:    t.endian.Uint16(e[0:2]),
+			Type:  t.endian.Uint16(e[2:4]),
+			Count: t.endian.Uint32(e[4:8]),
+			order: t.endian,
+		}
+		// fmt.Printf("tag: %04x valueOffset: %04x\n", tag.ID, t.endian.Uint32(e[8:12]))
+		size := tag.size()
+		if size < 0 {
+			// unknown type
+			continue
+		}
+		if size <= 4 {
+			tag.Offset = ifdOffset + 2 + 12*int64(i) + 8
+			tag.Value = append([]byte(nil), e[8:8+size]...)
+		} else {
+			tag.Offset = int64(t.endian.Uint32(e[8:12]))
+			if size <= maxTagValueSize && t.loaded+size <= maxTIFFValueBytes {
+				value, err := t.read(t.headerOffset+tag.Offset, int(size))
+				if err != nil {
+					continue
+				}
+				t.loaded += size
+				tag.Value = value
 			}
-			return parseTime(string(timeData))
-		case 0x8769:
-			// EXIF offset
-			s.Seek(headerOffset, io.SeekStart)
-			s.Seek(int64(valueOffset), io.SeekCurrent)
-			return parseDirEntry(app1Reader, endian, headerOffset)
+		}
+		t.exif.Tags[TagKey{ifd, tag.ID}] = tag
+		if _, ok := subIFDs[tag.ID]; ok && ifd != MakerNoteIFD {
+			subs = append(subs, tag)
 		}
 	}
 
-	return zeroTime, errors.New("no time found")
+	t.depth++
+	defer func() { t.depth-- }()
+	for _, tag := range subs {
+		offset, err := tag.Int(0)
+		if err != nil || offset == 0 {
+			continue
+		}
+		// a broken sub-IFD does not invalidate the rest of the data
+		t.parseDirEntry(offset, subIFDs[tag.ID])
+	}
+	return next, nil
+}
+
+// read reads n bytes at offset of the stream, checking the range before
+// allocating.
+func (t *tiffReader) read(offset int64, n int) ([]byte, error) {
+	if offset < 0 || offset+int64(n) > t.size {
+		return nil, truncatedError("exif", offset-t.headerOffset)
+	}
+	return readAt(t.r, offset, n)
 }
 
 func parseTime(name string) (time.Time, error) {
@@ -488,3 +479,29 @@ func parseTime(name string) (time.Time, error) {
 	}
 	return t, nil
 }
+
+var isoTimeLayouts = []string{
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04-0700",
+	"2006-01-02T15:04Z07:00",
+}
+
+// parseISOTime parses an ISO 8601 date time. Times without a zone are
+// interpreted in time.Local.
+func parseISOTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range isoTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return zeroTime, fmt.Errorf("invalid ISO 8601 time %q", s)
+}
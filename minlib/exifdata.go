@@ -0,0 +1,518 @@
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"strings"
+	"time"
+)
+
+// Exif tags: https://exiftool.org/TagNames/EXIF.html
+
+// IFD identifies the image file directory a tag was read from.
+type IFD int
+
+const (
+	IFD0 IFD = iota
+	IFD1
+	ExifIFD
+	GPSIFD
+	InteropIFD
+	// MakerNoteIFD holds the tags of the vendor MakerNote (0x927c), see
+	// makernote.go.
+	MakerNoteIFD
+)
+
+func (ifd IFD) String() string {
+	switch ifd {
+	case IFD0:
+		return "IFD0"
+	case IFD1:
+		return "IFD1"
+	case ExifIFD:
+		return "ExifIFD"
+	case GPSIFD:
+		return "GPSIFD"
+	case InteropIFD:
+		return "InteropIFD"
+	case MakerNoteIFD:
+		return "MakerNoteIFD"
+	}
+	return fmt.Sprintf("IFD(%d)", int(ifd))
+}
+
+// TagKey identifies a tag by its IFD and tag ID.
+type TagKey struct {
+	IFD IFD
+	ID  uint16
+}
+
+// TIFF field types
+const (
+	TypeByte      = 1
+	TypeASCII     = 2
+	TypeShort     = 3
+	TypeLong      = 4
+	TypeRational  = 5
+	TypeSByte     = 6
+	TypeUndefined = 7
+	TypeSShort    = 8
+	TypeSLong     = 9
+	TypeSRational = 10
+	TypeFloat     = 11
+	TypeDouble    = 12
+	TypeIFD       = 13
+)
+
+var tiffTypeSizes = [...]int64{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4}
+
+// Tag is a raw IFD entry.
+type Tag struct {
+	ID    uint16
+	Type  uint16
+	Count uint32
+	// Offset is the position of the value relative to the TIFF header.
+	Offset int64
+	// Value holds the raw value bytes in the byte order of the file. It is
+	// nil when the value is too large to be loaded.
+	Value []byte
+
+	order binary.ByteOrder
+}
+
+// size returns the size of the value in bytes, or -1 for unknown types.
+func (t *Tag) size() int64 {
+	if int(t.Type) >= len(tiffTypeSizes) || t.Type == 0 {
+		return -1
+	}
+	return tiffTypeSizes[t.Type] * int64(t.Count)
+}
+
+var errTagValue = errors.New("exif: tag value out of range or of wrong type")
+
+// Int returns the i-th value of an integer tag.
+func (t *Tag) Int(i int) (int64, error) {
+	if i < 0 || int64(i) >= int64(t.Count) || int64(len(t.Value)) < t.size() {
+		return 0, errTagValue
+	}
+	v := t.Value
+	switch t.Type {
+	case TypeByte, TypeUndefined:
+		return int64(v[i]), nil
+	case TypeSByte:
+		return int64(int8(v[i])), nil
+	case TypeShort:
+		return int64(t.order.Uint16(v[2*i:])), nil
+	case TypeSShort:
+		return int64(int16(t.order.Uint16(v[2*i:]))), nil
+	case TypeLong, TypeIFD:
+		return int64(t.order.Uint32(v[4*i:])), nil
+	case TypeSLong:
+		return int64(int32(t.order.Uint32(v[4*i:]))), nil
+	}
+	return 0, errTagValue
+}
+
+// Rat returns the i-th value of a rational tag.
+func (t *Tag) Rat(i int) (Rational, error) {
+	if i < 0 || int64(i) >= int64(t.Count) || int64(len(t.Value)) < t.size() {
+		return Rational{}, errTagValue
+	}
+	v := t.Value[8*i:]
+	switch t.Type {
+	case TypeRational:
+		return Rational{int64(t.order.Uint32(v)), int64(t.order.Uint32(v[4:]))}, nil
+	case TypeSRational:
+		return Rational{int64(int32(t.order.Uint32(v))), int64(int32(t.order.Uint32(v[4:])))}, nil
+	}
+	return Rational{}, errTagValue
+}
+
+// Float returns the i-th value of a numeric tag as a float64.
+func (t *Tag) Float(i int) (float64, error) {
+	switch t.Type {
+	case TypeRational, TypeSRational:
+		r, err := t.Rat(i)
+		if err != nil {
+			return 0, err
+		}
+		return r.Float(), nil
+	case TypeFloat:
+		if i < 0 || len(t.Value) < 4*(i+1) {
+			return 0, errTagValue
+		}
+		return float64(math.Float32frombits(t.order.Uint32(t.Value[4*i:]))), nil
+	case TypeDouble:
+		if i < 0 || len(t.Value) < 8*(i+1) {
+			return 0, errTagValue
+		}
+		return math.Float64frombits(t.order.Uint64(t.Value[8*i:])), nil
+	}
+	v, err := t.Int(i)
+	return float64(v), err
+}
+
+// String returns the text of an ASCII tag, or the values of other tags
+// separated by spaces.
+func (t *Tag) String() string {
+	switch t.Type {
+	case TypeASCII:
+		s := string(t.Value)
+		if i := strings.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		return strings.TrimSpace(s)
+	case TypeUndefined:
+		return fmt.Sprintf("%x", t.Value)
+	}
+	var values []string
+	for i := 0; i < int(t.Count) && i < 64; i++ {
+		switch t.Type {
+		case TypeRational, TypeSRational:
+			r, err := t.Rat(i)
+			if err != nil {
+				return strings.Join(values, " ")
+			}
+			values = append(values, r.String())
+		default:
+			f, err := t.Float(i)
+			if err != nil {
+				return strings.Join(values, " ")
+			}
+			values = append(values, fmt.Sprint(f))
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+// Rational is a TIFF rational number.
+type Rational struct {
+	Num, Den int64
+}
+
+// Float returns r as a float64, or 0 if the denominator is 0.
+func (r Rational) Float() float64 {
+	if r.Den == 0 {
+		return 0
+	}
+	return float64(r.Num) / float64(r.Den)
+}
+
+func (r Rational) String() string {
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// Exif is the decoded Exif metadata of an image.
+type Exif struct {
+	Make         string
+	Model        string
+	LensModel    string
+	Orientation  int
+	ExposureTime Rational
+	FNumber      float64
+	ISO          int
+	FocalLength  float64
+	Width        int
+	Height       int
+
+	// SerialNumber, ShutterCount (0 if unknown) and Lens are read from the
+	// Exif IFD and completed by the Nikon, Canon or Sony MakerNote. The
+	// ShutterCount is read from Nikon and Sony files; Canon does not record
+	// it in a documented tag, so Canon files always report 0.
+	SerialNumber string
+	ShutterCount int
+	Lens         LensInfo
+
+	// ContentIdentifier links the still image of an Apple Live Photo to its
+	// video, read from the Apple MakerNote.
+	ContentIdentifier string
+
+	// Dates include sub-seconds and carry the zone of their OffsetTime tag,
+	// or the zone derived from the GPS time, or time.Local.
+	DateTime          time.Time // ModifyDate, 0x0132
+	DateTimeOriginal  time.Time // 0x9003
+	DateTimeDigitized time.Time // CreateDate, 0x9004
+
+	// GPS is nil when the image has no GPS IFD.
+	GPS *GPSInfo
+
+	ByteOrder binary.ByteOrder
+	Tags      map[TagKey]*Tag
+}
+
+func newExif(order binary.ByteOrder) *Exif {
+	return &Exif{
+		ByteOrder: order,
+		Tags:      make(map[TagKey]*Tag),
+	}
+}
+
+// Tag returns the tag id of ifd, or nil if it is not present.
+func (x *Exif) Tag(ifd IFD, id uint16) *Tag {
+	return x.Tags[TagKey{ifd, id}]
+}
+
+func (x *Exif) str(ifd IFD, id uint16) string {
+	if t := x.Tag(ifd, id); t != nil {
+		return t.String()
+	}
+	return ""
+}
+
+func (x *Exif) int(ifd IFD, id uint16) int {
+	if t := x.Tag(ifd, id); t != nil {
+		if v, err := t.Int(0); err == nil {
+			return int(v)
+		}
+	}
+	return 0
+}
+
+func (x *Exif) float(ifd IFD, id uint16) float64 {
+	if t := x.Tag(ifd, id); t != nil {
+		if v, err := t.Float(0); err == nil {
+			return v
+		}
+	}
+	return 0
+}
+
+// time decodes the date tag id of ifd together with its SubSecTime and
+// OffsetTime companions in the Exif IFD. Without an offset the zone is
+// derived from the GPS time, or time.Local is assumed.
+func (x *Exif) time(ifd IFD, id, subSecID, offsetID uint16) time.Time {
+	s := x.str(ifd, id)
+	if s == "" || strings.HasPrefix(s, "0000") {
+		return zeroTime
+	}
+	t, err := parseTime(s)
+	if err != nil {
+		return zeroTime
+	}
+	t = t.Add(parseSubSec(x.str(ExifIFD, subSecID)))
+
+	if loc, ok := parseTimeOffset(x.str(ExifIFD, offsetID)); ok {
+		return inLocation(t, loc)
+	}
+	if x.GPS != nil && !x.GPS.Time.IsZero() {
+		if loc, ok := gpsLocation(t, x.GPS.Time); ok {
+			return inLocation(t, loc)
+		}
+	}
+	return t
+}
+
+// inLocation returns the time with the same wall clock as t in loc.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// parseSubSec parses the digits of a SubSecTime tag as a decimal fraction
+// of a second.
+func parseSubSec(s string) time.Duration {
+	var d time.Duration
+	scale := time.Second
+	for _, c := range strings.TrimSpace(s) {
+		if c < '0' || c > '9' {
+			break
+		}
+		scale /= 10
+		d += time.Duration(c-'0') * scale
+	}
+	return d
+}
+
+// parseTimeOffset parses an OffsetTime tag such as "+08:00" or "-05:30".
+func parseTimeOffset(s string) (*time.Location, bool) {
+	s = strings.TrimSpace(s)
+	if s == "Z" {
+		return time.UTC, true
+	}
+	t, err := time.Parse("-07:00", s)
+	if err != nil {
+		return nil, false
+	}
+	_, offset := t.Zone()
+	return time.FixedZone("", offset), true
+}
+
+// gpsLocation derives the zone of the local wall clock t from the UTC GPS
+// time, rounding the difference to a quarter of an hour. Clocks further
+// apart than any real zone are rejected.
+func gpsLocation(t, gps time.Time) (*time.Location, bool) {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	diff := wall.Sub(gps).Round(15 * time.Minute)
+	if diff < -12*time.Hour || diff > 14*time.Hour {
+		return nil, false
+	}
+	return time.FixedZone("", int(diff/time.Second)), true
+}
+
+// decode fills the fields of x from its tags.
+func (x *Exif) decode() {
+	x.Make = x.str(IFD0, 0x010f)
+	x.Model = x.str(IFD0, 0x0110)
+	x.LensModel = x.str(ExifIFD, 0xa434)
+	x.Orientation = x.int(IFD0, 0x0112)
+	if t := x.Tag(ExifIFD, 0x829a); t != nil {
+		x.ExposureTime, _ = t.Rat(0)
+	}
+	x.FNumber = x.float(ExifIFD, 0x829d)
+	x.ISO = x.int(ExifIFD, 0x8827)
+	x.FocalLength = x.float(ExifIFD, 0x920a)
+
+	x.Width, x.Height = x.int(ExifIFD, 0xa002), x.int(ExifIFD, 0xa003)
+	if x.Width == 0 || x.Height == 0 {
+		x.Width, x.Height = x.int(IFD0, 0x0100), x.int(IFD0, 0x0101)
+	}
+
+	x.GPS = x.decodeGPS()
+
+	x.DateTime = x.time(IFD0, 0x0132, 0x9290, 0x9010)
+	x.DateTimeOriginal = x.time(ExifIFD, 0x9003, 0x9291, 0x9011)
+	x.DateTimeDigitized = x.time(ExifIFD, 0x9004, 0x9292, 0x9012)
+
+	x.decodeCameraInfo()
+}
+
+// OriginalTime returns DateTimeOriginal, falling back to DateTimeDigitized
+// and DateTime.
+func (x *Exif) OriginalTime() (time.Time, error) {
+	candidates := x.timeCandidates()
+	if len(candidates) == 0 {
+		return zeroTime, errors.New("no time found")
+	}
+	return candidates[0].Time, nil
+}
+
+func (x *Exif) timeCandidates() []TimeCandidate {
+	var candidates []TimeCandidate
+	for _, c := range []TimeCandidate{
+		{x.DateTimeOriginal, SourceExif, "DateTimeOriginal"},
+		{x.DateTimeDigitized, SourceExif, "DateTimeDigitized"},
+		{x.DateTime, SourceExif, "DateTime"},
+	} {
+		if !c.Time.IsZero() {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// DecodeExif decodes the Exif metadata of a JPEG or TIFF stream. TIFF
+// streams are read into memory when r does not implement io.Seeker.
+func DecodeExif(r io.Reader) (*Exif, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("invalid image file: header too short")
+		}
+		return nil, err
+	}
+
+	switch string(head) {
+	case "\xFF\xD8":
+		return handleJPG(r)
+	case "II", "MM":
+		s, ok := r.(io.ReadSeeker)
+		if !ok {
+			// IFD offsets may point anywhere in the stream
+			data, err := io.ReadAll(io.LimitReader(r, maxBufferedFileSize))
+			if err != nil {
+				return nil, err
+			}
+			return parseTIFF(bytes.NewReader(append(head, data...)), 0)
+		}
+		start, err := s.Seek(-2, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		return parseTIFF(s, start)
+	default:
+		// fmt.Fprintf(os.Stderr, "%x\n", head)
+		return nil, errors.New("header error")
+	}
+}
+
+// FileExif decodes the Exif metadata of the file p.
+func FileExif(p string) (*Exif, error) {
+	return mediaExif(osFS{}, p)
+}
+
+// FSExif decodes the Exif metadata of the file name of fsys.
+func FSExif(fsys fs.FS, name string) (*Exif, error) {
+	return mediaExif(ioFS{fsys}, name)
+}
+
+// ReaderExif decodes the Exif metadata of the size bytes of r, which may
+// hold any of the formats supported by FileExif.
+func ReaderExif(r io.ReaderAt, size int64) (*Exif, error) {
+	m, err := newMediaReader(r, size, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.exif()
+}
+
+func mediaExif(fsys fileSystem, name string) (*Exif, error) {
+	m, err := openMedia(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return m.exif()
+}
+
+func (m *mediaReader) exif() (*Exif, error) {
+	r := m.reader()
+	switch m.typ {
+	case MediaHEIC, MediaHEIF, MediaAVIF:
+		tiff, err := extractHEIFExif(r)
+		if err != nil {
+			return nil, err
+		}
+		return parseTIFF(bytes.NewReader(tiff), 0)
+	case MediaPNG:
+		png, err := m.parsedPNG()
+		if err != nil {
+			return nil, err
+		}
+		return decodeExifChunk(png.exif)
+	case MediaWebP:
+		webp, err := parseWebP(r)
+		if err != nil {
+			return nil, err
+		}
+		return decodeExifChunk(webp.exif)
+	case MediaCR3:
+		return cr3Exif(r)
+	case MediaRAF:
+		return rafExif(r)
+	case MediaAVI:
+		avi, err := parseAVI(r)
+		if err != nil {
+			return nil, err
+		}
+		if avi.strd == nil {
+			return nil, errors.New("no Exif in AVI stream data")
+		}
+		return avi.strd, nil
+	default:
+		x, err := DecodeExif(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := x.OriginalTime(); err != nil {
+			// Panasonic RW2 keeps the full Exif in the embedded JpgFromRaw
+			if t := x.Tag(IFD0, 0x002e); t != nil {
+				return embeddedJPEGExif(r, t.Offset, int64(t.Count))
+			}
+		}
+		return x, nil
+	}
+}
@@ -0,0 +1,132 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func testCameraTIFF(order binary.ByteOrder) []byte {
+	return buildTIFF(order, &tiffIFD{
+		entries: []tiffEntry{
+			asciiTag(0x010f, "NIKON CORPORATION"),
+			asciiTag(0x0110, "NIKON D750"),
+			shortTag(order, 0x0112, 6),
+			asciiTag(0x0132, "2019:01:02 03:04:05"),
+		},
+		subs: map[uint16]*tiffIFD{
+			0x8769: {entries: []tiffEntry{
+				rationalTag(order, 0x829a, 1, 250),
+				rationalTag(order, 0x829d, 28, 10),
+				shortTag(order, 0x8827, 400),
+				asciiTag(0x9003, "2019:01:01 10:11:12"),
+				asciiTag(0x9004, "2019:01:01 10:11:13"),
+				rationalTag(order, 0x920a, 500, 10),
+				longTag(order, 0xa002, 6016),
+				longTag(order, 0xa003, 4016),
+				asciiTag(0xa434, "50.0 mm f/1.8"),
+			}},
+		},
+		next: &tiffIFD{entries: []tiffEntry{shortTag(order, 0x0103, 6)}},
+	})
+}
+
+func TestDecodeExif(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		tiff := testCameraTIFF(order)
+		for _, data := range [][]byte{tiff, buildJPEG(jpegSegment(0xE0, []byte("JFIF\x00")), exifAPP1(tiff))} {
+			x, err := DecodeExif(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if x.Make != "NIKON CORPORATION" || x.Model != "NIKON D750" || x.LensModel != "50.0 mm f/1.8" {
+				t.Errorf("unexpected camera: %q %q %q", x.Make, x.Model, x.LensModel)
+			}
+			if x.Orientation != 6 || x.ISO != 400 || x.Width != 6016 || x.Height != 4016 {
+				t.Errorf("unexpected values: %+v", x)
+			}
+			if x.ExposureTime != (Rational{1, 250}) || x.FNumber != 2.8 || x.FocalLength != 50 {
+				t.Errorf("unexpected exposure: %v f/%v %vmm", x.ExposureTime, x.FNumber, x.FocalLength)
+			}
+			want := time.Date(2019, 1, 1, 10, 11, 12, 0, time.Local)
+			if got, err := x.OriginalTime(); err != nil || !got.Equal(want) {
+				t.Errorf("OriginalTime() = %v, %v; want %v", got, err, want)
+			}
+			if !x.DateTime.Equal(time.Date(2019, 1, 2, 3, 4, 5, 0, time.Local)) {
+				t.Errorf("unexpected DateTime %v", x.DateTime)
+			}
+			if tag := x.Tag(IFD1, 0x0103); tag == nil {
+				t.Error("IFD1 compression tag not found")
+			} else if v, _ := tag.Int(0); v != 6 {
+				t.Errorf("IFD1 compression = %d", v)
+			}
+			if x.Tag(ExifIFD, 0x8827) == nil || x.Tag(IFD0, 0x8827) != nil {
+				t.Error("ISO tag stored in the wrong IFD")
+			}
+		}
+	}
+}
+
+func TestDecodeExifIFDLoop(t *testing.T) {
+	order := binary.LittleEndian
+	tiff := buildTIFF(order, &tiffIFD{entries: []tiffEntry{asciiTag(0x0132, "2019:01:02 03:04:05")}})
+	// point the next IFD of IFD0 back to IFD0
+	ifd0 := order.Uint32(tiff[4:])
+	order.PutUint32(tiff[ifd0+2+12:], ifd0)
+
+	x, err := DecodeExif(bytes.NewReader(tiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x.OriginalTime(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExifTimeZone(t *testing.T) {
+	order := binary.LittleEndian
+	build := func(exif []tiffEntry, gps []tiffEntry) *Exif {
+		ifd := &tiffIFD{subs: map[uint16]*tiffIFD{0x8769: {entries: exif}}}
+		if gps != nil {
+			ifd.subs[0x8825] = &tiffIFD{entries: gps}
+		}
+		x, err := DecodeExif(bytes.NewReader(buildTIFF(order, ifd)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return x
+	}
+
+	// OffsetTimeOriginal and SubSecTimeOriginal
+	x := build([]tiffEntry{
+		asciiTag(0x9003, "2019:01:01 10:11:12"),
+		asciiTag(0x9011, "+05:30"),
+		asciiTag(0x9291, "042"),
+	}, nil)
+	want := time.Date(2019, 1, 1, 10, 11, 12, 42e6, time.FixedZone("", 5*3600+1800))
+	if !x.DateTimeOriginal.Equal(want) {
+		t.Errorf("got %v, want %v", x.DateTimeOriginal, want)
+	}
+	if _, offset := x.DateTimeOriginal.Zone(); offset != 5*3600+1800 {
+		t.Errorf("unexpected zone offset %d", offset)
+	}
+
+	// zone derived from the GPS time
+	x = build([]tiffEntry{asciiTag(0x9003, "2019:01:01 10:11:12")}, []tiffEntry{
+		rationalTag(order, 0x0007, 15, 1, 11, 1, 9, 1),
+		asciiTag(0x001d, "2019:01:01"),
+	})
+	if _, offset := x.DateTimeOriginal.Zone(); offset != -5*3600 {
+		t.Errorf("GPS derived offset = %d, want %d", offset, -5*3600)
+	}
+
+	// no offset at all
+	x = build([]tiffEntry{asciiTag(0x9003, "2019:01:01 10:11:12")}, nil)
+	if x.DateTimeOriginal.Location() != time.Local {
+		t.Errorf("expected local time, got %v", x.DateTimeOriginal)
+	}
+}
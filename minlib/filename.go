@@ -0,0 +1,162 @@
+package minlib
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FilenamePattern extracts a time from a file name.
+//
+// Without Parse, the time is built from the named groups of Regexp: Y, M
+// and D for the date, h, m, s, ms and ampm ("AM"/"PM") for the optional
+// time of day, or unixms for a Unix timestamp in milliseconds. Times are
+// interpreted in time.Local.
+type FilenamePattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+	Parse  func(match []string) (time.Time, error)
+}
+
+// FilenameMatch is a time found in a file name.
+type FilenameMatch struct {
+	Time    time.Time
+	Pattern string // name of the pattern that matched
+}
+
+var builtinFilenamePatterns = []FilenamePattern{
+	// IMG-20190101-WA0012.jpg
+	{Name: "whatsapp", Regexp: regexp.MustCompile(
+		`(?i)^(?:IMG|VID|AUD|PTT|DOC|STK)-(?P<Y>\d{4})(?P<M>\d{2})(?P<D>\d{2})-WA\d+`)},
+	// Screenshot 2021-03-04 at 10.11.12.png, Screen Shot 2019-01-01 at 1.02.03 PM.png
+	{Name: "ios-screenshot", Regexp: regexp.MustCompile(
+		`(?i)^Screen ?Shot (?P<Y>\d{4})-(?P<M>\d{2})-(?P<D>\d{2}) at (?P<h>\d{1,2})\.(?P<m>\d{2})\.(?P<s>\d{2})(?:\s*(?P<ampm>[AP]M))?`)},
+	// Screenshot_20210304-101112.png, Screenshot_2021-03-04-10-11-12-123_com.example.jpg
+	{Name: "android-screenshot", Regexp: regexp.MustCompile(
+		`(?i)^Screenshot_(?P<Y>\d{4})-?(?P<M>\d{2})-?(?P<D>\d{2})[-_](?P<h>\d{2})-?(?P<m>\d{2})-?(?P<s>\d{2})`)},
+	// IMG_20210304_101112.jpg, PXL_20210304_101112345.jpg
+	{Name: "android", Regexp: regexp.MustCompile(
+		`(?i)^(?:IMG|VID|PXL|MVIMG|PANO|BURST\d*)_(?P<Y>\d{4})(?P<M>\d{2})(?P<D>\d{2})_(?P<h>\d{2})(?P<m>\d{2})(?P<s>\d{2})(?P<ms>\d{3})?`)},
+	// signal-2021-03-04-101112.jpg, signal-2021-03-04-10-11-12-123.jpg
+	{Name: "signal", Regexp: regexp.MustCompile(
+		`(?i)^signal-(?P<Y>\d{4})-(?P<M>\d{2})-(?P<D>\d{2})-(?P<h>\d{2})-?(?P<m>\d{2})-?(?P<s>\d{2})(?:-(?P<ms>\d{3}))?`)},
+	// photo_2021-03-04_10-11-12.jpg
+	{Name: "telegram", Regexp: regexp.MustCompile(
+		`(?i)^(?:photo|video|file)_(?P<Y>\d{4})-(?P<M>\d{2})-(?P<D>\d{2})_(?P<h>\d{2})-(?P<m>\d{2})-(?P<s>\d{2})`)},
+	// 1614852672123.jpg
+	{Name: "unix-ms", Regexp: regexp.MustCompile(
+		`(?:^|\D)(?P<unixms>1\d{12})(?:\D|$)`)},
+	// 20210304_101112.jpg, 2021-03-04 10.11.12.jpg
+	{Name: "datetime", Regexp: regexp.MustCompile(
+		`(?:^|\D)(?P<Y>(?:19|20)\d{2})[-_.]?(?P<M>\d{2})[-_.]?(?P<D>\d{2})[-_ T.]?(?P<h>\d{2})[-_.:]?(?P<m>\d{2})[-_.:]?(?P<s>\d{2})(?:\D|$)`)},
+	// 20210304.jpg, 2021-03-04 party.jpg
+	{Name: "date", Regexp: regexp.MustCompile(
+		`(?:^|\D)(?P<Y>(?:19|20)\d{2})[-_.]?(?P<M>\d{2})[-_.]?(?P<D>\d{2})(?:\D|$)`)},
+}
+
+var (
+	filenamePatternsMu sync.RWMutex
+	filenamePatterns   []FilenamePattern
+)
+
+// RegisterFilenamePattern adds p to the patterns used to find times in file
+// names. Registered patterns are tried before the built-in ones, the most
+// recently registered first.
+func RegisterFilenamePattern(p FilenamePattern) {
+	filenamePatternsMu.Lock()
+	defer filenamePatternsMu.Unlock()
+	filenamePatterns = append([]FilenamePattern{p}, filenamePatterns...)
+}
+
+// earliestFilenameTime is the earliest plausible time found in a file name.
+var earliestFilenameTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// plausibleTime reports whether t can be the capture time of a file.
+func plausibleTime(t time.Time) bool {
+	return !t.Before(earliestFilenameTime) && t.Before(time.Now().Add(48*time.Hour))
+}
+
+// MatchFilenameTime returns the time found in the base name of p by the
+// first pattern yielding a plausible time.
+func MatchFilenameTime(p string) (*FilenameMatch, error) {
+	name := filepath.Base(p)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	filenamePatternsMu.RLock()
+	patterns := append(filenamePatterns[:len(filenamePatterns):len(filenamePatterns)], builtinFilenamePatterns...)
+	filenamePatternsMu.RUnlock()
+
+	for _, pattern := range patterns {
+		m := pattern.Regexp.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		var t time.Time
+		var err error
+		if pattern.Parse != nil {
+			t, err = pattern.Parse(m)
+		} else {
+			t, err = parseFilenameGroups(pattern.Regexp, m)
+		}
+		if err == nil && plausibleTime(t) {
+			return &FilenameMatch{Time: t, Pattern: pattern.Name}, nil
+		}
+	}
+	return nil, &ErrNoOriginalTime{}
+}
+
+// parseFilenameGroups builds a time from the named groups of re.
+func parseFilenameGroups(re *regexp.Regexp, m []string) (time.Time, error) {
+	groups := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" && m[i] != "" {
+			groups[name] = m[i]
+		}
+	}
+	num := func(name string) int {
+		v, _ := strconv.Atoi(groups[name])
+		return v
+	}
+
+	if s, ok := groups["unixms"]; ok {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return zeroTime, err
+		}
+		return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)), nil
+	}
+
+	year, month, day := num("Y"), num("M"), num("D")
+	hour, min, sec := num("h"), num("m"), num("s")
+	switch strings.ToUpper(groups["ampm"]) {
+	case "AM":
+		if hour == 12 {
+			hour = 0
+		}
+	case "PM":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || min > 59 || sec > 59 {
+		return zeroTime, errors.New("invalid date in file name")
+	}
+	t := time.Date(year, time.Month(month), day, hour, min, sec, num("ms")*int(time.Millisecond), time.Local)
+	if t.Day() != day {
+		// normalized, such as February 30
+		return zeroTime, errors.New("invalid date in file name")
+	}
+	return t, nil
+}
+
+func guessTimeFromFilename(p string) (time.Time, error) {
+	m, err := MatchFilenameTime(p)
+	if err != nil {
+		return zeroTime, err
+	}
+	return m.Time, nil
+}
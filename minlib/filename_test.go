@@ -0,0 +1,78 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMatchFilenameTime(t *testing.T) {
+	local := func(y, mo, d, h, mi, s, ms int) time.Time {
+		return time.Date(y, time.Month(mo), d, h, mi, s, ms*int(time.Millisecond), time.Local)
+	}
+	cases := []struct {
+		name    string
+		pattern string
+		want    time.Time
+	}{
+		{"IMG-20190101-WA0012.jpg", "whatsapp", local(2019, 1, 1, 0, 0, 0, 0)},
+		{"Screenshot 2021-03-04 at 10.11.12.png", "ios-screenshot", local(2021, 3, 4, 10, 11, 12, 0)},
+		{"Screen Shot 2019-01-01 at 1.02.03 PM.png", "ios-screenshot", local(2019, 1, 1, 13, 2, 3, 0)},
+		{"Screenshot_20210304-101112.png", "android-screenshot", local(2021, 3, 4, 10, 11, 12, 0)},
+		{"PXL_20210304_101112345.jpg", "android", local(2021, 3, 4, 10, 11, 12, 345)},
+		{"IMG_20210304_101112.jpg", "android", local(2021, 3, 4, 10, 11, 12, 0)},
+		{"signal-2021-03-04-101112.jpg", "signal", local(2021, 3, 4, 10, 11, 12, 0)},
+		{"photo_2021-03-04_10-11-12.jpg", "telegram", local(2021, 3, 4, 10, 11, 12, 0)},
+		{"1614852672123.jpg", "unix-ms", time.Unix(1614852672, 123e6)},
+		{"2021-03-04 10.11.12.jpg", "datetime", local(2021, 3, 4, 10, 11, 12, 0)},
+		{"20160120-030700.mov", "datetime", local(2016, 1, 20, 3, 7, 0, 0)},
+		{"party 2021-03-04.jpg", "date", local(2021, 3, 4, 0, 0, 0, 0)},
+	}
+	for _, c := range cases {
+		m, err := MatchFilenameTime("/photos/" + c.name)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if m.Pattern != c.pattern || !m.Time.Equal(c.want) {
+			t.Errorf("%s: got %v (%s), want %v (%s)", c.name, m.Time, m.Pattern, c.want, c.pattern)
+		}
+	}
+
+	for _, name := range []string{"DSC_0001 2019.jpg", "IMG_1234.jpg", "20211399_101112.jpg", "29991231.jpg"} {
+		if m, err := MatchFilenameTime(name); err == nil {
+			t.Errorf("%s: unexpected match %v (%s)", name, m.Time, m.Pattern)
+		}
+	}
+}
+
+func TestRegisterFilenamePattern(t *testing.T) {
+	filenamePatternsMu.RLock()
+	saved := filenamePatterns
+	filenamePatternsMu.RUnlock()
+	t.Cleanup(func() {
+		filenamePatternsMu.Lock()
+		filenamePatterns = saved
+		filenamePatternsMu.Unlock()
+	})
+
+	RegisterFilenamePattern(FilenamePattern{
+		Name:   "test-unix-seconds",
+		Regexp: regexp.MustCompile(`^cam-(\d{10})$`),
+		Parse: func(m []string) (time.Time, error) {
+			secs, err := strconv.ParseInt(m[1], 10, 64)
+			return time.Unix(secs, 0), err
+		},
+	})
+	m, err := MatchFilenameTime("cam-1614852672.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Pattern != "test-unix-seconds" || !m.Time.Equal(time.Unix(1614852672, 0)) {
+		t.Errorf("got %v (%s)", m.Time, m.Pattern)
+	}
+}
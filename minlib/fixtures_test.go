@@ -0,0 +1,192 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Builders for synthetic media files used by the tests.
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	raw   []byte // value bytes, already in the byte order of the file
+}
+
+type tiffIFD struct {
+	entries []tiffEntry
+	subs    map[uint16]*tiffIFD // sub-IFD pointer tag -> IFD
+	next    *tiffIFD
+}
+
+func asciiTag(tag uint16, s string) tiffEntry {
+	raw := append([]byte(s), 0)
+	return tiffEntry{tag, 2, uint32(len(raw)), raw}
+}
+
+func shortTag(order binary.ByteOrder, tag uint16, vs ...uint16) tiffEntry {
+	raw := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		order.PutUint16(raw[2*i:], v)
+	}
+	return tiffEntry{tag, 3, uint32(len(vs)), raw}
+}
+
+func longTag(order binary.ByteOrder, tag uint16, vs ...uint32) tiffEntry {
+	raw := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		order.PutUint32(raw[4*i:], v)
+	}
+	return tiffEntry{tag, 4, uint32(len(vs)), raw}
+}
+
+// rationalTag takes numerator/denominator pairs.
+func rationalTag(order binary.ByteOrder, tag uint16, vs ...uint32) tiffEntry {
+	raw := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		order.PutUint32(raw[4*i:], v)
+	}
+	return tiffEntry{tag, 5, uint32(len(vs) / 2), raw}
+}
+
+func undefinedTag(tag uint16, raw []byte) tiffEntry {
+	return tiffEntry{tag, 7, uint32(len(raw)), raw}
+}
+
+type tiffBuilder struct {
+	order binary.ByteOrder
+	buf   []byte
+}
+
+func (b *tiffBuilder) write(ifd *tiffIFD) uint32 {
+	entries := append([]tiffEntry(nil), ifd.entries...)
+	for tag, sub := range ifd.subs {
+		entries = append(entries, longTag(b.order, tag, b.write(sub)))
+	}
+	var next uint32
+	if ifd.next != nil {
+		next = b.write(ifd.next)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	values := make([][]byte, len(entries))
+	for i, e := range entries {
+		v := make([]byte, 4)
+		if len(e.raw) > 4 {
+			b.order.PutUint32(v, uint32(len(b.buf)))
+			b.buf = append(b.buf, e.raw...)
+			if len(b.buf)%2 == 1 {
+				b.buf = append(b.buf, 0)
+			}
+		} else {
+			copy(v, e.raw)
+		}
+		values[i] = v
+	}
+
+	offset := uint32(len(b.buf))
+	b.u16(uint16(len(entries)))
+	for i, e := range entries {
+		b.u16(e.tag)
+		b.u16(e.typ)
+		b.u32(e.count)
+		b.buf = append(b.buf, values[i]...)
+	}
+	b.u32(next)
+	return offset
+}
+
+func (b *tiffBuilder) u16(v uint16) {
+	b.buf = append(b.buf, 0, 0)
+	b.order.PutUint16(b.buf[len(b.buf)-2:], v)
+}
+
+func (b *tiffBuilder) u32(v uint32) {
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	b.order.PutUint32(b.buf[len(b.buf)-4:], v)
+}
+
+// buildTIFF returns a TIFF stream whose first IFD is ifd0.
+func buildTIFF(order binary.ByteOrder, ifd0 *tiffIFD) []byte {
+	b := &tiffBuilder{order: order}
+	if order == binary.ByteOrder(binary.LittleEndian) {
+		b.buf = append(b.buf, "II*\x00"...)
+	} else {
+		b.buf = append(b.buf, "MM\x00*"...)
+	}
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	offset := b.write(ifd0)
+	order.PutUint32(b.buf[4:], offset)
+	return b.buf
+}
+
+// jpegSegment returns a JPEG marker segment.
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// buildJPEG returns a minimal JPEG stream holding the given segments.
+func buildJPEG(segments ...[]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\xFF\xD8")
+	for _, seg := range segments {
+		buf.Write(seg)
+	}
+	buf.Write(jpegSegment(0xDA, []byte{0, 0, 0}))
+	buf.WriteString("\xFF\xD9")
+	return buf.Bytes()
+}
+
+// exifAPP1 wraps a TIFF stream into an Exif APP1 segment.
+func exifAPP1(tiff []byte) []byte {
+	return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, p := range payload {
+		buf.Write(p)
+	}
+	b := make([]byte, 8, 8+buf.Len())
+	binary.BigEndian.PutUint32(b, uint32(8+buf.Len()))
+	copy(b[4:], typ)
+	return append(b, buf.Bytes()...)
+}
+
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	vf := make([]byte, 4)
+	binary.BigEndian.PutUint32(vf, flags)
+	vf[0] = version
+	return box(typ, append([][]byte{vf}, payload...)...)
+}
+
+func be16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func be32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func be64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// chunk returns a RIFF chunk of the concatenated data, padded to an even
+// size.
+func chunk(id string, data ...[]byte) []byte {
+	payload := bytes.Join(data, nil)
+	c := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	c = append(c, payload...)
+	if len(payload)%2 == 1 {
+		c = append(c, 0)
+	}
+	return c
+}
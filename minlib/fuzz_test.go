@@ -0,0 +1,139 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fuzzSeeds returns synthetic files of every supported format.
+func fuzzSeeds() [][]byte {
+	le, be := binary.LittleEndian, binary.BigEndian
+	created := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+	tiff := testCameraTIFF(le)
+
+	nctg := append([]byte{0x13, 0x00, 0x02, 0x00, 0x14, 0x00}, "2020:02:03 04:05:06\x00"...)
+	avi := chunk("RIFF", []byte("AVI "), chunk("LIST", []byte("ncdt"), chunk("nctg", nctg)))
+
+	return [][]byte{
+		tiff,
+		testGPSTIFF(be),
+		buildJPEG(exifAPP1(tiff)),
+		buildJPEG(exifAPP1(buildTIFFWithData(func(offset uint32) []byte {
+			jpg := testPreviewJPEG(160, 120)
+			return buildTIFF(le, &tiffIFD{next: &tiffIFD{entries: []tiffEntry{
+				longTag(le, 0x0201, offset),
+				longTag(le, 0x0202, uint32(len(jpg))),
+			}}})
+		}, testPreviewJPEG(160, 120)))),
+		buildHEIF(testExifTIFF(be, "2020:02:03 04:05:06"), false),
+		buildHEIF(testExifTIFF(le, "2020:02:03 04:05:06"), true),
+		bytes.Join([][]byte{box("ftyp", []byte("qt  "), be32(0)), box("moov", mvhdV0(created), appleMeta("2020-02-03T04:05:06+0100"))}, nil),
+		bytes.Join([][]byte{box("ftyp", []byte("isom"), be32(0)), box("moov", mvhdV1(created), box("trak", tkhdV1(created)))}, nil),
+		avi,
+		tsPackets(0x1011, mdpmPES([]byte{0x18, 0x12, 0x20, 0x12, 0x03}, []byte{0x19, 0x04, 0x05, 0x06, 0x07}), true),
+		ebml(ebmlSegment, ebml(ebmlInfo, ebml(ebmlDateUTC, be64(1)))),
+		id3Tag(3, id3Frame(3, "TYER", "2019"), id3Frame(3, "TDAT", "0605")),
+		append([]byte("fLaC\x84\x00\x00\x21"), vorbisComments("DATE=2019-05-06")...),
+		oggPage(1, 0, []byte("\x01vorbis"), append([]byte("\x03vorbis"), vorbisComments("DATE=2019-05-06")...)),
+		chunk("RIFF", []byte("WAVE"), chunk("bext", make([]byte, 338))),
+		[]byte("%PDF-1.4\n<< /CreationDate (D:20190506070809+02'00') >>"),
+		buildMakerNoteTIFF(le, "NIKON CORPORATION", nil, func(offset uint32) []byte {
+			return buildMakerNoteIFD(le, offset, longTag(le, 0x00a7, 1234))
+		}),
+		[]byte(testXMPElements),
+		buildJPEG(exifAPP1(sensitiveTIFF(be)), jpegSegment(0xFE, []byte("comment"))),
+		append([]byte("\x89PNG\r\n\x1a\n"), append(pngChunk("eXIf", sensitiveTIFF(le)), pngChunk("IEND", nil)...)...),
+		chunk("RIFF", []byte("WEBP"), chunk("VP8X", make([]byte, 10)), chunk("EXIF", sensitiveTIFF(le))),
+		buildPNG(pngChunk("tIME", []byte{0x07, 0xe4, 2, 3, 4, 5, 6}), pngChunk("tEXt", []byte("Creation Time\x002020-02-03T04:05:06")),
+			pngChunk("iTXt", append([]byte(pngXMP+"\x00\x01\x00\x00\x00"), zlibCompress(testXMPElements)...))),
+		chunk("RIFF", []byte("WEBP"), chunk("VP8X", make([]byte, 10)), chunk("XMP ", []byte(testXMPElements))),
+	}
+}
+
+func FuzzDecodeExif(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecodeExif(bytes.NewReader(data))
+		DecodeExif(onlyReader{bytes.NewReader(data)})
+		ExtractExifDateTime(bytes.NewReader(data))
+	})
+}
+
+func FuzzReader(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, size := bytes.NewReader(data), int64(len(data))
+		ReaderExif(r, size)
+		ReaderOriginalTime(r, size)
+		ReaderXMP(r, size)
+		ReaderVideoInfo(r, size)
+		if previews, err := ReaderPreviews(r, size); err == nil && len(previews) == 0 {
+			t.Error("ReaderPreviews returned no preview and no error")
+		}
+	})
+}
+
+func FuzzScrub(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var out bytes.Buffer
+		if _, err := Scrub(&out, bytes.NewReader(data), int64(len(data)), DefaultScrubPolicy); err != nil {
+			return
+		}
+		if err := VerifyScrubbed(bytes.NewReader(out.Bytes()), int64(out.Len()), DefaultScrubPolicy); err != nil {
+			t.Errorf("scrubbed output not verified: %v", err)
+		}
+	})
+}
+
+func FuzzParseXMP(f *testing.F) {
+	f.Add([]byte(testXMPElements))
+	f.Add([]byte(testXMPAttributes))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseXMP(data)
+	})
+}
+
+func TestParserErrors(t *testing.T) {
+	le := binary.LittleEndian
+	tiff := testCameraTIFF(le)
+	if _, err := DecodeExif(bytes.NewReader(tiff[:len(tiff)/2])); !errors.Is(err, ErrTruncated) {
+		t.Errorf("truncated TIFF: got %v, want ErrTruncated", err)
+	}
+	var fe *FormatError
+	if _, err := DecodeExif(bytes.NewReader([]byte("II\x2a\x00\xff\xff\xff\x7f"))); !errors.As(err, &fe) || fe.Format != "exif" {
+		t.Errorf("bad IFD offset: got %v, want an exif FormatError", err)
+	}
+
+	// an IFD pointing to itself
+	loop := buildTIFF(le, &tiffIFD{entries: []tiffEntry{asciiTag(0x010f, "Nikon")}})
+	copy(loop[len(loop)-4:], loop[4:8])
+	if _, err := DecodeExif(bytes.NewReader(loop)); err != nil && !errors.As(err, &fe) {
+		t.Errorf("IFD loop: got %v", err)
+	}
+
+	deep := strings.Repeat("<a>", maxXMPDepth+1) + strings.Repeat("</a>", maxXMPDepth+1)
+	if _, err := ParseXMP([]byte(deep)); !errors.Is(err, ErrLimit) {
+		t.Errorf("deep XMP: got %v, want ErrLimit", err)
+	}
+
+	// an empty LIST chunk and a chunk overflowing the file must not stop
+	// the walk from terminating
+	avi := chunk("RIFF", []byte("AVI "), chunk("LIST", []byte("hdrl")), []byte("JUNK\xff\xff\xff\xff"))
+	if _, err := aviTimeCandidates(bytes.NewReader(avi)); err == nil {
+		t.Error("AVI without date: got no error")
+	}
+}
@@ -0,0 +1,136 @@
+package minlib
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// GPS tags: https://exiftool.org/TagNames/GPS.html
+
+// GPSInfo is the location recorded in the GPS IFD.
+type GPSInfo struct {
+	// Latitude and Longitude are in decimal degrees, negative for the
+	// southern and western hemispheres. They are only valid if HasPosition.
+	Latitude    float64
+	Longitude   float64
+	HasPosition bool
+
+	// Altitude is in meters, negative below sea level. It is only valid if
+	// HasAltitude.
+	Altitude    float64
+	HasAltitude bool
+
+	// Time is the UTC time of the GPS fix, zero if not recorded.
+	Time time.Time
+
+	// Datum is the geodetic survey data used, usually "WGS-84".
+	Datum string
+}
+
+const earthRadius = 6371008.8 // meters
+
+// DistanceTo returns the great-circle distance in meters between g and o.
+func (g *GPSInfo) DistanceTo(o *GPSInfo) float64 {
+	lat1, lat2 := g.Latitude*math.Pi/180, o.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (o.Longitude - g.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// gpsDegrees converts a degrees/minutes/seconds rational triple.
+func gpsDegrees(t *Tag) (float64, bool) {
+	if t == nil || t.Count < 1 {
+		return 0, false
+	}
+	var v float64
+	for i, div := range []float64{1, 60, 3600} {
+		if i >= int(t.Count) {
+			break
+		}
+		r, err := t.Rat(i)
+		if err != nil {
+			return 0, false
+		}
+		v += r.Float() / div
+	}
+	return v, true
+}
+
+func (x *Exif) decodeGPS() *GPSInfo {
+	found := false
+	for k := range x.Tags {
+		if k.IFD == GPSIFD {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	g := &GPSInfo{Datum: x.str(GPSIFD, 0x0012)}
+
+	lat, ok1 := gpsDegrees(x.Tag(GPSIFD, 0x0002))
+	lon, ok2 := gpsDegrees(x.Tag(GPSIFD, 0x0004))
+	if ok1 && ok2 {
+		if strings.EqualFold(x.str(GPSIFD, 0x0001), "S") {
+			lat = -lat
+		}
+		if strings.EqualFold(x.str(GPSIFD, 0x0003), "W") {
+			lon = -lon
+		}
+		if lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 {
+			g.Latitude, g.Longitude, g.HasPosition = lat, lon, true
+		}
+	}
+
+	if t := x.Tag(GPSIFD, 0x0006); t != nil {
+		if r, err := t.Rat(0); err == nil && r.Den != 0 {
+			g.Altitude, g.HasAltitude = r.Float(), true
+			if x.int(GPSIFD, 0x0005) == 1 {
+				g.Altitude = -g.Altitude
+			}
+		}
+	}
+
+	g.Time = gpsTime(x.str(GPSIFD, 0x001d), x.Tag(GPSIFD, 0x0007))
+	return g
+}
+
+// gpsTime combines GPSDateStamp ("2006:01:02") and GPSTimeStamp (hour,
+// minute and second rationals) into a UTC time.
+func gpsTime(date string, stamp *Tag) time.Time {
+	d, err := time.Parse("2006:01:02", strings.TrimSpace(date))
+	if err != nil || stamp == nil || stamp.Count < 3 {
+		return zeroTime
+	}
+	var hms [3]float64
+	for i := range hms {
+		r, err := stamp.Rat(i)
+		if err != nil || r.Den == 0 {
+			return zeroTime
+		}
+		hms[i] = r.Float()
+	}
+	if hms[0] >= 24 || hms[1] >= 60 || hms[2] >= 61 {
+		return zeroTime
+	}
+	secs := hms[0]*3600 + hms[1]*60 + hms[2]
+	return d.Add(time.Duration(secs * float64(time.Second)))
+}
+
+// FileGPS returns the GPS location recorded in the Exif metadata of file p.
+func FileGPS(p string) (*GPSInfo, error) {
+	x, err := FileExif(p)
+	if err != nil {
+		return nil, err
+	}
+	if x.GPS == nil {
+		return nil, errors.New("exif: no GPS data")
+	}
+	return x.GPS, nil
+}
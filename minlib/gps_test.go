@@ -0,0 +1,82 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testGPSTIFF(order binary.ByteOrder) []byte {
+	return buildTIFF(order, &tiffIFD{
+		entries: []tiffEntry{asciiTag(0x010f, "Apple")},
+		subs: map[uint16]*tiffIFD{
+			0x8825: {entries: []tiffEntry{
+				asciiTag(0x0001, "S"),
+				rationalTag(order, 0x0002, 33, 1, 51, 1, 3126, 100),
+				asciiTag(0x0003, "E"),
+				rationalTag(order, 0x0004, 151, 1, 12, 1, 3000, 100),
+				{0x0005, TypeByte, 1, []byte{1}},
+				rationalTag(order, 0x0006, 125, 10),
+				rationalTag(order, 0x0007, 23, 1, 59, 1, 30, 1),
+				asciiTag(0x0012, "WGS-84"),
+				asciiTag(0x001d, "2020:12:31"),
+			}},
+		},
+	})
+}
+
+func TestDecodeGPS(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		x, err := DecodeExif(bytes.NewReader(testGPSTIFF(order)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := x.GPS
+		if g == nil || !g.HasPosition || !g.HasAltitude {
+			t.Fatalf("incomplete GPS info: %+v", g)
+		}
+		if math.Abs(g.Latitude-(-33.858683)) > 1e-6 || math.Abs(g.Longitude-151.208333) > 1e-6 {
+			t.Errorf("unexpected position %v, %v", g.Latitude, g.Longitude)
+		}
+		if g.Altitude != -12.5 || g.Datum != "WGS-84" {
+			t.Errorf("unexpected altitude %v or datum %q", g.Altitude, g.Datum)
+		}
+		if want := time.Date(2020, 12, 31, 23, 59, 30, 0, time.UTC); !g.Time.Equal(want) {
+			t.Errorf("GPS time = %v, want %v", g.Time, want)
+		}
+	}
+}
+
+func TestFileGPS(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "a.jpg")
+	data := buildJPEG(exifAPP1(testGPSTIFF(binary.BigEndian)))
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FileGPS(p); err != nil {
+		t.Error(err)
+	}
+
+	data = buildJPEG(exifAPP1(testExifTIFF(binary.BigEndian, "2021:03:04 10:11:12")))
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FileGPS(p); err == nil {
+		t.Error("expected an error for an image without GPS IFD")
+	}
+}
+
+func TestGPSDistance(t *testing.T) {
+	paris := &GPSInfo{Latitude: 48.8566, Longitude: 2.3522}
+	london := &GPSInfo{Latitude: 51.5074, Longitude: -0.1278}
+	if d := paris.DistanceTo(london); math.Abs(d-343.5e3) > 1e3 {
+		t.Errorf("distance = %v", d)
+	}
+}
@@ -0,0 +1,327 @@
+package minlib
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files of a directory are grouped when they are one shot:
+// Live Photo: a HEIC or JPEG still and a QuickTime video sharing the
+// ContentIdentifier of the Apple MakerNote (tag 0x0011) and of the
+// com.apple.quicktime.content.identifier metadata. The names may differ.
+// RAW+JPEG: raw files and JPEG or HEIF images with the same base name,
+// ignoring case, such as a CR2 file, its DNG conversion and the JPEG shot
+// along.
+// Sidecars: .xmp files named after the base name or the full name of a file,
+// Google Takeout JSON files and Apple .AAE edits named after the base name.
+
+// AssetRole is the part a file plays in an AssetGroup.
+type AssetRole string
+
+const (
+	// RolePrimary is the file the group is archived and dated by.
+	RolePrimary AssetRole = "primary"
+	// RoleMotion is the video of a Live Photo.
+	RoleMotion AssetRole = "motion"
+	// RoleJPEG is the JPEG or HEIF image shot along with a raw file.
+	RoleJPEG AssetRole = "jpeg"
+	// RoleSidecar is an XMP, Google Takeout JSON or AAE sidecar.
+	RoleSidecar AssetRole = "sidecar"
+	// RoleRelated is another file sharing a sidecar or, for raw files, the
+	// base name with the primary file.
+	RoleRelated AssetRole = "related"
+)
+
+// AssetFile is a file of an AssetGroup.
+type AssetFile struct {
+	Path string
+	Role AssetRole
+}
+
+// AssetGroup is a set of files of a directory that belong to the same shot
+// and should be moved, deduplicated and dated together.
+type AssetGroup struct {
+	// Files holds the primary file first, then the others by name.
+	Files []AssetFile
+	// ContentIdentifier is the identifier shared by the files of a Live
+	// Photo, empty for other groups.
+	ContentIdentifier string
+}
+
+// Primary returns the path of the primary file of g.
+func (g *AssetGroup) Primary() string {
+	return g.Files[0].Path
+}
+
+// Paths returns the paths of the files of g, the primary file first.
+func (g *AssetGroup) Paths() []string {
+	paths := make([]string, len(g.Files))
+	for i, f := range g.Files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+// Has reports whether g holds a file of the role.
+func (g *AssetGroup) Has(role AssetRole) bool {
+	for _, f := range g.Files {
+		if f.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// rawExts are the extensions of camera raw files.
+var rawExts = map[string]bool{
+	".arw": true,
+	".nef": true,
+	".cr2": true,
+	".cr3": true,
+	".dng": true,
+	".orf": true,
+	".rw2": true,
+	".pef": true,
+	".raf": true,
+}
+
+// GroupDir returns the files of the directory dir grouped into assets, see
+// AssetGroup. Every regular file of dir is in exactly one group, files that
+// are not linked to others form a group of their own. The groups are sorted
+// by the path of their primary file; subdirectories are not scanned.
+func GroupDir(dir string) ([]*AssetGroup, error) {
+	return groupDir(osFS{}, dir)
+}
+
+// FSGroupDir groups the files of the directory dir of fsys, see GroupDir.
+func FSGroupDir(fsys fs.FS, dir string) ([]*AssetGroup, error) {
+	return groupDir(ioFS{fsys}, dir)
+}
+
+// assetGrouper links the files of a directory with a union-find.
+type assetGrouper struct {
+	fsys   fileSystem
+	dir    string
+	names  []string
+	index  map[string]int // by lower case name
+	parent []int
+	roles  []AssetRole
+	ids    []string // Live Photo content identifiers
+}
+
+func groupDir(fsys fileSystem, dir string) ([]*AssetGroup, error) {
+	entries, err := fsys.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	g := &assetGrouper{fsys: fsys, dir: dir, index: make(map[string]int)}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		g.index[strings.ToLower(e.Name())] = len(g.names)
+		g.names = append(g.names, e.Name())
+	}
+	g.parent = make([]int, len(g.names))
+	for i := range g.parent {
+		g.parent[i] = i
+	}
+	g.roles = make([]AssetRole, len(g.names))
+	g.ids = make([]string, len(g.names))
+
+	g.linkLivePhotos()
+	g.linkRawJPEG()
+	g.linkSidecars()
+	return g.groups(), nil
+}
+
+func (g *assetGrouper) find(i int) int {
+	for g.parent[i] != i {
+		g.parent[i] = g.parent[g.parent[i]]
+		i = g.parent[i]
+	}
+	return i
+}
+
+func (g *assetGrouper) union(i, j int) {
+	if i, j = g.find(i), g.find(j); i != j {
+		g.parent[j] = i
+	}
+}
+
+// lookup returns the index of the file named name, ignoring case.
+func (g *assetGrouper) lookup(name string) (int, bool) {
+	i, ok := g.index[strings.ToLower(name)]
+	return i, ok
+}
+
+// linkLivePhotos links the stills and the videos sharing a content
+// identifier. The stills are only read when a video has an identifier.
+func (g *assetGrouper) linkLivePhotos() {
+	videos := make(map[string][]int)
+	for i, name := range g.names {
+		if mediaTypeByExt(name) == MediaQuickTime {
+			if id := g.movContentIdentifier(name); id != "" {
+				videos[id] = append(videos[id], i)
+			}
+		}
+	}
+	if len(videos) == 0 {
+		return
+	}
+	for i, name := range g.names {
+		switch mediaTypeByExt(name) {
+		case MediaJPEG, MediaHEIC, MediaHEIF:
+		default:
+			continue
+		}
+		x, err := mediaExif(g.fsys, g.fsys.join(g.dir, name))
+		if err != nil || x.ContentIdentifier == "" {
+			continue
+		}
+		for _, v := range videos[x.ContentIdentifier] {
+			g.union(i, v)
+			g.roles[v] = RoleMotion
+			g.ids[i], g.ids[v] = x.ContentIdentifier, x.ContentIdentifier
+		}
+	}
+}
+
+// movContentIdentifier returns the Live Photo content identifier of the
+// QuickTime file name, or "" if it has none.
+func (g *assetGrouper) movContentIdentifier(name string) string {
+	m, err := openMedia(g.fsys, g.fsys.join(g.dir, name))
+	if err != nil {
+		return ""
+	}
+	defer m.Close()
+	if m.typ != MediaQuickTime && m.typ != MediaMP4 {
+		return ""
+	}
+	movie, err := parseMOV(m.reader())
+	if err != nil {
+		return ""
+	}
+	return movie.metadata["com.apple.quicktime.content.identifier"]
+}
+
+// linkRawJPEG links the raw files of the same base name to each other and
+// to the JPEG and HEIF images of that name.
+func (g *assetGrouper) linkRawJPEG() {
+	raws := make(map[string]int)
+	for i, name := range g.names {
+		if ext := filepath.Ext(name); rawExts[strings.ToLower(ext)] {
+			stem := strings.ToLower(strings.TrimSuffix(name, ext))
+			if raw, ok := raws[stem]; ok {
+				g.union(raw, i)
+			} else {
+				raws[stem] = i
+			}
+		}
+	}
+	for i, name := range g.names {
+		switch mediaTypeByExt(name) {
+		case MediaJPEG, MediaHEIC, MediaHEIF:
+		default:
+			continue
+		}
+		stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+		if raw, ok := raws[stem]; ok {
+			g.union(raw, i)
+			if g.roles[i] == "" {
+				g.roles[i] = RoleJPEG
+			}
+		}
+	}
+}
+
+// linkSidecars links the sidecars to the files they describe.
+func (g *assetGrouper) linkSidecars() {
+	for i, name := range g.names {
+		if isSidecarName(name) {
+			continue
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		candidates := []string{stem + ".xmp", name + ".xmp", stem + ".aae"}
+		candidates = append(candidates, takeoutSidecarNames(name)...)
+		for _, c := range candidates {
+			if j, ok := g.lookup(c); ok && j != i && isSidecarName(c) {
+				g.union(i, j)
+				g.roles[j] = RoleSidecar
+			}
+		}
+	}
+}
+
+// isSidecarName reports whether name has the extension of a sidecar.
+func isSidecarName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xmp", ".json", ".aae":
+		return true
+	}
+	return false
+}
+
+// primaryRank orders the candidates for the primary file of a group: raw
+// files first, then images, videos and sidecars.
+func (g *assetGrouper) primaryRank(i int) int {
+	name := g.names[i]
+	switch {
+	case g.roles[i] == RoleSidecar:
+		return 4
+	case g.roles[i] == RoleMotion:
+		return 3
+	case rawExts[strings.ToLower(filepath.Ext(name))]:
+		return 0
+	case g.roles[i] == RoleJPEG:
+		return 1
+	}
+	switch mediaTypeByExt(name) {
+	case MediaJPEG, MediaTIFF, MediaPNG, MediaWebP, MediaHEIC, MediaHEIF, MediaAVIF:
+		return 1
+	}
+	return 2
+}
+
+func (g *assetGrouper) groups() []*AssetGroup {
+	members := make(map[int][]int)
+	var roots []int
+	for i := range g.names {
+		root := g.find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], i)
+	}
+
+	groups := make([]*AssetGroup, 0, len(roots))
+	for _, root := range roots {
+		files := members[root]
+		primary := files[0]
+		for _, i := range files[1:] {
+			if g.primaryRank(i) < g.primaryRank(primary) {
+				primary = i
+			}
+		}
+		group := &AssetGroup{ContentIdentifier: g.ids[primary]}
+		add := func(i int, role AssetRole) {
+			group.Files = append(group.Files, AssetFile{g.fsys.join(g.dir, g.names[i]), role})
+		}
+		add(primary, RolePrimary)
+		for _, i := range files {
+			if i == primary {
+				continue
+			}
+			role := g.roles[i]
+			if role == "" {
+				role = RoleRelated
+			}
+			add(i, role)
+		}
+		groups = append(groups, group)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Primary() < groups[j].Primary() })
+	return groups
+}
@@ -0,0 +1,79 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestGroupDir(t *testing.T) {
+	const id = "5C1A7E2B-0D4F-4C43-9A51-6E0B1F8D2C3A"
+	live := func(contentIdentifier string) []byte {
+		return bytes.Join([][]byte{
+			box("ftyp", []byte("qt  "), be32(0)),
+			box("moov", mvhdV0(time.Date(2019, 6, 5, 7, 19, 30, 0, time.UTC)),
+				movMeta("com.apple.quicktime.content.identifier", contentIdentifier)),
+		}, nil)
+	}
+	file := func(data []byte) *fstest.MapFile { return &fstest.MapFile{Data: data} }
+	fsys := fstest.MapFS{
+		"dcim/IMG_0001.JPG":         file(buildJPEG(exifAPP1(appleMakerNoteTIFF(id)))),
+		"dcim/IMG_0001.AAE":         file([]byte("<plist/>")),
+		"dcim/renamed.mov":          file(live(id)),
+		"dcim/IMG_0002.MOV":         file(live("other")),
+		"dcim/DSC_0003.NEF":         file([]byte("raw")),
+		"dcim/dsc_0003.jpg":         file([]byte("jpeg")),
+		"dcim/DSC_0003.xmp":         file([]byte("<x:xmpmeta/>")),
+		"dcim/IMG_0005.CR2":         file([]byte("raw")),
+		"dcim/IMG_0005.dng":         file([]byte("converted raw")),
+		"dcim/IMG_0005.JPG":         file([]byte("jpeg")),
+		"dcim/PXL_0004.mp4":         file([]byte("video")),
+		"dcim/PXL_0004.mp4.json":    file([]byte("{}")),
+		"dcim/unrelated.json":       file([]byte("{}")),
+		"dcim/sub/IMG_0001.MOV":     file(live(id)),
+		"dcim/sub/DSC_0003.JPG.xmp": file([]byte("<x:xmpmeta/>")),
+	}
+	groups, err := FSGroupDir(fsys, "dcim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*AssetGroup{
+		{Files: []AssetFile{
+			{"dcim/DSC_0003.NEF", RolePrimary},
+			{"dcim/DSC_0003.xmp", RoleSidecar},
+			{"dcim/dsc_0003.jpg", RoleJPEG},
+		}},
+		{Files: []AssetFile{
+			{"dcim/IMG_0001.JPG", RolePrimary},
+			{"dcim/IMG_0001.AAE", RoleSidecar},
+			{"dcim/renamed.mov", RoleMotion},
+		}, ContentIdentifier: id},
+		{Files: []AssetFile{{"dcim/IMG_0002.MOV", RolePrimary}}},
+		{Files: []AssetFile{
+			{"dcim/IMG_0005.CR2", RolePrimary},
+			{"dcim/IMG_0005.JPG", RoleJPEG},
+			{"dcim/IMG_0005.dng", RoleRelated},
+		}},
+		{Files: []AssetFile{
+			{"dcim/PXL_0004.mp4", RolePrimary},
+			{"dcim/PXL_0004.mp4.json", RoleSidecar},
+		}},
+		{Files: []AssetFile{{"dcim/unrelated.json", RolePrimary}}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(groups[i], want[i]) {
+			t.Errorf("group %d: got %+v, want %+v", i, *groups[i], *want[i])
+		}
+	}
+	if !groups[1].Has(RoleMotion) || groups[0].Has(RoleMotion) {
+		t.Error("Has(RoleMotion) does not tell the Live Photo")
+	}
+}
@@ -0,0 +1,220 @@
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// HEIF: ISO/IEC 23008-12
+// The Exif block is stored as an item of type "Exif". meta/iinf maps item IDs
+// to item types and meta/iloc maps item IDs to their extents in the file.
+
+const maxHEIFExifSize = 16 << 20
+
+type heifExtent struct {
+	offset int64
+	length int64
+}
+
+type heifItemLocation struct {
+	constructionMethod uint16
+	baseOffset         int64
+	extents            []heifExtent
+}
+
+// extractHEIFExif returns the TIFF data of the Exif item in the HEIF file r.
+func extractHEIFExif(r io.ReadSeeker) ([]byte, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := findBox(r, 0, size, "meta")
+	if err != nil {
+		return nil, err
+	}
+	// meta is a full box: skip version and flags
+	start, end := meta.dataOffset()+4, meta.end()
+
+	var exifID uint32
+	var found bool
+	var locations map[uint32]*heifItemLocation
+	var idat *bmffBox
+
+	err = walkBoxes(r, start, end, func(b *bmffBox) error {
+		switch b.typ {
+		case "iinf", "iloc":
+			data, err := boxPayload(r, b, maxHEIFExifSize)
+			if err != nil {
+				return err
+			}
+			if b.typ == "iinf" {
+				exifID, found, err = parseHEIFItemInfo(data)
+			} else {
+				locations, err = parseHEIFItemLocation(data)
+			}
+			return err
+		case "idat":
+			idat = b
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &ErrNoOriginalTime{"no Exif item in HEIF file"}
+	}
+	loc, ok := locations[exifID]
+	if !ok {
+		return nil, errors.New("heif: no location for Exif item")
+	}
+
+	var base int64
+	switch loc.constructionMethod {
+	case 0:
+		// file offset
+	case 1:
+		// idat offset
+		if idat == nil {
+			return nil, errors.New("heif: Exif item refers to missing idat box")
+		}
+		base = idat.dataOffset()
+	default:
+		return nil, fmt.Errorf("heif: unsupported construction method %d", loc.constructionMethod)
+	}
+
+	var buf bytes.Buffer
+	for _, e := range loc.extents {
+		length := e.length
+		if length == 0 {
+			// extent covers the rest of the file
+			length = size - (base + loc.baseOffset + e.offset)
+		}
+		if length < 0 || int64(buf.Len())+length > maxHEIFExifSize {
+			return nil, formatError("heif", -1, "invalid Exif item size")
+		}
+		data, err := readAt(r, base+loc.baseOffset+e.offset, int(length))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+
+	// The item starts with the offset of the TIFF header, usually skipping
+	// an "Exif\0\0" marker.
+	data := buf.Bytes()
+	if len(data) < 4 {
+		return nil, truncatedError("heif", -1)
+	}
+	headerOffset := int64(binary.BigEndian.Uint32(data[:4])) + 4
+	if headerOffset > int64(len(data)) {
+		return nil, formatError("heif", -1, "invalid TIFF header offset")
+	}
+	return data[headerOffset:], nil
+}
+
+// parseHEIFItemInfo parses the payload of an iinf box and returns the ID of
+// the Exif item.
+func parseHEIFItemInfo(data []byte) (uint32, bool, error) {
+	c := &bmffCursor{b: data}
+	version := c.u8()
+	c.skip(3)
+	var count uint32
+	if version == 0 {
+		count = uint32(c.u16())
+	} else {
+		count = c.u32()
+	}
+	if c.err != nil {
+		return 0, false, c.err
+	}
+
+	for i := uint32(0); i < count && len(data)-c.off >= 8; i++ {
+		size := int(c.u32())
+		typ := string(c.next(4))
+		if c.err != nil || size < 8 || size-8 > len(data)-c.off {
+			return 0, false, formatError("heif", -1, "invalid infe box")
+		}
+		payload := c.next(size - 8)
+		if typ != "infe" {
+			continue
+		}
+
+		infe := &bmffCursor{b: payload}
+		infeVersion := infe.u8()
+		infe.skip(3)
+		if infeVersion < 2 {
+			// versions 0 and 1 carry no item type
+			continue
+		}
+		var id uint32
+		if infeVersion == 2 {
+			id = uint32(infe.u16())
+		} else {
+			id = infe.u32()
+		}
+		infe.skip(2) // item_protection_index
+		itemType := string(infe.next(4))
+		if infe.err != nil {
+			return 0, false, infe.err
+		}
+		if itemType == "Exif" {
+			return id, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// parseHEIFItemLocation parses the payload of an iloc box.
+func parseHEIFItemLocation(data []byte) (map[uint32]*heifItemLocation, error) {
+	c := &bmffCursor{b: data}
+	version := c.u8()
+	c.skip(3)
+	sizes := c.u16()
+	offsetSize := int(sizes >> 12)
+	lengthSize := int(sizes >> 8 & 0xf)
+	baseOffsetSize := int(sizes >> 4 & 0xf)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+
+	var count uint32
+	if version < 2 {
+		count = uint32(c.u16())
+	} else {
+		count = c.u32()
+	}
+
+	locations := make(map[uint32]*heifItemLocation)
+	for i := uint32(0); i < count && c.err == nil; i++ {
+		var id uint32
+		if version < 2 {
+			id = uint32(c.u16())
+		} else {
+			id = c.u32()
+		}
+		loc := &heifItemLocation{}
+		if version == 1 || version == 2 {
+			loc.constructionMethod = c.u16() & 0xf
+		}
+		c.skip(2) // data_reference_index
+		loc.baseOffset = int64(c.uint(baseOffsetSize))
+		extentCount := int(c.u16())
+		for j := 0; j < extentCount && c.err == nil; j++ {
+			c.uint(indexSize)
+			e := heifExtent{}
+			e.offset = int64(c.uint(offsetSize))
+			e.length = int64(c.uint(lengthSize))
+			loc.extents = append(loc.extents, e)
+		}
+		locations[id] = loc
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return locations, nil
+}
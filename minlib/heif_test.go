@@ -0,0 +1,82 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildHEIF returns a HEIF file whose Exif item holds tiff. With inIdat the
+// item is stored in meta/idat (construction method 1), otherwise in mdat.
+func buildHEIF(tiff []byte, inIdat bool) []byte {
+	item := append(be32(6), "Exif\x00\x00"...)
+	item = append(item, tiff...)
+
+	ftyp := box("ftyp", []byte("heic"), be32(0), []byte("mif1heic"))
+	iinf := fullBox("iinf", 0, 0, be16(2),
+		fullBox("infe", 2, 0, be16(1), be16(0), []byte("hvc1"), []byte{0}),
+		fullBox("infe", 2, 0, be16(2), be16(0), []byte("Exif"), []byte{0}))
+
+	meta := func(offset uint32) []byte {
+		if inIdat {
+			iloc := fullBox("iloc", 1, 0, []byte{0x44, 0x00}, be16(1),
+				be16(2), be16(1), be16(0), be16(1), be32(0), be32(uint32(len(item))))
+			return fullBox("meta", 0, 0, iinf, iloc, box("idat", item))
+		}
+		iloc := fullBox("iloc", 0, 0, []byte{0x44, 0x00}, be16(1),
+			be16(2), be16(0), be16(1), be32(offset), be32(uint32(len(item))))
+		return fullBox("meta", 0, 0, iinf, iloc)
+	}
+
+	offset := len(ftyp) + len(meta(0)) + 8
+	var buf bytes.Buffer
+	buf.Write(ftyp)
+	buf.Write(meta(uint32(offset)))
+	buf.Write(box("mdat", item))
+	return buf.Bytes()
+}
+
+func testExifTIFF(order binary.ByteOrder, dateTimeOriginal string) []byte {
+	return buildTIFF(order, &tiffIFD{
+		entries: []tiffEntry{asciiTag(0x010f, "Apple")},
+		subs: map[uint16]*tiffIFD{
+			0x8769: {entries: []tiffEntry{asciiTag(0x9003, dateTimeOriginal)}},
+		},
+	})
+}
+
+func TestHEIFOriginalTime(t *testing.T) {
+	want := time.Date(2021, 3, 4, 10, 11, 12, 0, time.Local)
+	dir := t.TempDir()
+
+	for i, inIdat := range []bool{false, true} {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			p := filepath.Join(dir, "IMG_0001.HEIC")
+			data := buildHEIF(testExifTIFF(order, "2021:03:04 10:11:12"), inIdat)
+			if err := os.WriteFile(p, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := FileOriginalTime(p)
+			if err != nil {
+				t.Fatalf("case %d: %v", i, err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("case %d: got %v, want %v", i, got, want)
+			}
+		}
+	}
+}
+
+func TestHEIFWithoutExif(t *testing.T) {
+	data := box("ftyp", []byte("heic"), be32(0))
+	data = append(data, fullBox("meta", 0, 0, fullBox("iinf", 0, 0, be16(0)))...)
+	if _, err := extractHEIFExif(bytes.NewReader(data)); err == nil {
+		t.Error("expected an error for a HEIF file without Exif item")
+	}
+}
@@ -0,0 +1,248 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// MakerNote (0x927c) layouts
+// Nikon type 3: "Nikon\0" + version + TIFF header, offsets relative to it
+// Nikon type 1: "Nikon\0\x01\0" + IFD, offsets relative to the Exif header
+// Canon: IFD, offsets relative to the Exif header
+// Sony: optional "SONY DSC \0\0\0" prefix + IFD, offsets relative to the
+// Exif header
+// Apple: "Apple iOS\0" + version + "MM" + IFD at offset 14, offsets
+// relative to the start of the MakerNote
+// Tags: https://exiftool.org/TagNames/Nikon.html
+// https://exiftool.org/TagNames/Canon.html
+// https://exiftool.org/TagNames/Sony.html
+// https://exiftool.org/TagNames/Apple.html
+
+// LensInfo describes the lens an image was taken with. Zero values are
+// unknown.
+type LensInfo struct {
+	Make         string
+	Model        string
+	SerialNumber string
+	// ID is the vendor lens type (Canon LensType, Sony LensType).
+	ID int
+	// Focal range in mm and maximum apertures at both ends.
+	MinFocalLength, MaxFocalLength float64
+	MinFNumber, MaxFNumber         float64
+}
+
+// makerNoteVendor returns the vendor of the MakerNote of the camera make.
+func makerNoteVendor(cameraMake string) string {
+	cameraMake = strings.ToUpper(cameraMake)
+	for _, vendor := range []string{"NIKON", "CANON", "SONY", "APPLE"} {
+		if strings.HasPrefix(cameraMake, vendor) {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// parseMakerNote reads the MakerNote IFD of the supported vendors into
+// MakerNoteIFD. The offsets of its tags are relative to the TIFF header the
+// MakerNote uses, which is embedded in Nikon MakerNotes. A broken MakerNote
+// is ignored.
+func (t *tiffReader) parseMakerNote() {
+	mn := t.exif.Tag(ExifIFD, 0x927c)
+	if mn == nil || mn.Count < 16 {
+		return
+	}
+	head, err := readAt(t.r, t.headerOffset+mn.Offset, 14)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(string(head), "Nikon\x00\x02"):
+		var order binary.ByteOrder
+		switch string(head[10:12]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return
+		}
+		hdr, err := readAt(t.r, t.headerOffset+mn.Offset+10, 8)
+		if err != nil {
+			return
+		}
+		nested := &tiffReader{
+			r:            t.r,
+			size:         t.size,
+			endian:       order,
+			headerOffset: t.headerOffset + mn.Offset + 10,
+			visited:      make(map[int64]bool),
+			exif:         t.exif,
+			depth:        t.depth + 1,
+			tags:         t.tags,
+			loaded:       t.loaded,
+		}
+		nested.parseDirEntry(int64(order.Uint32(hdr[4:8])), MakerNoteIFD)
+		t.tags, t.loaded = nested.tags, nested.loaded
+	case strings.HasPrefix(string(head), "Apple iOS\x00") && string(head[12:14]) == "MM":
+		nested := &tiffReader{
+			r:            t.r,
+			size:         t.size,
+			endian:       binary.BigEndian,
+			headerOffset: t.headerOffset + mn.Offset,
+			visited:      make(map[int64]bool),
+			exif:         t.exif,
+			depth:        t.depth + 1,
+			tags:         t.tags,
+			loaded:       t.loaded,
+		}
+		nested.parseDirEntry(14, MakerNoteIFD)
+		t.tags, t.loaded = nested.tags, nested.loaded
+	case strings.HasPrefix(string(head), "Nikon\x00\x01"):
+		t.parseDirEntry(mn.Offset+8, MakerNoteIFD)
+	case strings.HasPrefix(string(head), "SONY DSC \x00\x00\x00"),
+		strings.HasPrefix(string(head), "SONY CAM \x00\x00\x00"):
+		t.parseDirEntry(mn.Offset+12, MakerNoteIFD)
+	default:
+		switch makerNoteVendor(t.exif.str(IFD0, 0x010f)) {
+		case "CANON", "SONY":
+			t.parseDirEntry(mn.Offset, MakerNoteIFD)
+		}
+	}
+}
+
+// decodeCameraInfo fills the serial number, shutter count and lens fields
+// of x from the Exif IFD, completed by the MakerNote.
+func (x *Exif) decodeCameraInfo() {
+	x.SerialNumber = x.str(ExifIFD, 0xa431)
+	x.Lens = LensInfo{
+		Make:         x.str(ExifIFD, 0xa433),
+		Model:        x.LensModel,
+		SerialNumber: x.str(ExifIFD, 0xa435),
+	}
+	if t := x.Tag(ExifIFD, 0xa432); t != nil {
+		x.Lens.setSpecification(t)
+	}
+
+	switch makerNoteVendor(x.Make) {
+	case "NIKON":
+		x.decodeNikonMakerNote()
+	case "CANON":
+		x.decodeCanonMakerNote()
+	case "SONY":
+		x.decodeSonyMakerNote()
+	case "APPLE":
+		x.ContentIdentifier = x.str(MakerNoteIFD, 0x0011)
+	}
+}
+
+// setSpecification sets the focal range and apertures from 4 rationals, as
+// stored by LensSpecification and the Nikon Lens tag. Existing values are
+// kept.
+func (l *LensInfo) setSpecification(t *Tag) {
+	var v [4]float64
+	for i := range v {
+		f, err := t.Float(i)
+		if err != nil {
+			return
+		}
+		v[i] = f
+	}
+	if l.MinFocalLength == 0 && l.MaxFocalLength == 0 {
+		l.MinFocalLength, l.MaxFocalLength = v[0], v[1]
+	}
+	if l.MinFNumber == 0 && l.MaxFNumber == 0 {
+		l.MinFNumber, l.MaxFNumber = v[2], v[3]
+	}
+}
+
+func (x *Exif) decodeNikonMakerNote() {
+	if x.SerialNumber == "" {
+		x.SerialNumber = x.str(MakerNoteIFD, 0x001d)
+	}
+	x.ShutterCount = x.int(MakerNoteIFD, 0x00a7)
+	if t := x.Tag(MakerNoteIFD, 0x0084); t != nil {
+		x.Lens.setSpecification(t)
+	}
+}
+
+func (x *Exif) decodeCanonMakerNote() {
+	if x.SerialNumber == "" {
+		if t := x.Tag(MakerNoteIFD, 0x000c); t != nil {
+			if v, err := t.Int(0); err == nil && v > 0 {
+				x.SerialNumber = fmt.Sprintf("%010d", v)
+			}
+		}
+	}
+	if x.Lens.Model == "" {
+		x.Lens.Model = x.str(MakerNoteIFD, 0x0095)
+	}
+	// CameraSettings: LensType at 22, MaxFocalLength at 23, MinFocalLength
+	// at 24 in FocalUnits per mm at 25
+	if t := x.Tag(MakerNoteIFD, 0x0001); t != nil {
+		at := func(i int) int64 {
+			v, _ := t.Int(i)
+			return v
+		}
+		if id := at(22); id > 0 && id != 0xffff {
+			x.Lens.ID = int(id)
+		}
+		units := at(25)
+		if units <= 0 {
+			units = 1
+		}
+		if x.Lens.MinFocalLength == 0 && x.Lens.MaxFocalLength == 0 {
+			x.Lens.MinFocalLength = float64(at(24)) / float64(units)
+			x.Lens.MaxFocalLength = float64(at(23)) / float64(units)
+		}
+	}
+	// Canon does not record the shutter count in a documented tag, the
+	// ShutterCount stays 0
+}
+
+func (x *Exif) decodeSonyMakerNote() {
+	if id := x.int(MakerNoteIFD, 0xb027); id > 0 && id != 0xffff {
+		x.Lens.ID = id
+	}
+	// LensSpec: flags, min and max focal length as 4 BCD digits, min and
+	// max aperture as 2 BCD digits in tenths, flags
+	if t := x.Tag(MakerNoteIFD, 0xb02a); t != nil && len(t.Value) == 8 && x.Lens.MinFocalLength == 0 {
+		v := t.Value
+		x.Lens.MinFocalLength = float64(bcd(v[1])*100 + bcd(v[2]))
+		x.Lens.MaxFocalLength = float64(bcd(v[3])*100 + bcd(v[4]))
+		x.Lens.MinFNumber = float64(bcd(v[5])) / 10
+		x.Lens.MaxFNumber = float64(bcd(v[6])) / 10
+	}
+	// Tag9050 is enciphered; the ShutterCount of the SLT, NEX and ILCE
+	// models is a 3 byte value at 0x3a
+	if t := x.Tag(MakerNoteIFD, 0x9050); t != nil && len(t.Value) >= 0x3e {
+		data := sonyDecipher(t.Value[0x3a:0x3e])
+		x.ShutterCount = int(t.order.Uint32(data) & 0xffffff)
+	}
+}
+
+func bcd(b byte) int {
+	return int(b>>4)*10 + int(b&0x0f)
+}
+
+// sonyDecipherTable inverts the Sony cipher, which maps b < 249 to
+// b^3 mod 249.
+var sonyDecipherTable = func() [256]byte {
+	var table [256]byte
+	for b := 0; b < 256; b++ {
+		table[b] = byte(b)
+	}
+	for b := 0; b < 249; b++ {
+		table[b*b*b%249] = byte(b)
+	}
+	return table
+}()
+
+func sonyDecipher(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = sonyDecipherTable[b]
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"testing"
+)
+
+// buildMakerNoteIFD returns an IFD followed by its values. base is the
+// offset of the IFD from the TIFF header the value offsets are relative to.
+func buildMakerNoteIFD(order binary.ByteOrder, base uint32, entries ...tiffEntry) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	b := &tiffBuilder{order: order}
+	var values []byte
+	valueOffset := base + 2 + 12*uint32(len(entries)) + 4
+	b.u16(uint16(len(entries)))
+	for _, e := range entries {
+		b.u16(e.tag)
+		b.u16(e.typ)
+		b.u32(e.count)
+		if len(e.raw) > 4 {
+			b.u32(valueOffset + uint32(len(values)))
+			values = append(values, e.raw...)
+		} else {
+			b.buf = append(b.buf, e.raw...)
+			b.buf = append(b.buf, make([]byte, 4-len(e.raw))...)
+		}
+	}
+	b.u32(0)
+	return append(b.buf, values...)
+}
+
+// buildMakerNoteTIFF returns a TIFF stream with the camera make and the
+// MakerNote returned by makerNote for its offset from the TIFF header.
+func buildMakerNoteTIFF(order binary.ByteOrder, cameraMake string, exifEntries []tiffEntry, makerNote func(offset uint32) []byte) []byte {
+	build := func(mn []byte) []byte {
+		return buildTIFF(order, &tiffIFD{
+			entries: []tiffEntry{asciiTag(0x010f, cameraMake)},
+			subs: map[uint16]*tiffIFD{
+				0x8769: {entries: append([]tiffEntry{undefinedTag(0x927c, mn)}, exifEntries...)},
+			},
+		})
+	}
+	// locate the MakerNote with a placeholder of the same size
+	placeholder := bytes.Repeat([]byte{0xA5}, len(makerNote(0)))
+	offset := bytes.Index(build(placeholder), placeholder)
+	return build(makerNote(uint32(offset)))
+}
+
+func TestNikonMakerNote(t *testing.T) {
+	be := binary.BigEndian
+	tiff := buildMakerNoteTIFF(binary.LittleEndian, "NIKON CORPORATION", nil, func(uint32) []byte {
+		nested := buildTIFF(be, &tiffIFD{entries: []tiffEntry{
+			asciiTag(0x001d, "3012345"),
+			rationalTag(be, 0x0084, 240, 10, 700, 10, 28, 10, 28, 10),
+			longTag(be, 0x00a7, 48213),
+		}})
+		return append([]byte("Nikon\x00\x02\x10\x00\x00"), nested...)
+	})
+	x, err := DecodeExif(bytes.NewReader(tiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.SerialNumber != "3012345" || x.ShutterCount != 48213 {
+		t.Errorf("got serial %q, shutter count %d", x.SerialNumber, x.ShutterCount)
+	}
+	if l := x.Lens; l.MinFocalLength != 24 || l.MaxFocalLength != 70 || l.MinFNumber != 2.8 || l.MaxFNumber != 2.8 {
+		t.Errorf("unexpected lens %+v", l)
+	}
+	if x.Tag(MakerNoteIFD, 0x00a7) == nil {
+		t.Error("MakerNote tags not stored")
+	}
+}
+
+func TestCanonMakerNote(t *testing.T) {
+	le := binary.LittleEndian
+	settings := make([]uint16, 30)
+	settings[22], settings[23], settings[24], settings[25] = 137, 105, 24, 1
+	tiff := buildMakerNoteTIFF(le, "Canon", []tiffEntry{asciiTag(0xa434, "EF24-105mm f/4L IS USM")}, func(offset uint32) []byte {
+		return buildMakerNoteIFD(le, offset,
+			shortTag(le, 0x0001, settings...),
+			longTag(le, 0x000c, 1234567),
+			asciiTag(0x0095, "EF24-105mm f/4L IS USM"),
+		)
+	})
+	x, err := DecodeExif(bytes.NewReader(tiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.SerialNumber != "0001234567" {
+		t.Errorf("SerialNumber = %q", x.SerialNumber)
+	}
+	if l := x.Lens; l.Model != "EF24-105mm f/4L IS USM" || l.ID != 137 || l.MinFocalLength != 24 || l.MaxFocalLength != 105 {
+		t.Errorf("unexpected lens %+v", l)
+	}
+	if x.ShutterCount != 0 {
+		t.Errorf("ShutterCount = %d, want 0 for Canon", x.ShutterCount)
+	}
+}
+
+func TestSonyMakerNote(t *testing.T) {
+	le := binary.LittleEndian
+	encipher := func(data []byte) []byte {
+		for i, b := range data {
+			if b < 249 {
+				c := int(b)
+				data[i] = byte(c * c * c % 249)
+			}
+		}
+		return data
+	}
+	tag9050 := make([]byte, 0x100)
+	le.PutUint32(tag9050[0x3a:], 0xAB000000|31337)
+	encipher(tag9050)
+
+	tiff := buildMakerNoteTIFF(le, "SONY", []tiffEntry{asciiTag(0xa431, "5012345")}, func(offset uint32) []byte {
+		ifd := buildMakerNoteIFD(le, offset+12,
+			undefinedTag(0x9050, tag9050),
+			longTag(le, 0xb027, 32790),
+			undefinedTag(0xb02a, []byte{0, 0x00, 0x24, 0x00, 0x70, 0x40, 0x40, 0}),
+		)
+		return append([]byte("SONY DSC \x00\x00\x00"), ifd...)
+	})
+	x, err := DecodeExif(bytes.NewReader(tiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.SerialNumber != "5012345" || x.ShutterCount != 31337 {
+		t.Errorf("got serial %q, shutter count %d", x.SerialNumber, x.ShutterCount)
+	}
+	if l := x.Lens; l.ID != 32790 || l.MinFocalLength != 24 || l.MaxFocalLength != 70 || l.MinFNumber != 4 || l.MaxFNumber != 4 {
+		t.Errorf("unexpected lens %+v", l)
+	}
+}
+
+func TestBrokenMakerNote(t *testing.T) {
+	tiff := buildMakerNoteTIFF(binary.BigEndian, "Canon", []tiffEntry{asciiTag(0x9003, "2019:01:01 10:11:12")}, func(uint32) []byte {
+		// entry count pointing past the end of the stream
+		return []byte{0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	})
+	x, err := DecodeExif(bytes.NewReader(tiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.DateTimeOriginal.IsZero() || x.ShutterCount != 0 {
+		t.Errorf("unexpected Exif %+v", x)
+	}
+}
+
+// appleMakerNoteTIFF returns a TIFF stream with an Apple MakerNote holding
+// the Live Photo content identifier.
+func appleMakerNoteTIFF(contentIdentifier string) []byte {
+	be := binary.BigEndian
+	return buildMakerNoteTIFF(be, "Apple", nil, func(uint32) []byte {
+		ifd := buildMakerNoteIFD(be, 14, longTag(be, 0x0001, 14), asciiTag(0x0011, contentIdentifier))
+		return append([]byte("Apple iOS\x00\x00\x01MM"), ifd...)
+	})
+}
+
+func TestAppleMakerNote(t *testing.T) {
+	x, err := DecodeExif(bytes.NewReader(appleMakerNoteTIFF("5C1A7E2B-0D4F-4C43-9A51-6E0B1F8D2C3A")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.ContentIdentifier != "5C1A7E2B-0D4F-4C43-9A51-6E0B1F8D2C3A" {
+		t.Errorf("ContentIdentifier = %q", x.ContentIdentifier)
+	}
+}
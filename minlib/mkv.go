@@ -0,0 +1,179 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Matroska and WebM (EBML)
+// Elements are laid out as [ID: vint][size: vint][data]. A vint has its
+// length in the leading zero bits of the first byte; the marker bit is kept
+// in IDs and removed from sizes. A size of all ones is unknown: the element
+// extends to the end of its parent.
+// Segment (0x18538067) > Info (0x1549A966) > DateUTC (0x4461): signed
+// nanoseconds since 2001-01-01T00:00:00 UTC.
+// https://www.matroska.org/technical/elements.html
+
+const (
+	ebmlSegment = 0x18538067
+	ebmlInfo    = 0x1549A966
+	ebmlDateUTC = 0x4461
+	ebmlCluster = 0x1F43B675
+)
+
+// maxEBMLElements limits the elements visited in a Segment.
+const maxEBMLElements = 1 << 16
+
+// matroskaEpoch is the origin of DateUTC.
+var matroskaEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type ebmlElement struct {
+	id     uint32
+	offset int64 // offset of the element header
+	header int64 // size of the ID and the size
+	size   int64 // size of the data
+}
+
+func (e *ebmlElement) dataOffset() int64 {
+	return e.offset + e.header
+}
+
+func (e *ebmlElement) end() int64 {
+	return e.offset + e.header + e.size
+}
+
+// readEBMLElementHeader reads the header of the element starting at offset.
+// limit is the end of the parent element. Elements of unknown size, and
+// elements overflowing their parent, are cut at limit.
+func readEBMLElementHeader(r io.ReadSeeker, offset, limit int64) (*ebmlElement, error) {
+	n := limit - offset
+	if n < 2 {
+		return nil, truncatedError("ebml", offset)
+	}
+	if n > 12 {
+		n = 12
+	}
+	hdr, err := readAt(r, offset, int(n))
+	if err != nil {
+		return nil, err
+	}
+	id, idLen, ok := readVint(hdr, 4)
+	if !ok {
+		return nil, formatError("ebml", offset, "invalid element ID")
+	}
+	size, sizeLen, ok := readVint(hdr[idLen:], 8)
+	if !ok {
+		return nil, formatError("ebml", offset, "invalid element size")
+	}
+	e := &ebmlElement{
+		id:     uint32(id),
+		offset: offset,
+		header: int64(idLen + sizeLen),
+	}
+	if e.dataOffset() > limit {
+		return nil, truncatedError("ebml", offset)
+	}
+	// remove the marker bit; all ones is an unknown size
+	size &^= 1 << (7 * sizeLen)
+	if size == 1<<(7*sizeLen)-1 || size > uint64(limit-e.dataOffset()) {
+		size = uint64(limit - e.dataOffset())
+	}
+	e.size = int64(size)
+	return e, nil
+}
+
+// readVint returns the variable size integer at the start of b, with its
+// marker bit, and its length of at most maxLen bytes.
+func readVint(b []byte, maxLen int) (uint64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	n := 1
+	for b[0]&(0x80>>(n-1)) == 0 {
+		n++
+	}
+	if n > maxLen || n > len(b) {
+		return 0, 0, false
+	}
+	var v uint64
+	for _, c := range b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n, true
+}
+
+// walkEBMLElements calls fn for every element in [start, end). Returning
+// errStopWalk from fn stops the walk without an error.
+func walkEBMLElements(r io.ReadSeeker, start, end int64, fn func(e *ebmlElement) error) error {
+	for offset, n := start, 0; offset < end; n++ {
+		if n >= maxEBMLElements {
+			return limitError("ebml", offset, "too many elements")
+		}
+		e, err := readEBMLElementHeader(r, offset, end)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			if err == errStopWalk {
+				return nil
+			}
+			return err
+		}
+		offset = e.end()
+	}
+	return nil
+}
+
+// matroskaDateUTC returns the DateUTC of the Segment Info of a Matroska or
+// WebM file, the time the file was muxed or the recording started.
+func matroskaDateUTC(r io.ReadSeeker) (time.Time, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return zeroTime, err
+	}
+	var date []byte
+	err = walkEBMLElements(r, 0, size, func(segment *ebmlElement) error {
+		if segment.id != ebmlSegment {
+			return nil
+		}
+		return walkEBMLElements(r, segment.dataOffset(), segment.end(), func(e *ebmlElement) error {
+			switch e.id {
+			case ebmlInfo:
+				return walkEBMLElements(r, e.dataOffset(), e.end(), func(e *ebmlElement) error {
+					if e.id != ebmlDateUTC {
+						return nil
+					}
+					if e.size != 8 {
+						return formatError("ebml", e.offset, "invalid DateUTC size")
+					}
+					var err error
+					if date, err = readAt(r, e.dataOffset(), 8); err != nil {
+						return err
+					}
+					return errStopWalk
+				})
+			case ebmlCluster:
+				// the Info precedes the media data
+				return errStopWalk
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return zeroTime, err
+	}
+	if date == nil {
+		return zeroTime, &ErrNoOriginalTime{"no DateUTC in Matroska Segment Info"}
+	}
+	ns := int64(binary.BigEndian.Uint64(date))
+	return matroskaEpoch.Add(time.Duration(ns)).Local(), nil
+}
+
+func matroskaTimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	t, err := matroskaDateUTC(r)
+	if err != nil {
+		return nil, err
+	}
+	return []TimeCandidate{{t, SourceMatroska, "DateUTC"}}, nil
+}
@@ -0,0 +1,61 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// ebml returns an element with the ID id (marker included) and the
+// concatenated data, using an 8 byte size.
+func ebml(id uint32, data ...[]byte) []byte {
+	payload := bytes.Join(data, nil)
+	var e []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(e) > 0 {
+			e = append(e, b)
+		}
+	}
+	e = append(e, be64(uint64(len(payload))|1<<56)...)
+	return append(e, payload...)
+}
+
+func TestMatroskaOriginalTime(t *testing.T) {
+	want := time.Date(2021, 7, 8, 9, 10, 11, 0, time.UTC)
+	dateUTC := ebml(ebmlDateUTC, be64(uint64(want.Sub(matroskaEpoch))))
+	header := ebml(0x1A45DFA3, ebml(0x4282, []byte("webm")))
+	info := ebml(ebmlInfo, ebml(0x2AD7B1, []byte{0x0f, 0x42, 0x40}), dateUTC)
+	cluster := ebml(ebmlCluster, ebml(0xE7, []byte{0}))
+
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"info", bytes.Join([][]byte{header, ebml(ebmlSegment, ebml(0x114D9B74), info, cluster)}, nil)},
+		// unknown Segment size, as written by live recorders
+		{"unknown size", bytes.Join([][]byte{header, {0x18, 0x53, 0x80, 0x67, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, info}, nil)},
+	} {
+		r := bytes.NewReader(c.data)
+		typ, err := DetectMediaType(r)
+		if err != nil || typ != MediaWebM {
+			t.Errorf("%s: got type %v, %v", c.name, typ, err)
+		}
+		got, err := ReaderOriginalTime(r, int64(len(c.data)))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, want)
+		}
+	}
+
+	// the Info after the first Cluster is not searched
+	data := bytes.Join([][]byte{header, ebml(ebmlSegment, cluster, info)}, nil)
+	if _, err := ReaderOriginalTime(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("Info after Cluster: got no error")
+	}
+}
@@ -0,0 +1,332 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// QuickTime File Format: https://developer.apple.com/library/archive/documentation/QuickTime/QTFF/
+// MP4 shares the box structure, see bmff.go.
+
+// difference between Unix epoch and QuickTime epoch, in seconds
+const quickTimeEpochDelta = 2082844800
+
+// maxMOVHeaderSize limits the size of header boxes (mvhd, tkhd, ...) read
+// into memory.
+const maxMOVHeaderSize = 1 << 20
+
+// movHeader holds the fields shared by mvhd, tkhd and mdhd.
+type movHeader struct {
+	version   uint8
+	created   uint64 // seconds since the QuickTime epoch
+	modified  uint64
+	timescale uint32 // mvhd and mdhd only
+	duration  uint64
+	// tkhd only: transformation matrix and presentation size, in 16.16
+	// fixed point (u, v and w of the matrix in 2.30)
+	matrix        [9]int32
+	width, height uint32
+}
+
+func (h *movHeader) createdTime() (time.Time, bool) {
+	if h == nil || h.created <= quickTimeEpochDelta {
+		return zeroTime, false
+	}
+	return time.Unix(int64(h.created-quickTimeEpochDelta), 0), true
+}
+
+type movTrack struct {
+	tkhd *movHeader
+	mdhd *movHeader
+	// handler is the media type of the track, such as "vide" or "soun".
+	handler string
+	// format is the coding of the first sample description, such as
+	// "avc1" or "mp4a".
+	format string
+	// width and height of the first visual sample description
+	width, height int
+	samples       uint64
+}
+
+type movMovie struct {
+	mvhd   *movHeader
+	tracks []*movTrack
+	// metadata holds the UTF-8 values of moov/meta keys+ilst, such as
+	// com.apple.quicktime.creationdate.
+	metadata map[string]string
+}
+
+func movTimeCandidates(in io.ReadSeeker) ([]TimeCandidate, error) {
+	m, err := parseMOV(in)
+	if err != nil {
+		return nil, err
+	}
+	candidates := m.timeCandidates()
+	if len(candidates) == 0 {
+		return nil, &ErrNoOriginalTime{"no creation time in movie headers"}
+	}
+	return candidates, nil
+}
+
+// timeCandidates returns the creation times of m, most trusted first: mvhd
+// holds UTC and may be the transcode time, the metadata holds the local
+// capture time with its zone.
+func (m *movMovie) timeCandidates() []TimeCandidate {
+	var candidates []TimeCandidate
+	add := func(t time.Time, detail string) {
+		candidates = append(candidates, TimeCandidate{t, SourceQuickTime, detail})
+	}
+	if t, ok := m.creationDate(); ok {
+		add(t, "com.apple.quicktime.creationdate")
+	}
+	if t, ok := m.mvhd.createdTime(); ok {
+		add(t, "mvhd")
+	}
+	for _, trak := range m.tracks {
+		if t, ok := trak.tkhd.createdTime(); ok {
+			add(t, "tkhd")
+			break
+		}
+		if t, ok := trak.mdhd.createdTime(); ok {
+			add(t, "mdhd")
+			break
+		}
+	}
+	return candidates
+}
+
+// creationDate returns the com.apple.quicktime.creationdate metadata.
+func (m *movMovie) creationDate() (time.Time, bool) {
+	s, ok := m.metadata["com.apple.quicktime.creationdate"]
+	if !ok {
+		return zeroTime, false
+	}
+	t, err := parseISOTime(s)
+	return t, err == nil
+}
+
+// parseMOV finds the moov box of r and parses its movie and track headers.
+func parseMOV(r io.ReadSeeker) (*movMovie, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	moov, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &movMovie{}
+	err = walkBoxes(r, moov.dataOffset(), moov.end(), func(b *bmffBox) error {
+		var err error
+		switch b.typ {
+		case "cmov":
+			err = &ErrNoOriginalTime{"moov atom is compressed"}
+		case "mvhd":
+			m.mvhd, err = readMOVHeader(r, b)
+		case "trak":
+			var trak *movTrack
+			if trak, err = parseMOVTrack(r, b); err == nil {
+				m.tracks = append(m.tracks, trak)
+			}
+		case "meta":
+			m.metadata, err = parseMOVMetadata(r, b)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if m.mvhd == nil {
+		return nil, &ErrNoOriginalTime{"expected to find 'mvhd' header"}
+	}
+	return m, nil
+}
+
+func parseMOVTrack(r io.ReadSeeker, trak *bmffBox) (*movTrack, error) {
+	t := &movTrack{}
+	err := walkBoxes(r, trak.dataOffset(), trak.end(), func(b *bmffBox) error {
+		var err error
+		switch b.typ {
+		case "tkhd":
+			t.tkhd, err = readMOVHeader(r, b)
+		case "mdia":
+			err = walkBoxes(r, b.dataOffset(), b.end(), func(b *bmffBox) error {
+				var err error
+				switch b.typ {
+				case "mdhd":
+					t.mdhd, err = readMOVHeader(r, b)
+				case "hdlr":
+					// version and flags, pre_defined, handler_type
+					if head, err := readAt(r, b.dataOffset(), 12); err == nil {
+						t.handler = string(head[8:12])
+					}
+				case "minf":
+					// a broken sample table does not hide the dates
+					if stbl, err := findBox(r, b.dataOffset(), b.end(), "stbl"); err == nil {
+						t.parseSampleTable(r, stbl)
+					}
+				}
+				return err
+			})
+		}
+		return err
+	})
+	return t, err
+}
+
+// parseSampleTable reads the first sample description and the sample count
+// of stbl.
+func (t *movTrack) parseSampleTable(r io.ReadSeeker, stbl *bmffBox) {
+	walkBoxes(r, stbl.dataOffset(), stbl.end(), func(b *bmffBox) error {
+		switch b.typ {
+		case "stsd":
+			// version and flags, entry_count, then the first entry: size,
+			// format, reserved (6), data_reference_index (2) and for visual
+			// entries pre_defined and reserved (16), width, height
+			head, err := readAt(r, b.dataOffset(), 16)
+			if err != nil {
+				return nil
+			}
+			t.format = string(head[12:16])
+			if visual, err := readAt(r, b.dataOffset()+8+32, 4); err == nil {
+				t.width = int(binary.BigEndian.Uint16(visual[0:2]))
+				t.height = int(binary.BigEndian.Uint16(visual[2:4]))
+			}
+		case "stsz", "stz2":
+			// version and flags, sample_size (stz2: reserved and field
+			// size), sample_count
+			if head, err := readAt(r, b.dataOffset(), 12); err == nil {
+				t.samples = uint64(binary.BigEndian.Uint32(head[8:12]))
+			}
+		}
+		return nil
+	})
+}
+
+// readMOVHeader parses a version 0 (32-bit) or version 1 (64-bit) mvhd,
+// tkhd or mdhd box.
+func readMOVHeader(r io.ReadSeeker, b *bmffBox) (*movHeader, error) {
+	data, err := boxPayload(r, b, maxMOVHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	c := &bmffCursor{b: data}
+	h := &movHeader{version: c.u8()}
+	c.skip(3) // flags
+
+	var fieldSize int
+	switch h.version {
+	case 0:
+		fieldSize = 4
+	case 1:
+		fieldSize = 8
+	default:
+		return nil, formatError("mov", b.offset, fmt.Sprintf("unsupported %s version %d", b.typ, h.version))
+	}
+
+	h.created = c.uint(fieldSize)
+	h.modified = c.uint(fieldSize)
+	switch b.typ {
+	case "tkhd":
+		c.skip(8) // track_ID, reserved
+		h.duration = c.uint(fieldSize)
+	default:
+		h.timescale = c.u32()
+		h.duration = c.uint(fieldSize)
+	}
+	if c.err != nil {
+		return nil, truncatedError("mov", b.offset)
+	}
+	if b.typ == "tkhd" {
+		c.skip(16) // reserved, layer, alternate_group, volume, reserved
+		var matrix [9]int32
+		for i := range matrix {
+			matrix[i] = int32(c.u32())
+		}
+		width, height := c.u32(), c.u32()
+		if c.err == nil {
+			h.matrix, h.width, h.height = matrix, width, height
+		}
+	}
+	return h, nil
+}
+
+// parseMOVMetadata parses the keys and ilst boxes of a meta box. In
+// QuickTime files meta is a plain container, in MP4 files it is a full box.
+func parseMOVMetadata(r io.ReadSeeker, meta *bmffBox) (map[string]string, error) {
+	start := meta.dataOffset()
+	if head, err := readAt(r, start, 8); err == nil && string(head[4:8]) != "hdlr" {
+		start += 4
+	}
+
+	var keys []string
+	metadata := make(map[string]string)
+	err := walkBoxes(r, start, meta.end(), func(b *bmffBox) error {
+		switch b.typ {
+		case "keys":
+			data, err := boxPayload(r, b, maxMOVHeaderSize)
+			if err != nil {
+				return err
+			}
+			keys, err = parseMOVKeys(data)
+			return err
+		case "ilst":
+			return walkBoxes(r, b.dataOffset(), b.end(), func(item *bmffBox) error {
+				// items are named after the 1-based index of their key
+				index := int(binary.BigEndian.Uint32([]byte(item.typ)))
+				if index < 1 || index > len(keys) {
+					return nil
+				}
+				value, ok, err := readMOVDataValue(r, item)
+				if err != nil {
+					return err
+				}
+				if ok {
+					metadata[keys[index-1]] = value
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return metadata, err
+}
+
+func parseMOVKeys(data []byte) ([]string, error) {
+	c := &bmffCursor{b: data}
+	c.skip(4) // version and flags
+	count := c.u32()
+	var keys []string
+	for i := uint32(0); i < count && c.err == nil; i++ {
+		size := int(c.u32())
+		c.skip(4) // key namespace, usually "mdta"
+		keys = append(keys, string(c.next(size-8)))
+	}
+	if c.err != nil {
+		return nil, formatError("mov", -1, "invalid keys box")
+	}
+	return keys, nil
+}
+
+// readMOVDataValue returns the value of the first UTF-8 data box in item.
+func readMOVDataValue(r io.ReadSeeker, item *bmffBox) (string, bool, error) {
+	data, err := findBox(r, item.dataOffset(), item.end(), "data")
+	if err != nil {
+		return "", false, nil
+	}
+	payload, err := boxPayload(r, data, maxMOVHeaderSize)
+	if err != nil {
+		return "", false, err
+	}
+	if len(payload) < 8 {
+		return "", false, nil
+	}
+	// type indicator: 1 is UTF-8
+	if binary.BigEndian.Uint32(payload[0:4])&0xffffff != 1 {
+		return "", false, nil
+	}
+	return string(payload[8:]), true, nil
+}
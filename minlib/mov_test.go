@@ -0,0 +1,120 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func qtTime(t time.Time) uint64 {
+	return uint64(t.Unix() + quickTimeEpochDelta)
+}
+
+func mvhdV0(created time.Time) []byte {
+	return fullBox("mvhd", 0, 0, be32(uint32(qtTime(created))), be32(uint32(qtTime(created))),
+		be32(600), be32(6000), make([]byte, 80))
+}
+
+func mvhdV1(created time.Time) []byte {
+	return fullBox("mvhd", 1, 0, be64(qtTime(created)), be64(qtTime(created)),
+		be32(600), be64(6000), make([]byte, 80))
+}
+
+func tkhdV1(created time.Time) []byte {
+	return fullBox("tkhd", 1, 7, be64(qtTime(created)), be64(qtTime(created)),
+		be32(1), be32(0), be64(6000), make([]byte, 60))
+}
+
+func TestMOVOriginalTime(t *testing.T) {
+	want := time.Date(2022, 7, 1, 8, 30, 0, 0, time.UTC)
+	ftyp := box("ftyp", []byte("qt  "), be32(0))
+
+	// mdat with a 64-bit extended size
+	bigMdat := append(be32(1), "mdat"...)
+	bigMdat = append(bigMdat, be64(16+4)...)
+	bigMdat = append(bigMdat, 1, 2, 3, 4)
+
+	// trailing box with size 0 extends to the end of the file
+	trailing := append(be32(0), "free"...)
+	trailing = append(trailing, make([]byte, 10)...)
+
+	cases := []struct {
+		name string
+		data [][]byte
+	}{
+		{"v0", [][]byte{ftyp, box("moov", mvhdV0(want))}},
+		{"v1 after udta", [][]byte{ftyp, bigMdat, box("moov", box("udta"), mvhdV1(want))}},
+		{"size 0 trailing box", [][]byte{ftyp, box("moov", mvhdV1(want)), trailing}},
+		{"tkhd fallback", [][]byte{ftyp, box("moov", mvhdV0(time.Unix(-quickTimeEpochDelta, 0)),
+			box("trak", tkhdV1(want)))}},
+	}
+
+	dir := t.TempDir()
+	for _, c := range cases {
+		p := filepath.Join(dir, "clip.mov")
+		if err := os.WriteFile(p, bytes.Join(c.data, nil), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := FileOriginalTime(p)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, want)
+		}
+	}
+}
+
+func TestMOVCompressed(t *testing.T) {
+	data := box("moov", box("cmov", box("dcom", []byte("zlib"))))
+	if _, err := parseMOV(bytes.NewReader(data)); err == nil {
+		t.Error("expected an error for a compressed moov")
+	}
+}
+
+func appleMeta(creationDate string) []byte {
+	return movMeta("com.apple.quicktime.make", "Apple", "com.apple.quicktime.creationdate", creationDate)
+}
+
+// movMeta returns a meta box of mdta keys and UTF-8 values, given as key,
+// value pairs.
+func movMeta(keyValues ...string) []byte {
+	var keys, items [][]byte
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		key := keyValues[i]
+		keys = append(keys, be32(uint32(8+len(key))), []byte("mdta"), []byte(key))
+		items = append(items, box(string(be32(uint32(i/2+1))), box("data", be32(1), be32(0), []byte(keyValues[i+1]))))
+	}
+	hdlr := fullBox("hdlr", 0, 0, be32(0), []byte("mdta"), make([]byte, 13))
+	return box("meta", hdlr, fullBox("keys", 0, 0, append([][]byte{be32(uint32(len(keyValues) / 2))}, keys...)...), box("ilst", items...))
+}
+
+func TestMOVAppleCreationDate(t *testing.T) {
+	mvhd := time.Date(2019, 6, 5, 7, 19, 30, 0, time.UTC)
+	data := bytes.Join([][]byte{
+		box("ftyp", []byte("qt  "), be32(0)),
+		box("moov", mvhdV0(mvhd), appleMeta("2019-06-05T15:19:24+0800")),
+	}, nil)
+	p := filepath.Join(t.TempDir(), "IMG_0001.MOV")
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FileOriginalTime(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2019, 6, 5, 15, 19, 24, 0, time.FixedZone("", 8*3600))
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, offset := got.Zone(); offset != 8*3600 {
+		t.Errorf("unexpected zone offset %d", offset)
+	}
+}
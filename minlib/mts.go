@@ -0,0 +1,210 @@
+package minlib
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
+// AVCHD (MTS, M2TS) recording date
+// The camcorders store a Modified Digital Video Pack Metadata (MDPM) block
+// in an H.264 SEI user_data_unregistered message of the first access
+// units: a 16 byte UUID, "MDPM", the number of tags, then tags of 5 bytes,
+// [id:1][data:4].
+// Tag 0x18: time zone, year (2 BCD bytes), month (BCD)
+// Tag 0x19: day, hour, minute, second (BCD)
+// Time zone byte: sign in bit 0x20, hours in bits 0x1e, half an hour in
+// bit 0x01, daylight saving time in bit 0x40.
+// https://exiftool.org/TagNames/H264.html
+
+// mdpmUUID precedes the MDPM signature in the SEI message.
+const mdpmUUID = "\x17\xee\x8c\x60\xf8\x4d\x11\xd9\x8c\xd6\x08\x00\x20\x0c\x9a\x66"
+
+// maxTSScanSize limits the bytes of transport stream searched for the
+// MDPM block, which comes with the first video frames.
+const maxTSScanSize = 8 << 20
+
+// maxTSStreamBuffer limits the video data kept per packet identifier.
+const maxTSStreamBuffer = 1 << 20
+
+// mtsTimeCandidates returns the MDPM recording date of an AVCHD stream.
+func mtsTimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	t, err := mtsRecordingTime(r)
+	if err != nil {
+		return nil, err
+	}
+	return []TimeCandidate{{t, SourceMPEGTS, "MDPM"}}, nil
+}
+
+// mtsRecordingTime collects the payload of the H.264 video streams of r,
+// without the PES headers, and decodes the first MDPM block found.
+func mtsRecordingTime(r io.ReadSeeker) (time.Time, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return zeroTime, err
+	}
+	br := bufio.NewReader(io.LimitReader(r, maxTSScanSize))
+	head, err := br.Peek(2*192 + 1)
+	if err != nil && len(head) < 188 {
+		return zeroTime, truncatedError("mpegts", 0)
+	}
+	// M2TS packets start with a 4 byte timecode
+	var packetSize, start int
+	switch {
+	case head[0] == 0x47 && (len(head) <= 188 || head[188] == 0x47):
+		packetSize, start = 188, 0
+	case len(head) > 196 && head[4] == 0x47 && head[196] == 0x47:
+		packetSize, start = 192, 4
+	default:
+		return zeroTime, formatError("mpegts", 0, "no sync byte")
+	}
+
+	streams := make(map[uint16]*tsStream)
+	packet := make([]byte, packetSize)
+	for offset := int64(0); ; offset += int64(packetSize) {
+		if _, err := io.ReadFull(br, packet); err != nil {
+			break
+		}
+		p := packet[start:]
+		if p[0] != 0x47 {
+			return zeroTime, formatError("mpegts", offset, "lost sync")
+		}
+		pid := uint16(p[1]&0x1f)<<8 | uint16(p[2])
+		payload := p[4:]
+		switch p[3] >> 4 & 3 {
+		case 1:
+		case 3:
+			// adaptation field
+			n := int(payload[0]) + 1
+			if n > len(payload) {
+				continue
+			}
+			payload = payload[n:]
+		default:
+			continue
+		}
+
+		s := streams[pid]
+		if p[1]&0x40 != 0 {
+			// payload unit start
+			es, ok := pesPayload(payload)
+			if !ok {
+				continue
+			}
+			if s == nil {
+				s = &tsStream{}
+				streams[pid] = s
+			}
+			payload = es
+		}
+		if s == nil || len(s.data) >= maxTSStreamBuffer {
+			continue
+		}
+		s.data = append(s.data, payload...)
+		t, err := s.findMDPMTime()
+		if err == nil {
+			return t, nil
+		}
+		if _, ok := err.(*ErrNoOriginalTime); !ok && !errors.Is(err, ErrTruncated) {
+			return zeroTime, err
+		}
+	}
+	return zeroTime, &ErrNoOriginalTime{"no MDPM recording date"}
+}
+
+// tsStream is the video data of a packet identifier.
+type tsStream struct {
+	data []byte
+	// searched is where the search for the MDPM block resumes.
+	searched int
+}
+
+// pesPayload returns the elementary stream data of a PES packet start of a
+// video stream. ok is false for other streams.
+func pesPayload(b []byte) (es []byte, ok bool) {
+	if len(b) < 9 || b[0] != 0 || b[1] != 0 || b[2] != 1 || b[3]&0xf0 != 0xe0 {
+		return nil, false
+	}
+	n := 9 + int(b[8])
+	if n > len(b) {
+		return nil, false
+	}
+	return b[n:], true
+}
+
+// findMDPMTime decodes the date of the MDPM block in the stream data. The
+// block is complete once the tags it announces are there; a truncated
+// block is decoded again when more data arrives.
+func (s *tsStream) findMDPMTime() (time.Time, error) {
+	signature := []byte(mdpmUUID + "MDPM")
+	i := bytes.Index(s.data[s.searched:], signature)
+	if i < 0 {
+		if n := len(s.data) - len(signature) + 1; n > s.searched {
+			s.searched = n
+		}
+		return zeroTime, &ErrNoOriginalTime{"no MDPM block"}
+	}
+	s.searched += i
+	block := s.data[s.searched+len(signature):]
+	// 255 tags, with room for the emulation prevention bytes
+	if len(block) > 2048 {
+		block = block[:2048]
+	}
+	return parseMDPMTime(unescapeRBSP(block))
+}
+
+// parseMDPMTime decodes the date of the MDPM tags b.
+func parseMDPMTime(b []byte) (time.Time, error) {
+	if len(b) < 1 || len(b) < 1+5*int(b[0]) {
+		return zeroTime, truncatedError("mpegts", -1)
+	}
+	var date, clock []byte
+	for n, tags := int(b[0]), b[1:]; n > 0; n, tags = n-1, tags[5:] {
+		switch tags[0] {
+		case 0x18:
+			date = tags[1:5]
+		case 0x19:
+			clock = tags[1:5]
+		}
+	}
+	if date == nil || clock == nil {
+		return zeroTime, formatError("mpegts", -1, "no date in MDPM block")
+	}
+
+	zone := date[0]
+	offset := int(zone>>1&0x0f)*3600 + int(zone&0x01)*1800
+	if zone&0x20 != 0 {
+		offset = -offset
+	}
+	if zone&0x40 != 0 {
+		offset += 3600
+	}
+	year, month, day := bcd(date[1])*100+bcd(date[2]), bcd(date[3]), bcd(clock[0])
+	hour, minute, sec := bcd(clock[1]), bcd(clock[2]), bcd(clock[3])
+	t := time.Date(year, time.Month(month), day, hour, minute, sec, 0, time.FixedZone("", offset))
+	if int(t.Month()) != month || t.Day() != day || t.Hour() != hour || t.Minute() != minute || t.Second() != sec {
+		return zeroTime, formatError("mpegts", -1, "invalid MDPM date")
+	}
+	return t, nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes of H.264 NAL unit
+// data: 00 00 03 stands for 00 00.
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
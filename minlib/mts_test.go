@@ -0,0 +1,122 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tsPackets splits the PES packet of a video stream into 188 byte transport
+// stream packets of pid, padded with adaptation fields. With m2ts, every
+// packet is preceded by a 4 byte timecode.
+func tsPackets(pid uint16, pes []byte, m2ts bool) []byte {
+	var out []byte
+	for first := true; len(pes) > 0; first = false {
+		n := len(pes)
+		if n > 184 {
+			n = 184
+		}
+		if m2ts {
+			out = append(out, 0, 0, 0, 0)
+		}
+		flags := byte(0)
+		if first {
+			flags = 0x40
+		}
+		out = append(out, 0x47, flags|byte(pid>>8), byte(pid))
+		if n == 184 {
+			out = append(out, 0x10)
+		} else {
+			// adaptation field of stuffing bytes
+			out = append(out, 0x30, byte(183-n))
+			if n < 183 {
+				out = append(out, 0x00)
+				out = append(out, bytes.Repeat([]byte{0xff}, 182-n)...)
+			}
+		}
+		out = append(out, pes[:n]...)
+		pes = pes[n:]
+	}
+	return out
+}
+
+// mdpmPES returns a PES packet of an H.264 access unit with an SEI message
+// holding the MDPM block of tags.
+func mdpmPES(tags ...[]byte) []byte {
+	sei := append([]byte(mdpmUUID+"MDPM"), byte(len(tags)))
+	sei = append(sei, bytes.Join(tags, nil)...)
+	// emulation prevention of the zeros of the tags
+	var nal []byte
+	zeros := 0
+	for _, c := range sei {
+		if zeros == 2 && c <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nal = append(nal, c)
+	}
+	es := append([]byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 0, 1, 0x06, 0x05, byte(len(sei))}, nal...)
+	es = append(es, 0x80)
+	return append([]byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5, 0x21, 0, 1, 0, 1}, es...)
+}
+
+func TestMTSOriginalTime(t *testing.T) {
+	// +09:00, 2012-03-04 05:06:07
+	pes := mdpmPES(
+		[]byte{0x13, 0, 0, 0, 0},
+		[]byte{0x18, 0x12, 0x20, 0x12, 0x03},
+		[]byte{0x19, 0x04, 0x05, 0x06, 0x07},
+		[]byte{0x70, 0, 0, 0, 0},
+	)
+	want := time.Date(2012, 3, 4, 5, 6, 7, 0, time.FixedZone("", 9*3600))
+	pat := tsPackets(0, []byte{0, 0, 0xb0, 0x0d}, false)
+	audio := func(m2ts bool) []byte {
+		return tsPackets(0x1100, []byte{0, 0, 1, 0xc0, 0, 0, 0x80, 0, 0}, m2ts)
+	}
+
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"00000.MTS", bytes.Join([][]byte{pat, audio(false), tsPackets(0x1011, pes, false), audio(false)}, nil)},
+		{"00001.m2ts", bytes.Join([][]byte{tsPackets(0x1011, pes, true), audio(true), audio(true)}, nil)},
+	} {
+		p := filepath.Join(t.TempDir(), c.name)
+		if err := os.WriteFile(p, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := FileOriginalTime(p)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, want)
+		}
+		if _, offset := got.Zone(); offset != 9*3600 {
+			t.Errorf("%s: unexpected zone offset %d", c.name, offset)
+		}
+	}
+
+	// daylight saving time, west of UTC: -05:00 + 1h
+	got, err := parseMDPMTime([]byte{2, 0x18, 0x6a, 0x20, 0x19, 0x07, 0x19, 0x31, 0x23, 0x59, 0x59})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := got.Zone(); offset != -4*3600 || got.Day() != 31 {
+		t.Errorf("unexpected time %v", got)
+	}
+	if _, err := parseMDPMTime([]byte{2, 0x18, 0, 0x20, 0x19, 0x13, 0x19, 0x31, 0x23, 0x59, 0x59}); err == nil {
+		t.Error("month 13: got no error")
+	}
+}
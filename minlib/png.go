@@ -0,0 +1,249 @@
+package minlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// PNG: https://www.w3.org/TR/png/
+// After the 8 byte signature, chunks are laid out as [length:4][type:4]
+// [data][crc:4], big endian. The eXIf chunk holds a TIFF stream; some
+// writers keep the "Exif\0\0" prefix of JPEG. tIME is the time of the last
+// modification in UTC: [year:2][month][day][hour][minute][second].
+// Text chunks start with a keyword ended by a null byte. tEXt holds Latin-1
+// text, zTXt [compression method:1] and zlib compressed text, iTXt
+// [compression flag:1][compression method:1][language]\0[translated
+// keyword]\0 and UTF-8 text, compressed if the flag is set. The
+// "Creation Time" keyword holds a date, preferably in RFC 1123 format, the
+// "XML:com.adobe.xmp" keyword of iTXt the XMP packet.
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// maxPNGChunks limits the chunks visited in a PNG file.
+const maxPNGChunks = 1 << 16
+
+// maxExifChunkSize limits the size of the PNG eXIf and WebP EXIF chunks.
+const maxExifChunkSize = 16 << 20
+
+// PNG text keywords
+const (
+	pngCreationTime = "Creation Time"
+	pngXMP          = "XML:com.adobe.xmp"
+)
+
+// pngTimeLayouts are the formats of the Creation Time text besides ISO
+// 8601. Times without a zone are local.
+var pngTimeLayouts = []string{
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006:01:02 15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// pngMetadata holds the metadata chunks of a PNG file. Empty fields were
+// not found.
+type pngMetadata struct {
+	exif         []byte // TIFF stream of the eXIf chunk
+	xmp          []byte
+	creationTime string
+	modTime      time.Time // tIME
+}
+
+// parsePNG reads the metadata chunks of a PNG file up to IEND. The walk
+// stops at a chunk cut by the end of a truncated file, keeping the chunks
+// read so far.
+func parsePNG(r io.ReadSeeker) (*pngMetadata, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readAt(r, 0, len(pngSignature))
+	if err != nil {
+		return nil, err
+	}
+	if string(sig) != pngSignature {
+		return nil, formatError("png", 0, "not a PNG file")
+	}
+
+	m := &pngMetadata{}
+	for offset, n := int64(len(pngSignature)), 0; size-offset >= 12; n++ {
+		if n >= maxPNGChunks {
+			return nil, limitError("png", offset, "too many chunks")
+		}
+		hdr, err := readAt(r, offset, 8)
+		if err != nil {
+			return nil, err
+		}
+		length := int64(binary.BigEndian.Uint32(hdr))
+		if length > size-offset-12 {
+			break
+		}
+		data := offset + 8
+		switch string(hdr[4:8]) {
+		case "IEND":
+			return m, nil
+		case "eXIf":
+			if m.exif != nil {
+				break
+			}
+			if length > maxExifChunkSize {
+				return nil, limitError("png", offset, "eXIf chunk size")
+			}
+			b, err := readAt(r, data, int(length))
+			if err != nil {
+				return nil, err
+			}
+			m.exif = bytes.TrimPrefix(b, []byte(exifMarker))
+		case "tIME":
+			if length != 7 {
+				break
+			}
+			b, err := readAt(r, data, 7)
+			if err != nil {
+				return nil, err
+			}
+			if b[2] >= 1 && b[2] <= 12 && b[3] >= 1 && b[3] <= 31 && b[4] < 24 && b[5] < 60 && b[6] <= 60 {
+				m.modTime = time.Date(int(binary.BigEndian.Uint16(b)), time.Month(b[2]), int(b[3]),
+					int(b[4]), int(b[5]), int(b[6]), 0, time.UTC)
+			}
+		case "tEXt", "zTXt", "iTXt":
+			if err := m.readText(r, string(hdr[4:8]), data, length); err != nil {
+				return nil, err
+			}
+		}
+		offset = data + length + 4
+	}
+	return m, nil
+}
+
+// readText reads the text chunk at offset if its keyword is Creation Time
+// or XMP. Texts which cannot be decoded are skipped.
+func (m *pngMetadata) readText(r io.ReadSeeker, typ string, offset, length int64) error {
+	head, err := readAt(r, offset, int(minInt64(length, int64(len(pngXMP)+1))))
+	if err != nil {
+		return err
+	}
+	var keyword string
+	switch {
+	case bytes.HasPrefix(head, []byte(pngCreationTime+"\x00")):
+		keyword = pngCreationTime
+		if m.creationTime != "" {
+			return nil
+		}
+	case bytes.HasPrefix(head, []byte(pngXMP+"\x00")):
+		keyword = pngXMP
+		if m.xmp != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if length > maxXMPSize {
+		return limitError("png", offset, typ+" chunk size")
+	}
+	data, err := readAt(r, offset, int(length))
+	if err != nil {
+		return err
+	}
+	text, err := pngText(typ, data[len(keyword)+1:])
+	if err != nil {
+		return nil
+	}
+	if keyword == pngXMP {
+		m.xmp = text
+	} else {
+		m.creationTime = string(bytes.TrimRight(text, "\x00\r\n "))
+	}
+	return nil
+}
+
+// pngText returns the text of a tEXt, zTXt or iTXt chunk following the
+// keyword.
+func pngText(typ string, data []byte) ([]byte, error) {
+	compressed := false
+	switch typ {
+	case "zTXt":
+		if len(data) < 1 {
+			return nil, errors.New("png: empty zTXt chunk")
+		}
+		compressed, data = true, data[1:]
+	case "iTXt":
+		if len(data) < 2 {
+			return nil, errors.New("png: empty iTXt chunk")
+		}
+		compressed, data = data[0] != 0, data[2:]
+		// skip the language tag and the translated keyword
+		for i := 0; i < 2; i++ {
+			end := bytes.IndexByte(data, 0)
+			if end < 0 {
+				return nil, errors.New("png: invalid iTXt chunk")
+			}
+			data = data[end+1:]
+		}
+	}
+	if !compressed {
+		return data, nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	text, err := io.ReadAll(io.LimitReader(zr, maxXMPSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(text) > maxXMPSize {
+		return nil, limitError("png", 0, "compressed text size")
+	}
+	return text, nil
+}
+
+// decodeExifChunk decodes the TIFF stream of a PNG eXIf or WebP EXIF chunk.
+func decodeExifChunk(tiff []byte) (*Exif, error) {
+	if tiff == nil {
+		return nil, errors.New("no Exif chunk")
+	}
+	return parseTIFF(bytes.NewReader(tiff), 0)
+}
+
+// parsedPNG returns the metadata chunks of the PNG file m, parsed on the
+// first call.
+func (m *mediaReader) parsedPNG() (*pngMetadata, error) {
+	if m.png == nil && m.pngErr == nil {
+		m.png, m.pngErr = parsePNG(m.reader())
+	}
+	return m.png, m.pngErr
+}
+
+// timeCandidates returns the Exif dates of a PNG file, then its Creation
+// Time text. The tIME chunk is left to modificationTimes.
+func (m *pngMetadata) timeCandidates() ([]TimeCandidate, error) {
+	var candidates []TimeCandidate
+	if x, err := decodeExifChunk(m.exif); err == nil {
+		candidates = x.timeCandidates()
+	}
+	if m.creationTime != "" {
+		if t, err := parsePNGTime(m.creationTime); err == nil {
+			candidates = append(candidates, TimeCandidate{t, SourcePNG, pngCreationTime})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, &ErrNoOriginalTime{"no date in PNG"}
+	}
+	return candidates, nil
+}
+
+// parsePNGTime parses the Creation Time text of a PNG file.
+func parsePNGTime(s string) (time.Time, error) {
+	for _, layout := range pngTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return parseISOTime(s)
+}
@@ -0,0 +1,159 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildPNG returns a PNG file of a 1x1 image holding the chunks before its
+// image data.
+func buildPNG(chunks ...[]byte) []byte {
+	return bytes.Join([][]byte{
+		[]byte(pngSignature),
+		pngChunk("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0}),
+		bytes.Join(chunks, nil),
+		pngChunk("IDAT", []byte("compressed pixels")),
+		pngChunk("IEND", nil),
+	}, nil)
+}
+
+func zlibCompress(data string) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(data))
+	w.Close()
+	return b.Bytes()
+}
+
+func TestPNGMetadata(t *testing.T) {
+	le := binary.LittleEndian
+	exifTime := time.Date(2021, 3, 4, 10, 11, 12, 0, time.Local)
+	modTime := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	xmpTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.Local)
+	tIME := []byte{0x07, 0xe6, 1, 2, 3, 4, 5}
+
+	cases := []struct {
+		name string
+		data []byte
+		want []TimeCandidate
+	}{
+		{"exif.png", buildPNG(pngChunk("eXIf", testExifTIFF(le, "2021:03:04 10:11:12")), pngChunk("tIME", tIME)),
+			[]TimeCandidate{{exifTime, SourceExif, "DateTimeOriginal"}, {modTime, SourceModified, "tIME"}}},
+		{"prefixed.png", buildPNG(pngChunk("eXIf", append([]byte(exifMarker), testExifTIFF(binary.BigEndian, "2021:03:04 10:11:12")...))),
+			[]TimeCandidate{{exifTime, SourceExif, "DateTimeOriginal"}}},
+		{"rfc1123.png", buildPNG(pngChunk("tEXt", []byte("Creation Time\x00Sun, 2 Jan 2022 03:04:05 +0100"))),
+			[]TimeCandidate{{modTime.Add(-time.Hour), SourcePNG, "Creation Time"}}},
+		{"itxt.png", buildPNG(pngChunk("tIME", tIME), pngChunk("iTXt", append([]byte("Creation Time\x00\x01\x00en\x00\x00"),
+			zlibCompress("2021-03-04T10:11:12")...))),
+			[]TimeCandidate{{exifTime, SourcePNG, "Creation Time"}, {modTime, SourceModified, "tIME"}}},
+		// the tIME chunk of an edited file ranks after XMP and the file name
+		{"edited.png", buildPNG(pngChunk("tIME", tIME), pngChunk("iTXt", []byte(pngXMP+"\x00\x00\x00\x00\x00"+testXMPElements))),
+			[]TimeCandidate{{xmpTime, SourceXMP, "exif:DateTimeOriginal"}, {modTime, SourceModified, "tIME"}}},
+		{"IMG_20210304_101112.png", buildPNG(pngChunk("tIME", tIME)),
+			[]TimeCandidate{{exifTime, SourceFilename, "android"}, {modTime, SourceModified, "tIME"}}},
+	}
+	dir := t.TempDir()
+	for _, c := range cases {
+		p := filepath.Join(dir, c.name)
+		if err := os.WriteFile(p, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := ResolveFileTime(p)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if c.want[0].Source == SourceExif && r.Confidence != ConfidenceHigh {
+			t.Errorf("%s: confidence %v, want high", c.name, r.Confidence)
+		}
+		got := r.Candidates[:len(r.Candidates)-1] // without the mtime
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Time.Equal(c.want[i].Time) || got[i].Source != c.want[i].Source || got[i].Detail != c.want[i].Detail {
+				t.Errorf("%s: got %v, want %v", c.name, got[i], c.want[i])
+			}
+		}
+	}
+
+	if got, err := FileOriginalTime(filepath.Join(dir, "edited.png")); err != nil || !got.Equal(xmpTime) {
+		t.Errorf("edited.png original time: got %v, %v, want %v", got, err, xmpTime)
+	}
+	if r, err := ResolveFileTime(filepath.Join(dir, "IMG_20210304_101112.png")); err != nil || r.Confidence != ConfidenceMedium {
+		t.Errorf("dated PNG name: got %+v, %v, want medium confidence", r, err)
+	}
+
+	// compressed XMP, and a truncated file keeping the chunks before the cut
+	data := buildPNG(pngChunk("iTXt", append([]byte(pngXMP+"\x00\x01\x00\x00\x00"), zlibCompress(testXMPElements)...)),
+		pngChunk("eXIf", testExifTIFF(le, "2021:03:04 10:11:12")))
+	data = data[:len(data)-20]
+	x, err := ReaderXMP(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2017, 1, 2, 3, 4, 5, 0, time.Local); !x.DateTimeOriginal.Equal(want) {
+		t.Errorf("XMP DateTimeOriginal: got %v, want %v", x.DateTimeOriginal, want)
+	}
+	e, err := ReaderExif(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Make != "Apple" {
+		t.Errorf("Exif Make: got %q, want Apple", e.Make)
+	}
+
+	data = buildPNG(pngChunk("tIME", tIME))
+	if _, err := ReaderOriginalTime(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("PNG with a tIME chunk only: got no error")
+	}
+
+	data = buildPNG(pngChunk("tEXt", []byte("Comment\x00no date")))
+	if _, err := ReaderOriginalTime(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("PNG without date: got no error")
+	}
+}
+
+// countingReaderAt counts the reads of r.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	reads int
+}
+
+func (c *countingReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	c.reads++
+	return c.r.ReadAt(b, off)
+}
+
+func TestPNGParsedOnce(t *testing.T) {
+	data := buildPNG(pngChunk("tIME", []byte{0x07, 0xe6, 1, 2, 3, 4, 5}),
+		pngChunk("iTXt", []byte(pngXMP+"\x00\x00\x00\x00\x00"+testXMPElements)))
+	r := &countingReaderAt{r: bytes.NewReader(data)}
+	m, err := newMediaReader(r, int64(len(data)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.timeCandidates(); err == nil {
+		t.Error("PNG without original time: got candidates")
+	}
+	reads := r.reads
+	if x, err := m.xmp(); err != nil || x.DateTimeOriginal.IsZero() {
+		t.Errorf("XMP: got %+v, %v", x, err)
+	}
+	if got := m.modificationTimes(); len(got) != 1 || got[0].Source != SourceModified {
+		t.Errorf("modification times: got %v", got)
+	}
+	if r.reads != reads {
+		t.Errorf("the PNG was read %d more times", r.reads-reads)
+	}
+}
@@ -0,0 +1,343 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// Embedded JPEG images
+// JPEG, TIFF: IFD1 JPEGInterchangeFormat (0x0201) and length (0x0202)
+// ARW, PEF: IFD0 JPEGInterchangeFormat
+// CR2: IFD0 StripOffsets (0x0111) with old-style JPEG compression
+// NEF, DNG: SubIFDs (0x014a) with NewSubfileType (0x00fe) reduced resolution
+// RW2: JpgFromRaw (0x002e)
+// RAF: the JPEG referenced by the header
+// CR3: THMB box in the Canon metadata uuid box of moov, PRVW box in the
+// preview uuid box
+
+// Canon CR3 preview box at the top level
+const cr3PreviewUUID = "eaf42b5e1c984b88b9fbb7dc406e4d16"
+
+// maxPreviewSize limits the size of previews loaded into memory.
+const maxPreviewSize = 32 << 20
+
+// maxSubIFDs limits the SubIFDs searched for previews.
+const maxSubIFDs = 16
+
+// Preview is a JPEG image embedded in a media file.
+type Preview struct {
+	Data []byte
+	// Width and Height are read from the JPEG frame header.
+	Width, Height int
+	// Orientation is the Exif orientation of the main image (1 to 8, 0 if
+	// unknown). The previews are stored unrotated, like the main image.
+	Orientation int
+	// Source names where the preview was found, such as "IFD1",
+	// "SubIFD0", "JpgFromRaw" or "PRVW".
+	Source string
+}
+
+// FilePreviews returns the previews embedded in file p, smallest first.
+func FilePreviews(p string) ([]*Preview, error) {
+	return filePreviews(osFS{}, p)
+}
+
+// FSPreviews returns the previews embedded in the file name of fsys,
+// smallest first.
+func FSPreviews(fsys fs.FS, name string) ([]*Preview, error) {
+	return filePreviews(ioFS{fsys}, name)
+}
+
+// ReaderPreviews returns the previews embedded in the size bytes of r,
+// smallest first.
+func ReaderPreviews(r io.ReaderAt, size int64) ([]*Preview, error) {
+	m, err := newMediaReader(r, size, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.previews()
+}
+
+// FileThumbnail returns the smallest preview embedded in file p.
+func FileThumbnail(p string) (*Preview, error) {
+	previews, err := FilePreviews(p)
+	if err != nil {
+		return nil, err
+	}
+	return previews[0], nil
+}
+
+// FilePreview returns the largest preview embedded in file p.
+func FilePreview(p string) (*Preview, error) {
+	previews, err := FilePreviews(p)
+	if err != nil {
+		return nil, err
+	}
+	return previews[len(previews)-1], nil
+}
+
+func filePreviews(fsys fileSystem, name string) ([]*Preview, error) {
+	m, err := openMedia(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return m.previews()
+}
+
+// previews returns the previews of m, smallest first. It never returns an
+// empty slice without an error.
+func (m *mediaReader) previews() ([]*Preview, error) {
+	var previews []*Preview
+	var err error
+	switch m.typ {
+	case MediaJPEG:
+		var offset int64
+		if offset, err = jpegExifOffset(m.reader()); err == nil {
+			previews, err = tiffPreviews(io.NewSectionReader(m.ra, offset, m.size-offset))
+		}
+	case MediaTIFF:
+		previews, err = tiffPreviews(m.reader())
+	case MediaRAF:
+		previews, err = rafPreviews(m.reader())
+	case MediaCR3:
+		previews, err = cr3Previews(m.reader())
+	default:
+		err = fmt.Errorf("previews of %s files are not supported", m.typ)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(previews) == 0 {
+		return nil, errors.New("no embedded preview")
+	}
+
+	orientation := 0
+	if x, err := m.exif(); err == nil {
+		orientation = x.Orientation
+	}
+	for _, p := range previews {
+		p.Orientation = orientation
+	}
+	sort.SliceStable(previews, func(i, j int) bool {
+		pi, pj := previews[i], previews[j]
+		if pi.Width*pi.Height != pj.Width*pj.Height {
+			return pi.Width*pi.Height < pj.Width*pj.Height
+		}
+		return len(pi.Data) < len(pj.Data)
+	})
+	return previews, nil
+}
+
+// newPreview reads the JPEG image at offset in r. It returns nil when the
+// data is not a JPEG image a viewer can decode, such as the lossless JPEG
+// raw data of some DNG files.
+func newPreview(r io.ReadSeeker, offset, length int64, source string) *Preview {
+	if offset <= 0 || length < 4 || length > maxPreviewSize {
+		return nil
+	}
+	if size, err := streamSize(r); err != nil || offset+length > size {
+		return nil
+	}
+	data, err := readAt(r, offset, int(length))
+	if err != nil {
+		return nil
+	}
+	w, h, ok := jpegDimensions(data)
+	if !ok {
+		return nil
+	}
+	return &Preview{Data: data, Width: w, Height: h, Source: source}
+}
+
+// jpegDimensions returns the size of the JPEG image data from its baseline,
+// extended or progressive frame header.
+func jpegDimensions(data []byte) (int, int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, 0, false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 0, 0, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// markers without a payload
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			return 0, 0, false
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 {
+			return 0, 0, false
+		}
+		switch marker {
+		case 0xC0, 0xC1, 0xC2:
+			if i+9 > len(data) {
+				return 0, 0, false
+			}
+			h := int(binary.BigEndian.Uint16(data[i+5:]))
+			w := int(binary.BigEndian.Uint16(data[i+7:]))
+			return w, h, w > 0 && h > 0
+		case 0xC3, 0xC5, 0xC6, 0xC7, 0xC9, 0xCA, 0xCB, 0xCD, 0xCE, 0xCF:
+			// lossless, hierarchical or arithmetic coding
+			return 0, 0, false
+		}
+		i += 2 + size
+	}
+	return 0, 0, false
+}
+
+// tiffPreviews returns the JPEG images referenced by IFD0, IFD1 and the
+// SubIFDs of the TIFF stream r.
+func tiffPreviews(r io.ReadSeeker) ([]*Preview, error) {
+	x, err := parseTIFF(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var previews []*Preview
+	add := func(p *Preview) {
+		if p != nil {
+			previews = append(previews, p)
+		}
+	}
+	add(ifdPreview(r, x, IFD0, "IFD0", false))
+	add(ifdPreview(r, x, IFD1, "IFD1", false))
+	if t := x.Tag(IFD0, 0x002e); t != nil {
+		add(newPreview(r, t.Offset, int64(t.Count), "JpgFromRaw"))
+	}
+	if t := x.Tag(IFD0, 0x014a); t != nil {
+		for i := 0; i < int(t.Count) && i < maxSubIFDs; i++ {
+			offset, err := t.Int(i)
+			if err != nil {
+				break
+			}
+			sub, err := parseSubIFD(r, x.ByteOrder, offset)
+			if err != nil {
+				continue
+			}
+			add(ifdPreview(r, sub, IFD0, fmt.Sprintf("SubIFD%d", i), true))
+		}
+	}
+	return previews, nil
+}
+
+// parseSubIFD decodes the IFD at offset of the TIFF stream r as IFD0 of a
+// new Exif.
+func parseSubIFD(r io.ReadSeeker, order binary.ByteOrder, offset int64) (*Exif, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &tiffReader{
+		r:       r,
+		size:    size,
+		endian:  order,
+		visited: make(map[int64]bool),
+		exif:    newExif(order),
+	}
+	if _, err := t.parseDirEntry(offset, IFD0); err != nil {
+		return nil, err
+	}
+	return t.exif, nil
+}
+
+// ifdPreview returns the JPEG image of ifd, referenced either by
+// JPEGInterchangeFormat or by a single JPEG compressed strip. Strips of
+// SubIFDs must be flagged as reduced resolution images.
+func ifdPreview(r io.ReadSeeker, x *Exif, ifd IFD, source string, subIFD bool) *Preview {
+	if offset, length := x.int(ifd, 0x0201), x.int(ifd, 0x0202); offset > 0 {
+		return newPreview(r, int64(offset), int64(length), source)
+	}
+	offsets, counts := x.Tag(ifd, 0x0111), x.Tag(ifd, 0x0117)
+	if offsets == nil || counts == nil || offsets.Count != 1 {
+		return nil
+	}
+	switch compression := x.int(ifd, 0x0103); {
+	case compression == 6:
+	case compression == 7 && subIFD && x.int(ifd, 0x00fe)&1 == 1:
+	default:
+		return nil
+	}
+	offset, err1 := offsets.Int(0)
+	length, err2 := counts.Int(0)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	return newPreview(r, offset, length, source)
+}
+
+// rafPreviews returns the JPEG image referenced by the RAF header.
+func rafPreviews(r io.ReadSeeker) ([]*Preview, error) {
+	header, err := readAt(r, 0, 92)
+	if err != nil {
+		return nil, err
+	}
+	offset := int64(binary.BigEndian.Uint32(header[84:88]))
+	length := int64(binary.BigEndian.Uint32(header[88:92]))
+	var previews []*Preview
+	if p := newPreview(r, offset, length, "RAF"); p != nil {
+		previews = append(previews, p)
+	}
+	return previews, nil
+}
+
+// cr3Previews returns the images of the THMB and PRVW boxes of a Canon CR3
+// file. Both boxes have the JPEG size at a fixed position and the JPEG data
+// at offset 16 of their payload.
+func cr3Previews(r io.ReadSeeker) ([]*Preview, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	var previews []*Preview
+	add := func(b *bmffBox, sizeOffset int64) error {
+		head, err := readAt(r, b.dataOffset(), 16)
+		if err != nil {
+			return err
+		}
+		length := int64(binary.BigEndian.Uint32(head[sizeOffset:]))
+		if length > b.end()-b.dataOffset()-16 {
+			return nil
+		}
+		if p := newPreview(r, b.dataOffset()+16, length, b.typ); p != nil {
+			previews = append(previews, p)
+		}
+		return nil
+	}
+
+	err = walkBoxes(r, 0, size, func(top *bmffBox) error {
+		switch {
+		case top.typ == "moov":
+			return walkBoxes(r, top.dataOffset(), top.end(), func(b *bmffBox) error {
+				if b.typ != "uuid" || b.uuid != cr3MetadataUUID {
+					return nil
+				}
+				thmb, err := findBox(r, b.dataOffset(), b.end(), "THMB")
+				if err != nil {
+					return nil
+				}
+				return add(thmb, 8)
+			})
+		case top.typ == "uuid" && top.uuid == cr3PreviewUUID:
+			// 8 unknown bytes precede the PRVW box
+			prvw, err := findBox(r, top.dataOffset()+8, top.end(), "PRVW")
+			if err != nil {
+				return nil
+			}
+			return add(prvw, 12)
+		}
+		return nil
+	})
+	return previews, err
+}
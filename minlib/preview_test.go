@@ -0,0 +1,159 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPreviewJPEG returns a JPEG stream with a baseline frame header.
+func testPreviewJPEG(w, h uint16) []byte {
+	sof := []byte{8, byte(h >> 8), byte(h), byte(w >> 8), byte(w), 1, 1, 0x11, 0}
+	return buildJPEG(jpegSegment(0xC0, sof))
+}
+
+// buildTIFFWithData calls build with the offset of the data appended to the
+// TIFF stream it returns. The size of the stream must not depend on the
+// offset.
+func buildTIFFWithData(build func(offset uint32) []byte, data []byte) []byte {
+	offset := uint32(len(build(0)))
+	return append(build(offset), data...)
+}
+
+func TestJPEGThumbnail(t *testing.T) {
+	be := binary.BigEndian
+	thumb := testPreviewJPEG(160, 120)
+	tiff := buildTIFFWithData(func(offset uint32) []byte {
+		return buildTIFF(be, &tiffIFD{
+			entries: []tiffEntry{shortTag(be, 0x0112, 6)},
+			next: &tiffIFD{entries: []tiffEntry{
+				longTag(be, 0x0201, offset),
+				longTag(be, 0x0202, uint32(len(thumb))),
+			}},
+		})
+	}, thumb)
+	p := filepath.Join(t.TempDir(), "IMG_0001.JPG")
+	if err := os.WriteFile(p, buildJPEG(exifAPP1(tiff), jpegSegment(0xC0, []byte{8, 0x0b, 0xb8, 0x0f, 0xa0, 1, 1, 0x11, 0})), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FileThumbnail(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Data, thumb) || got.Width != 160 || got.Height != 120 || got.Orientation != 6 || got.Source != "IFD1" {
+		t.Errorf("unexpected thumbnail %dx%d orientation %d from %s", got.Width, got.Height, got.Orientation, got.Source)
+	}
+}
+
+func TestRawPreviews(t *testing.T) {
+	le := binary.LittleEndian
+	thumb, preview := testPreviewJPEG(160, 120), testPreviewJPEG(1616, 1080)
+
+	// NEF: the preview in a SubIFD, the thumbnail in IFD1
+	nef := buildTIFFWithData(func(offset uint32) []byte {
+		return buildTIFF(le, &tiffIFD{
+			entries: []tiffEntry{asciiTag(0x010f, "NIKON CORPORATION"), shortTag(le, 0x0112, 8)},
+			subs: map[uint16]*tiffIFD{
+				0x014a: {entries: []tiffEntry{
+					longTag(le, 0x00fe, 1),
+					longTag(le, 0x0201, offset+uint32(len(thumb))),
+					longTag(le, 0x0202, uint32(len(preview))),
+				}},
+			},
+			next: &tiffIFD{entries: []tiffEntry{
+				longTag(le, 0x0201, offset),
+				longTag(le, 0x0202, uint32(len(thumb))),
+			}},
+		})
+	}, append(append([]byte(nil), thumb...), preview...))
+
+	// DNG: the raw data is a lossless JPEG strip and is not a preview
+	lossless := buildJPEG(jpegSegment(0xC3, []byte{16, 0, 8, 0, 8, 1, 1, 0x11, 0}))
+	dng := buildTIFFWithData(func(offset uint32) []byte {
+		return buildTIFF(le, &tiffIFD{
+			entries: []tiffEntry{
+				shortTag(le, 0x0103, 6),
+				longTag(le, 0x0111, offset),
+				longTag(le, 0x0117, uint32(len(preview))),
+			},
+			subs: map[uint16]*tiffIFD{
+				0x014a: {entries: []tiffEntry{
+					longTag(le, 0x00fe, 0),
+					shortTag(le, 0x0103, 7),
+					longTag(le, 0x0111, offset+uint32(len(preview))),
+					longTag(le, 0x0117, uint32(len(lossless))),
+				}},
+			},
+		})
+	}, append(append([]byte(nil), preview...), lossless...))
+
+	// CR3: THMB in the metadata uuid box, PRVW in the preview uuid box
+	uuid := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+	thmb := box("THMB", be32(0), be16(160), be16(120), be32(uint32(len(thumb))), be32(0), thumb)
+	prvw := box("PRVW", be32(0), be16(1), be16(1616), be16(1080), be16(1), be32(uint32(len(preview))), preview)
+	cr3 := bytes.Join([][]byte{
+		box("ftyp", []byte("crx "), be32(1)),
+		box("moov", box("uuid", uuid(cr3MetadataUUID), thmb)),
+		box("uuid", uuid(cr3PreviewUUID), make([]byte, 8), prvw),
+	}, nil)
+
+	cases := []struct {
+		name    string
+		data    []byte
+		sources []string
+	}{
+		{"DSC_0001.NEF", nef, []string{"IFD1", "SubIFD0"}},
+		{"IMG_0001.DNG", dng, []string{"IFD0"}},
+		{"IMG_0001.CR3", cr3, []string{"THMB", "PRVW"}},
+	}
+	dir := t.TempDir()
+	for _, c := range cases {
+		p := filepath.Join(dir, c.name)
+		if err := os.WriteFile(p, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		previews, err := FilePreviews(p)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		var sources []string
+		for _, pv := range previews {
+			sources = append(sources, pv.Source)
+		}
+		if len(sources) != len(c.sources) {
+			t.Errorf("%s: got previews from %v, want %v", c.name, sources, c.sources)
+			continue
+		}
+		for i := range sources {
+			if sources[i] != c.sources[i] {
+				t.Errorf("%s: got previews from %v, want %v", c.name, sources, c.sources)
+				break
+			}
+		}
+		largest := previews[len(previews)-1]
+		if largest.Width != 1616 || largest.Height != 1080 || !bytes.Equal(largest.Data, preview) {
+			t.Errorf("%s: largest preview is %dx%d", c.name, largest.Width, largest.Height)
+		}
+	}
+	if pv, err := FilePreview(filepath.Join(dir, "DSC_0001.NEF")); err != nil || pv.Orientation != 8 {
+		t.Errorf("FilePreview() = %v, %v; want orientation 8", pv, err)
+	}
+}
+
+func TestPreviewsUnsupported(t *testing.T) {
+	data := []byte("\x89PNG\r\n\x1a\n")
+	if _, err := ReaderPreviews(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("expected an error")
+	}
+}
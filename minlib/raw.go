@@ -0,0 +1,137 @@
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Raw formats
+// CR2, DNG, PEF, ARW, NEF: plain TIFF
+// ORF: TIFF with "IIRO"/"IIRS"/"MMOR" magic
+// RW2: TIFF with "IIU\0" magic, Exif may live in the embedded JpgFromRaw
+// CR3: https://github.com/lclevy/canon_cr3
+// RAF: https://libopenraw.freedesktop.org/formats/raf/
+
+// Canon CR3 metadata box inside moov
+const cr3MetadataUUID = "85c0b687820f11e08111f4ce462b6a48"
+
+// maxEmbeddedExifScan is how much of an embedded JPEG is read to find its
+// Exif segment, which must come before the image data.
+const maxEmbeddedExifScan = 1 << 20
+
+// cr3Exif decodes the CMT1 (IFD0), CMT2 (Exif IFD) and CMT4 (GPS IFD) boxes
+// of a Canon CR3 file. Each one holds a complete TIFF stream.
+func cr3Exif(r io.ReadSeeker) (*Exif, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	moov, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make(map[IFD]*Exif)
+	err = walkBoxes(r, moov.dataOffset(), moov.end(), func(b *bmffBox) error {
+		if b.typ != "uuid" || b.uuid != cr3MetadataUUID {
+			return nil
+		}
+		return walkBoxes(r, b.dataOffset(), b.end(), func(cmt *bmffBox) error {
+			var ifd IFD
+			switch cmt.typ {
+			case "CMT1":
+				ifd = IFD0
+			case "CMT2":
+				ifd = ExifIFD
+			case "CMT4":
+				ifd = GPSIFD
+			default:
+				return nil
+			}
+			data, err := boxPayload(r, cmt, maxTagValueSize)
+			if err != nil {
+				return err
+			}
+			part, err := parseTIFF(bytes.NewReader(data), 0)
+			if err != nil {
+				return err
+			}
+			parts[ifd] = part
+			return errStopWalkIf(len(parts) == 3)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	x, ok := parts[IFD0]
+	if !ok {
+		return nil, errors.New("cr3: no CMT1 box")
+	}
+	for _, ifd := range []IFD{ExifIFD, GPSIFD} {
+		if part, ok := parts[ifd]; ok {
+			x.mergeIFD0(part, ifd)
+		}
+	}
+	x.decode()
+	return x, nil
+}
+
+func errStopWalkIf(stop bool) error {
+	if stop {
+		return errStopWalk
+	}
+	return nil
+}
+
+// mergeIFD0 adds the IFD0 tags of y to x as tags of ifd.
+func (x *Exif) mergeIFD0(y *Exif, ifd IFD) {
+	for k, t := range y.Tags {
+		if k.IFD == IFD0 {
+			x.Tags[TagKey{ifd, k.ID}] = t
+		}
+	}
+}
+
+// rafExif decodes the Exif metadata of the JPEG embedded in a Fujifilm RAF
+// file.
+func rafExif(r io.ReadSeeker) (*Exif, error) {
+	header, err := readAt(r, 0, 92)
+	if err != nil {
+		return nil, err
+	}
+	if string(header[:16]) != "FUJIFILMCCD-RAW " {
+		return nil, formatError("raf", 0, "invalid header")
+	}
+	offset := int64(binary.BigEndian.Uint32(header[84:88]))
+	length := int64(binary.BigEndian.Uint32(header[88:92]))
+	return embeddedJPEGExif(r, offset, length)
+}
+
+// embeddedJPEGExif decodes the Exif metadata of the JPEG stored at offset
+// in r.
+func embeddedJPEGExif(r io.ReadSeeker, offset, length int64) (*Exif, error) {
+	if length > maxEmbeddedExifScan {
+		length = maxEmbeddedExifScan
+	}
+	if length < 2 {
+		return nil, formatError("jpeg", offset, "invalid embedded JPEG")
+	}
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset >= size {
+		return nil, formatError("jpeg", offset, "invalid embedded JPEG offset")
+	}
+	if offset+length > size {
+		length = size - offset
+	}
+	data, err := readAt(r, offset, int(length))
+	if err != nil {
+		return nil, err
+	}
+	return DecodeExif(bytes.NewReader(data))
+}
@@ -0,0 +1,83 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRawOriginalTime(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	want := time.Date(2020, 2, 3, 4, 5, 6, 0, time.Local)
+	exifTIFF := func(order binary.ByteOrder) []byte {
+		return testExifTIFF(order, "2020:02:03 04:05:06")
+	}
+	withMagic := func(tiff []byte, magic string) []byte {
+		copy(tiff, magic)
+		return tiff
+	}
+
+	// RW2 without Exif IFD, the Exif lives in the JpgFromRaw preview
+	jpg := buildJPEG(exifAPP1(exifTIFF(be)))
+	rw2 := buildTIFF(le, &tiffIFD{entries: []tiffEntry{undefinedTag(0x002e, jpg)}})
+
+	// CR3 with the Canon metadata uuid box
+	cmt := func(typ string, tiff []byte) []byte { return box(typ, tiff) }
+	uuidBox := append(be32(0), "uuid"...)
+	uuidBox = append(uuidBox, []byte{0x85, 0xc0, 0xb6, 0x87, 0x82, 0x0f, 0x11, 0xe0, 0x81, 0x11, 0xf4, 0xce, 0x46, 0x2b, 0x6a, 0x48}...)
+	uuidBox = append(uuidBox, cmt("CMT1", buildTIFF(le, &tiffIFD{entries: []tiffEntry{asciiTag(0x010f, "Canon")}}))...)
+	uuidBox = append(uuidBox, cmt("CMT2", buildTIFF(le, &tiffIFD{entries: []tiffEntry{asciiTag(0x9003, "2020:02:03 04:05:06")}}))...)
+	binary.BigEndian.PutUint32(uuidBox, uint32(len(uuidBox)))
+	cr3 := bytes.Join([][]byte{box("ftyp", []byte("crx "), be32(1)), box("moov", uuidBox, mvhdV0(want))}, nil)
+
+	// RAF with the embedded JPEG after the header
+	raf := make([]byte, 160)
+	copy(raf, "FUJIFILMCCD-RAW 0201FF383501")
+	binary.BigEndian.PutUint32(raf[84:], uint32(len(raf)))
+	binary.BigEndian.PutUint32(raf[88:], uint32(len(jpg)))
+	raf = append(raf, jpg...)
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"IMG_0001.CR2", exifTIFF(le)},
+		{"DSC_0001.DNG", exifTIFF(be)},
+		{"IMGP0001.PEF", exifTIFF(be)},
+		{"P0001.ORF", withMagic(exifTIFF(le), "IIRO")},
+		{"P0002.ORF", withMagic(exifTIFF(be), "MMOR")},
+		{"P0001.RW2", withMagic(rw2, "IIU\x00")},
+		{"IMG_0001.CR3", cr3},
+		{"DSCF0001.RAF", raf},
+	}
+
+	dir := t.TempDir()
+	for _, c := range cases {
+		p := filepath.Join(dir, c.name)
+		if err := os.WriteFile(p, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := FileOriginalTime(p)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, want)
+		}
+	}
+
+	x, err := FileExif(filepath.Join(dir, "IMG_0001.CR3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Make != "Canon" {
+		t.Errorf("CR3 make = %q", x.Make)
+	}
+}
@@ -0,0 +1,171 @@
+package minlib
+
+import (
+	"io/fs"
+	"time"
+)
+
+// TimeSource tells where a file time comes from.
+type TimeSource string
+
+const (
+	SourceExif      TimeSource = "exif"
+	SourceQuickTime TimeSource = "quicktime"
+	SourceRIFF      TimeSource = "riff"
+	SourceMPEGTS    TimeSource = "mpegts"
+	SourceMatroska  TimeSource = "matroska"
+	SourcePNG       TimeSource = "png"
+	SourceID3       TimeSource = "id3"
+	SourceVorbis    TimeSource = "vorbis"
+	SourcePDF       TimeSource = "pdf"
+	SourceOOXML     TimeSource = "ooxml"
+	SourceXMP       TimeSource = "xmp"
+	SourceSidecar   TimeSource = "sidecar"
+	SourceFilename  TimeSource = "filename"
+	// SourceModified is a modification time recorded in the file, such as
+	// the PNG tIME chunk. Like SourceMtime it is no original time.
+	SourceModified TimeSource = "modified"
+	SourceMtime    TimeSource = "mtime"
+)
+
+// Confidence tells how much a resolved file time can be trusted.
+type Confidence int
+
+const (
+	// ConfidenceLow: only the modification time is known.
+	ConfidenceLow Confidence = iota + 1
+	// ConfidenceMedium: the time was guessed from the file name, or the
+	// metadata sources disagree.
+	ConfidenceMedium
+	// ConfidenceHigh: the time is recorded in the file metadata or in a
+	// sidecar.
+	ConfidenceHigh
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceLow:
+		return "low"
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceHigh:
+		return "high"
+	}
+	return "unknown"
+}
+
+// TimeCandidate is a time found for a file.
+type TimeCandidate struct {
+	Time   time.Time
+	Source TimeSource
+	// Detail names the field, box, pattern or file the time was read from,
+	// such as "DateTimeOriginal", "mvhd" or "whatsapp".
+	Detail string
+}
+
+// TimeResolution is the time chosen for a file and how it was chosen.
+type TimeResolution struct {
+	Time       time.Time
+	Source     TimeSource
+	Confidence Confidence
+	// Candidates holds every time found, most trusted first. The chosen
+	// time is the first one.
+	Candidates []TimeCandidate
+	// ClockOffset is the correction added to the times of the camera
+	// clock by a ClockProfile, 0 if none applied.
+	ClockOffset time.Duration
+}
+
+// NeedsReview reports whether the time should be checked by hand.
+func (r *TimeResolution) NeedsReview() bool {
+	return r.Confidence < ConfidenceHigh
+}
+
+// maxMetadataDisagreement is how far metadata times can be apart before the
+// resolution loses confidence. It allows for zone differences.
+const maxMetadataDisagreement = 24 * time.Hour
+
+func isMetadataSource(s TimeSource) bool {
+	switch s {
+	case SourceExif, SourceQuickTime, SourceRIFF, SourceMPEGTS, SourceMatroska, SourcePNG,
+		SourceID3, SourceVorbis, SourcePDF, SourceOOXML, SourceXMP, SourceSidecar:
+		return true
+	}
+	return false
+}
+
+// ResolveFileTime collects the times of file p from its embedded metadata,
+// its XMP metadata or sidecar, its Google Takeout sidecar, its name and the
+// modification times recorded in it and by the file system, and chooses the
+// most trusted one.
+func ResolveFileTime(p string) (*TimeResolution, error) {
+	return resolveTime(osFS{}, p)
+}
+
+// ResolveFSTime is like ResolveFileTime for the file name of fsys. The
+// sidecars are looked up in fsys.
+func ResolveFSTime(fsys fs.FS, name string) (*TimeResolution, error) {
+	return resolveTime(ioFS{fsys}, name)
+}
+
+func resolveTime(fsys fileSystem, name string) (*TimeResolution, error) {
+	var candidates, modified []TimeCandidate
+	m, err := openMedia(fsys, name)
+	if err == nil {
+		defer m.Close()
+		candidates, err = m.timeCandidates()
+		modified = m.modificationTimes()
+		if x, err := m.xmp(); err == nil {
+			candidates = append(candidates, x.timeCandidates()...)
+		} else if sidecar, ok := findXMPSidecar(fsys, name); ok {
+			if x, err := sidecarXMP(fsys, sidecar); err == nil {
+				candidates = append(candidates, x.timeCandidates()...)
+			}
+		}
+	}
+	if sidecar, ok := findTakeoutSidecar(fsys, name); ok {
+		if md, err := takeoutMetadata(fsys, name); err == nil && !md.PhotoTakenTime.IsZero() {
+			candidates = append(candidates, TimeCandidate{md.PhotoTakenTime, SourceSidecar, sidecar})
+		}
+	}
+	if fm, err := MatchFilenameTime(name); err == nil {
+		candidates = append(candidates, TimeCandidate{fm.Time, SourceFilename, fm.Pattern})
+	}
+	candidates = append(candidates, modified...)
+	if fi, err := fsys.stat(name); err == nil {
+		candidates = append(candidates, TimeCandidate{fi.ModTime(), SourceMtime, ""})
+	}
+
+	if len(candidates) == 0 {
+		if err == nil {
+			err = &ErrNoOriginalTime{}
+		}
+		return nil, err
+	}
+	return newTimeResolution(candidates), nil
+}
+
+func newTimeResolution(candidates []TimeCandidate) *TimeResolution {
+	chosen := candidates[0]
+	r := &TimeResolution{
+		Time:       chosen.Time,
+		Source:     chosen.Source,
+		Candidates: candidates,
+	}
+	switch {
+	case isMetadataSource(chosen.Source):
+		r.Confidence = ConfidenceHigh
+		for _, c := range candidates[1:] {
+			d := c.Time.Sub(chosen.Time)
+			if isMetadataSource(c.Source) && (d > maxMetadataDisagreement || d < -maxMetadataDisagreement) {
+				r.Confidence = ConfidenceMedium
+				break
+			}
+		}
+	case chosen.Source == SourceFilename:
+		r.Confidence = ConfidenceMedium
+	default:
+		r.Confidence = ConfidenceLow
+	}
+	return r
+}
@@ -0,0 +1,67 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveFileTime(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	exifJPEG := buildJPEG(exifAPP1(testExifTIFF(binary.LittleEndian, "2021:03:04 10:11:12")))
+
+	cases := []struct {
+		path       string
+		source     TimeSource
+		detail     string
+		confidence Confidence
+	}{
+		{write("IMG_20200101_000000.jpg", exifJPEG), SourceExif, "DateTimeOriginal", ConfidenceHigh},
+		{write("IMG_20200102_000000.jpg", buildJPEG()), SourceFilename, "android", ConfidenceMedium},
+		{write("notes.txt", []byte("hello")), SourceMtime, "", ConfidenceLow},
+		{write("DSC_0001.jpg", exifJPEG), SourceExif, "DateTimeOriginal", ConfidenceMedium},
+	}
+	// a sidecar disagreeing with the Exif date by days
+	xmp := `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description
+		xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreateDate="2021-03-09T10:11:12"/></rdf:RDF>`
+	write("DSC_0001.xmp", []byte(xmp))
+
+	for _, c := range cases {
+		r, err := ResolveFileTime(c.path)
+		if err != nil {
+			t.Errorf("%s: %v", c.path, err)
+			continue
+		}
+		name := filepath.Base(c.path)
+		if r.Source != c.source || r.Candidates[0].Detail != c.detail || r.Confidence != c.confidence {
+			t.Errorf("%s: got %s/%s/%s, want %s/%s/%s", name,
+				r.Source, r.Candidates[0].Detail, r.Confidence, c.source, c.detail, c.confidence)
+		}
+		if last := r.Candidates[len(r.Candidates)-1]; last.Source != SourceMtime {
+			t.Errorf("%s: expected the modification time as last candidate, got %s", name, last.Source)
+		}
+		if ft, err := FileTime(c.path); err != nil || !ft.Equal(r.Time) {
+			t.Errorf("%s: FileTime() = %v, %v; want %v", name, ft, err, r.Time)
+		}
+	}
+
+	if _, err := ResolveFileTime(filepath.Join(dir, "missing.bin")); err == nil {
+		t.Error("expected an error for a missing file without time in its name")
+	}
+	r, err := ResolveFileTime(filepath.Join(dir, "IMG_20200103_000000.jpg"))
+	if err != nil || !r.Time.Equal(time.Date(2020, 1, 3, 0, 0, 0, 0, time.Local)) || !r.NeedsReview() {
+		t.Errorf("missing file with a dated name: %+v, %v", r, err)
+	}
+}
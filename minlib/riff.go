@@ -0,0 +1,341 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// AVI RIFF File Reference: https://msdn.microsoft.com/en-us/library/ms779636.aspx
+// Nikon Tags: https://www.sno.phy.queensu.ca/~phil/exiftool/TagNames/Nikon.html#AVITags
+// Chunks are laid out as [id:4][size:4, little endian][data][pad byte if
+// size is odd]. The data of RIFF and LIST chunks starts with their form or
+// list type, followed by sub-chunks.
+
+// maxChunksPerWalk limits the chunks visited in a RIFF or LIST chunk.
+const maxChunksPerWalk = 1 << 18
+
+// maxNikonTagsSize limits the size of the Nikon nctg chunk.
+const maxNikonTagsSize = 1 << 16
+
+// maxRIFFStringSize limits the size of the date and INFO chunks.
+const maxRIFFStringSize = 1 << 10
+
+// maxRIFFDepth limits the nesting of LIST chunks.
+const maxRIFFDepth = 8
+
+type riffChunk struct {
+	id     string
+	offset int64  // offset of the chunk header
+	size   int64  // size of the data, without header and padding
+	list   string // form or list type of RIFF and LIST chunks
+}
+
+func (c *riffChunk) dataOffset() int64 {
+	return c.offset + 8
+}
+
+// childOffset returns the offset of the first sub-chunk of a RIFF or LIST
+// chunk.
+func (c *riffChunk) childOffset() int64 {
+	return c.offset + 12
+}
+
+func (c *riffChunk) end() int64 {
+	return c.offset + 8 + c.size + c.size&1
+}
+
+// readRIFFChunkHeader reads the header of the chunk starting at offset.
+// limit is the end of the enclosing chunk (or of the file). The last chunk
+// of a truncated file is cut at limit.
+func readRIFFChunkHeader(r io.ReadSeeker, offset, limit int64) (*riffChunk, error) {
+	if limit-offset < 8 {
+		return nil, truncatedError("riff", offset)
+	}
+	hdr, err := readAt(r, offset, 8)
+	if err != nil {
+		return nil, err
+	}
+	c := &riffChunk{
+		id:     string(hdr[0:4]),
+		offset: offset,
+		size:   int64(binary.LittleEndian.Uint32(hdr[4:8])),
+	}
+	if c.size > limit-offset-8 || (c.id == "RIFF" && c.size == 0) {
+		// a RIFF size of 0 is left by writers which did not finish
+		c.size = limit - offset - 8
+	}
+	if c.id == "RIFF" || c.id == "LIST" {
+		if c.size < 4 {
+			return nil, formatError("riff", offset, "invalid "+c.id+" chunk")
+		}
+		list, err := readAt(r, offset+8, 4)
+		if err != nil {
+			return nil, err
+		}
+		c.list = string(list)
+	}
+	return c, nil
+}
+
+// walkRIFFChunks calls fn for every chunk in [start, end). Returning
+// errStopWalk from fn stops the walk without an error.
+func walkRIFFChunks(r io.ReadSeeker, start, end int64, fn func(c *riffChunk) error) error {
+	for offset, n := start, 0; end-offset >= 8; n++ {
+		if n >= maxChunksPerWalk {
+			return limitError("riff", offset, "too many chunks")
+		}
+		c, err := readRIFFChunkHeader(r, offset, end)
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			if err == errStopWalk {
+				return nil
+			}
+			return err
+		}
+		offset = c.end()
+	}
+	return nil
+}
+
+// aviMetadata holds the dated chunks of an AVI file. Empty fields were
+// not found.
+type aviMetadata struct {
+	nctg []byte // Nikon tags
+	strd *Exif  // Exif of the AVIF stream data of Canon and Fujifilm
+	idit string // DateTimeOriginal chunk of the hdrl list
+	// INFO list creation date and SMPTE time code
+	icrd, ismp string
+
+	avih []byte // main header
+	// dmlhFrames is the frame count of the whole OpenDML file.
+	dmlhFrames uint32
+	streams    []*aviStream
+}
+
+// aviStream holds the headers of a stream list.
+type aviStream struct {
+	strh []byte // stream header
+	strf []byte // BITMAPINFOHEADER or WAVEFORMATEX
+}
+
+// parseAVI reads the metadata of an AVI file. The headers are in the
+// first RIFF AVI chunk; the RIFF AVIX chunks of OpenDML files larger than
+// 1GB are searched as well.
+func parseAVI(r io.ReadSeeker) (*aviMetadata, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	riff, err := readRIFFChunkHeader(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if riff.id != "RIFF" || riff.list != "AVI " {
+		return nil, formatError("riff", 0, "not an AVI file")
+	}
+
+	m := &aviMetadata{}
+	err = walkRIFFChunks(r, 0, size, func(c *riffChunk) error {
+		if c.id != "RIFF" || (c.list != "AVI " && c.list != "AVIX") {
+			return nil
+		}
+		return m.walk(r, c, 1)
+	})
+	return m, err
+}
+
+// walk reads the metadata chunks of the RIFF or LIST chunk list. The movi
+// lists holding the audio and video data are skipped.
+func (m *aviMetadata) walk(r io.ReadSeeker, list *riffChunk, depth int) error {
+	if depth > maxRIFFDepth {
+		return limitError("riff", list.offset, "LIST nesting")
+	}
+	return walkRIFFChunks(r, list.childOffset(), list.end(), func(c *riffChunk) error {
+		switch c.id {
+		case "LIST":
+			switch c.list {
+			case "strl":
+				m.streams = append(m.streams, &aviStream{})
+				return m.walk(r, c, depth+1)
+			case "hdrl", "odml", "INFO", "ncdt":
+				return m.walk(r, c, depth+1)
+			}
+		case "avih":
+			if m.avih == nil {
+				m.avih = readRIFFHeader(r, c, 40)
+			}
+		case "dmlh":
+			if b := readRIFFHeader(r, c, 4); len(b) == 4 {
+				m.dmlhFrames = binary.LittleEndian.Uint32(b)
+			}
+		case "strh", "strf":
+			if list.list != "strl" || len(m.streams) == 0 {
+				return nil
+			}
+			stream := m.streams[len(m.streams)-1]
+			if c.id == "strh" {
+				stream.strh = readRIFFHeader(r, c, 56)
+			} else {
+				stream.strf = readRIFFHeader(r, c, 40)
+			}
+		case "nctg":
+			if m.nctg != nil {
+				return nil
+			}
+			if c.size > maxNikonTagsSize {
+				return limitError("riff", c.offset, "nctg chunk size")
+			}
+			var err error
+			m.nctg, err = readAt(r, c.dataOffset(), int(c.size))
+			return err
+		case "strd":
+			if m.strd == nil {
+				m.strd = strdExif(r, c)
+			}
+		case "IDIT":
+			if m.idit == "" {
+				m.idit = readRIFFString(r, c)
+			}
+		case "ICRD":
+			if list.list == "INFO" && m.icrd == "" {
+				m.icrd = readRIFFString(r, c)
+			}
+		case "ISMP":
+			if list.list == "INFO" && m.ismp == "" {
+				m.ismp = readRIFFString(r, c)
+			}
+		}
+		return nil
+	})
+}
+
+// readRIFFHeader returns the first n bytes of a header chunk, or the whole
+// chunk when it is shorter.
+func readRIFFHeader(r io.ReadSeeker, c *riffChunk, n int) []byte {
+	if c.size < int64(n) {
+		n = int(c.size)
+	}
+	b, err := readAt(r, c.dataOffset(), n)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// readRIFFString returns the text of a short chunk, without the trailing
+// NUL and line feed.
+func readRIFFString(r io.ReadSeeker, c *riffChunk) string {
+	if c.size > maxRIFFStringSize {
+		return ""
+	}
+	data, err := readAt(r, c.dataOffset(), int(c.size))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(string(data), "\x00\r\n ")
+}
+
+// strdExif decodes the stream data of Canon and Fujifilm AVI files: "AVIF",
+// 4 bytes and a little endian IFD0, with offsets relative to the start of
+// the data. It returns nil for other stream data.
+func strdExif(r io.ReadSeeker, c *riffChunk) *Exif {
+	head, err := readAt(r, c.dataOffset(), 4)
+	if err != nil || string(head) != "AVIF" {
+		return nil
+	}
+	t := &tiffReader{
+		r:            r,
+		size:         c.dataOffset() + c.size,
+		endian:       binary.LittleEndian,
+		headerOffset: c.dataOffset(),
+		visited:      make(map[int64]bool),
+		exif:         newExif(binary.LittleEndian),
+	}
+	if _, err := t.parseDirEntry(8, IFD0); err != nil {
+		return nil
+	}
+	t.exif.decode()
+	return t.exif
+}
+
+// aviTimeLayouts are the formats of the IDIT and ICRD dates.
+var aviTimeLayouts = []string{
+	"Mon Jan 2 15:04:05 2006",
+	"2006:01:02 15:04:05",
+	"2006/01/02 15:04:05",
+	"2006-01-02 15:04:05",
+	"2006:01:02",
+	"2006/01/02",
+	"2006-01-02",
+}
+
+// parseAVITime parses a date of an AVI file, most often written like
+// asctime ("Mon Mar 03 09:44:56 2003", in upper case by some cameras) or
+// like the Exif dates, in local time.
+func parseAVITime(s string) (time.Time, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	for _, layout := range aviTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return parseISOTime(s)
+}
+
+// aviTimeCandidates returns the dates of an AVI file, most trusted first:
+// the Nikon and the Exif DateTimeOriginal, the IDIT date, then the ICRD
+// (creation date) and ISMP INFO tags. ISMP usually is a SMPTE time code,
+// which is ignored, but some cameras store the date there.
+func aviTimeCandidates(r io.ReadSeeker) ([]TimeCandidate, error) {
+	m, err := parseAVI(r)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []TimeCandidate
+	if m.nctg != nil {
+		if t, err := nikonTagsTime(m.nctg); err == nil {
+			candidates = append(candidates, TimeCandidate{t, SourceRIFF, "nctg"})
+		}
+	}
+	if m.strd != nil {
+		candidates = append(candidates, m.strd.timeCandidates()...)
+	}
+	for _, c := range []struct{ detail, value string }{
+		{"IDIT", m.idit},
+		{"ICRD", m.icrd},
+		{"ISMP", m.ismp},
+	} {
+		if c.value == "" {
+			continue
+		}
+		if t, err := parseAVITime(c.value); err == nil {
+			candidates = append(candidates, TimeCandidate{t, SourceRIFF, c.detail})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, &ErrNoOriginalTime{"no date in AVI chunks"}
+	}
+	return candidates, nil
+}
+
+// nikonTagsTime returns the DateTimeOriginal (0x0013) of a Nikon nctg
+// chunk, a list of [id:2][size:2][data] tags.
+func nikonTagsTime(data []byte) (time.Time, error) {
+	for i := 0; len(data)-i >= 4; {
+		id := binary.LittleEndian.Uint16(data[i:])
+		size := int(binary.LittleEndian.Uint16(data[i+2:]))
+		i += 4
+		if size > len(data)-i {
+			return zeroTime, truncatedError("riff", -1)
+		}
+		if id == 0x0013 {
+			return parseTime(string(data[i : i+size]))
+		}
+		i += size
+	}
+	return zeroTime, &ErrNoOriginalTime{"no DateTimeOriginal in nctg chunk"}
+}
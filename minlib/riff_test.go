@@ -0,0 +1,116 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestAVITimeCandidates(t *testing.T) {
+	le := binary.LittleEndian
+	avi := func(chunks ...[]byte) []byte {
+		return chunk("RIFF", append([][]byte{[]byte("AVI ")}, chunks...)...)
+	}
+	hdrl := func(chunks ...[]byte) []byte {
+		return chunk("LIST", append([][]byte{[]byte("hdrl"), chunk("avih", make([]byte, 56))}, chunks...)...)
+	}
+	info := func(chunks ...[]byte) []byte {
+		return chunk("LIST", append([][]byte{[]byte("INFO")}, chunks...)...)
+	}
+	movi := chunk("LIST", []byte("movi"), chunk("00dc", []byte("odd")))
+
+	// Canon and Fujifilm stream data: "AVIF", 4 bytes, IFD0 at 8 with
+	// Make and the Exif IFD at 38, values at 56
+	entry := func(tag, typ uint16, count, value uint32) []byte {
+		e := le.AppendUint16(le.AppendUint16(nil, tag), typ)
+		return le.AppendUint32(le.AppendUint32(e, count), value)
+	}
+	ifd := bytes.Join([][]byte{
+		[]byte("AVIF\x00\x00\x00\x00"),
+		{2, 0}, entry(0x010f, TypeASCII, 6, 56), entry(0x8769, TypeLong, 1, 38), be32(0),
+		{1, 0}, entry(0x9003, TypeASCII, 20, 62), be32(0),
+		[]byte("Canon\x002011:12:13 14:15:16\x00"),
+	}, nil)
+	strl := chunk("LIST", []byte("strl"), chunk("strh", make([]byte, 56)), chunk("strd", ifd))
+
+	nctg := append([]byte{0x13, 0x00, 0x14, 0x00}, "2016:01:20 03:07:00\x00"...)
+	local := func(year int, month time.Month, day, hour, minute, sec int) time.Time {
+		return time.Date(year, month, day, hour, minute, sec, 0, time.Local)
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		want []TimeCandidate
+	}{
+		{"nikon", avi(
+			chunk("LIST", []byte("ncdt"), chunk("ncvr", []byte("x")), chunk("nctg", nctg)),
+			hdrl(chunk("IDIT", []byte("WED JAN 20 03:07:01 2016\n\x00"))),
+			movi,
+		), []TimeCandidate{
+			{local(2016, 1, 20, 3, 7, 0), SourceRIFF, "nctg"},
+			{local(2016, 1, 20, 3, 7, 1), SourceRIFF, "IDIT"},
+		}},
+		{"idit after padded chunks", avi(
+			chunk("JUNK", []byte("odd")),
+			hdrl(chunk("JUNK", []byte("a")), chunk("IDIT", []byte("Mon Mar  3 09:44:56 2003\n\x00"))),
+			movi,
+			chunk("idx1", make([]byte, 16)),
+		), []TimeCandidate{
+			{local(2003, 3, 3, 9, 44, 56), SourceRIFF, "IDIT"},
+		}},
+		{"strd", avi(hdrl(strl), movi), []TimeCandidate{
+			{local(2011, 12, 13, 14, 15, 16), SourceExif, "DateTimeOriginal"},
+		}},
+		{"info", avi(
+			hdrl(),
+			info(chunk("ISFT", []byte("Lavf58\x00")), chunk("ISMP", []byte("00:00:00:00")), chunk("ICRD", []byte("2005-08-17 11:42:43\x00"))),
+			movi,
+		), []TimeCandidate{
+			{local(2005, 8, 17, 11, 42, 43), SourceRIFF, "ICRD"},
+		}},
+		// the INFO list of an OpenDML file may follow in an AVIX chunk
+		{"avix", append(
+			avi(hdrl(chunk("IDIT", []byte("2009:10:11 12:13:14"))), movi),
+			chunk("RIFF", []byte("AVIX"), movi, info(chunk("ICRD", []byte("2009-10-11"))))...,
+		), []TimeCandidate{
+			{local(2009, 10, 11, 12, 13, 14), SourceRIFF, "IDIT"},
+			{local(2009, 10, 11, 0, 0, 0), SourceRIFF, "ICRD"},
+		}},
+	}
+	for _, c := range cases {
+		got, err := aviTimeCandidates(bytes.NewReader(c.data))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Time.Equal(c.want[i].Time) || got[i].Source != c.want[i].Source || got[i].Detail != c.want[i].Detail {
+				t.Errorf("%s: got %v, want %v", c.name, got[i], c.want[i])
+			}
+		}
+	}
+
+	// an unfinished file with a RIFF size of 0
+	data := avi(hdrl(chunk("IDIT", []byte("2009:10:11 12:13:14"))))
+	le.PutUint32(data[4:], 0)
+	if _, err := aviTimeCandidates(bytes.NewReader(data)); err != nil {
+		t.Errorf("RIFF size 0: %v", err)
+	}
+
+	x, err := ReaderExif(bytes.NewReader(avi(hdrl(strl))), int64(len(avi(hdrl(strl)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Make != "Canon" {
+		t.Errorf("unexpected make %q", x.Make)
+	}
+}
@@ -0,0 +1,1103 @@
+package minlib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Scrubbing never decodes or re-encodes the image or video data:
+// JPEG: marker segments are dropped, the scans and the data after EOI are
+// copied. Multi-picture (MPF) offsets are adjusted when segments after the
+// MPF segment are dropped.
+// PNG: ancillary chunks are dropped.
+// WebP: chunks are dropped and the VP8X flags and RIFF size updated.
+// QuickTime and MP4: metadata boxes are turned into free boxes of the same
+// size, so that the chunk offsets stay valid.
+// Exif: tags are removed from their IFD in place and their values zeroed;
+// the other offsets, such as those of the MakerNote, stay valid.
+
+// MetadataGroup is a kind of metadata removed or kept by Scrub.
+type MetadataGroup string
+
+const (
+	// MetadataExif is the Exif data not in another group: camera settings,
+	// dates, orientation. The other Exif groups are only kept along with
+	// it. The PNG tIME chunk is also in this group.
+	MetadataExif MetadataGroup = "exif"
+	// MetadataGPS is the Exif GPS IFD and the QuickTime location.
+	MetadataGPS MetadataGroup = "gps"
+	// MetadataSerial is the serial numbers of the camera and the lens and
+	// the unique image id.
+	MetadataSerial MetadataGroup = "serial"
+	// MetadataOwner is the artist, author, owner, copyright and computer
+	// names.
+	MetadataOwner MetadataGroup = "owner"
+	// MetadataMakerNote is the Exif MakerNote, which holds serial numbers.
+	MetadataMakerNote MetadataGroup = "makernote"
+	// MetadataThumbnail is the Exif thumbnail (IFD1).
+	MetadataThumbnail MetadataGroup = "thumbnail"
+	// MetadataComment is the titles, descriptions and comments: JPEG COM,
+	// PNG text chunks, Exif UserComment and ImageDescription.
+	MetadataComment MetadataGroup = "comment"
+	// MetadataXMP is the XMP packets, with their edit history.
+	MetadataXMP MetadataGroup = "xmp"
+	// MetadataIPTC is the IPTC and Photoshop data (JPEG APP13).
+	MetadataIPTC MetadataGroup = "iptc"
+	// MetadataICC is the ICC color profile.
+	MetadataICC MetadataGroup = "icc"
+	// MetadataQuickTime is the QuickTime and MP4 metadata items not in
+	// another group, such as the make, model and creation date.
+	MetadataQuickTime MetadataGroup = "quicktime"
+	// MetadataTrailer is the data after the end of a JPEG, PNG or WebP
+	// image, such as multi-picture images and motion photo videos, with
+	// the JPEG MPF segment.
+	MetadataTrailer MetadataGroup = "trailer"
+	// MetadataOther is the unknown application segments, chunks and boxes.
+	MetadataOther MetadataGroup = "other"
+)
+
+// MetadataGroups lists the metadata groups.
+var MetadataGroups = []MetadataGroup{
+	MetadataExif, MetadataGPS, MetadataSerial, MetadataOwner, MetadataMakerNote,
+	MetadataThumbnail, MetadataComment, MetadataXMP, MetadataIPTC, MetadataICC,
+	MetadataQuickTime, MetadataTrailer, MetadataOther,
+}
+
+// ScrubPolicy is the allow-list of the metadata groups kept by Scrub.
+// Everything else is removed.
+type ScrubPolicy struct {
+	Keep []MetadataGroup
+}
+
+// DefaultScrubPolicy keeps what is needed to date and display shared
+// photos and videos: the Exif data, the color profile and the QuickTime
+// metadata without location and names.
+var DefaultScrubPolicy = ScrubPolicy{Keep: []MetadataGroup{MetadataExif, MetadataICC, MetadataQuickTime}}
+
+// Keeps reports whether the policy keeps the group.
+func (p ScrubPolicy) Keeps(g MetadataGroup) bool {
+	for _, k := range p.Keep {
+		if k == g {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrubbedItem is a metadata item removed by Scrub.
+type ScrubbedItem struct {
+	Group MetadataGroup
+	// Detail names the item, such as "APP1 XMP", "GPS IFD" or "moov/udta/©xyz".
+	Detail string
+}
+
+func (i ScrubbedItem) String() string {
+	return string(i.Group) + ": " + i.Detail
+}
+
+// ScrubError is returned by VerifyScrubbed for metadata left in a file.
+type ScrubError struct {
+	Remaining []ScrubbedItem
+}
+
+func (e *ScrubError) Error() string {
+	items := make([]string, len(e.Remaining))
+	for i, item := range e.Remaining {
+		items[i] = item.String()
+	}
+	return "scrub: metadata remains: " + strings.Join(items, ", ")
+}
+
+// ScrubFile writes src to dst without the metadata groups the policy does
+// not keep, and verifies the result with VerifyScrubbed. dst is replaced
+// atomically and may be src. The removed items are returned.
+func ScrubFile(src, dst string, policy ScrubPolicy) ([]ScrubbedItem, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".scrub")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	w := bufio.NewWriter(tmp)
+	removed, err := Scrub(w, in, fi.Size(), policy)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	out, err := tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyScrubbed(tmp, out.Size(), policy); err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return nil, err
+	}
+	tmp = nil
+	return removed, nil
+}
+
+// Scrub writes the size bytes of r to w without the metadata groups the
+// policy does not keep. JPEG, PNG, WebP, QuickTime and MP4 files are
+// supported. The removed items are returned.
+func Scrub(w io.Writer, r io.ReaderAt, size int64, policy ScrubPolicy) ([]ScrubbedItem, error) {
+	s := &scrubber{policy: policy}
+	pieces, err := s.scrub(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.removed, writeScrubPieces(w, r, pieces)
+}
+
+// VerifyScrubbed checks that the size bytes of r hold no metadata group
+// the policy does not keep: scrubbing them again must remove nothing, and
+// the Exif, XMP and QuickTime metadata decoded from them must only hold
+// kept groups. The metadata left is returned in a *ScrubError.
+func VerifyScrubbed(r io.ReaderAt, size int64, policy ScrubPolicy) error {
+	s := &scrubber{policy: policy}
+	if _, err := s.scrub(r, size); err != nil {
+		return err
+	}
+	remaining := s.removed
+
+	if x, err := ReaderExif(r, size); err == nil {
+		for key := range x.Tags {
+			g := exifTagGroup(key.IFD, key.ID)
+			if !policy.Keeps(MetadataExif) {
+				g = MetadataExif
+			}
+			if !policy.Keeps(g) {
+				remaining = append(remaining, ScrubbedItem{g, fmt.Sprintf("%s 0x%04x", key.IFD, key.ID)})
+			}
+		}
+	}
+	if !policy.Keeps(MetadataXMP) {
+		if _, err := ReaderXMP(r, size); err == nil {
+			remaining = append(remaining, ScrubbedItem{MetadataXMP, "XMP packet"})
+		}
+	}
+	if m, err := newMediaReader(r, size, ""); err == nil && (m.typ == MediaQuickTime || m.typ == MediaMP4) {
+		if movie, err := parseMOV(m.reader()); err == nil {
+			for key := range movie.metadata {
+				if g := movItemGroup(key); !policy.Keeps(g) {
+					remaining = append(remaining, ScrubbedItem{g, key})
+				}
+			}
+		}
+	}
+	if len(remaining) > 0 {
+		return &ScrubError{remaining}
+	}
+	return nil
+}
+
+// FileVerifyScrubbed verifies the file p, see VerifyScrubbed.
+func FileVerifyScrubbed(p string, policy ScrubPolicy) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return VerifyScrubbed(f, fi.Size(), policy)
+}
+
+type scrubber struct {
+	policy  ScrubPolicy
+	removed []ScrubbedItem
+}
+
+// keep reports whether the item of group g is kept, recording it as
+// removed otherwise.
+func (s *scrubber) keep(g MetadataGroup, detail string) bool {
+	if s.policy.Keeps(g) {
+		return true
+	}
+	s.removed = append(s.removed, ScrubbedItem{g, detail})
+	return false
+}
+
+// scrubPiece is a part of the output: n bytes of the input at off, data,
+// or n zero bytes.
+type scrubPiece struct {
+	off, n int64
+	data   []byte
+	zero   bool
+}
+
+func (p scrubPiece) len() int64 {
+	if p.data != nil {
+		return int64(len(p.data))
+	}
+	return p.n
+}
+
+func writeScrubPieces(w io.Writer, r io.ReaderAt, pieces []scrubPiece) error {
+	zeros := make([]byte, 32<<10)
+	for _, p := range pieces {
+		var err error
+		switch {
+		case p.data != nil:
+			_, err = w.Write(p.data)
+		case p.zero:
+			for n := p.n; n > 0 && err == nil; n -= int64(len(zeros)) {
+				if n < int64(len(zeros)) {
+					_, err = w.Write(zeros[:n])
+				} else {
+					_, err = w.Write(zeros)
+				}
+			}
+		default:
+			_, err = io.Copy(w, io.NewSectionReader(r, p.off, p.n))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrub returns the pieces of the scrubbed output of r.
+func (s *scrubber) scrub(r io.ReaderAt, size int64) ([]scrubPiece, error) {
+	m, err := newMediaReader(r, size, "")
+	if err != nil {
+		return nil, err
+	}
+	rs := m.reader()
+	switch m.typ {
+	case MediaJPEG:
+		return s.scrubJPEG(rs, size)
+	case MediaPNG:
+		return s.scrubPNG(rs, size)
+	case MediaWebP:
+		return s.scrubWebP(rs, size)
+	case MediaQuickTime, MediaMP4, MediaM4A:
+		return s.scrubMOV(rs, size)
+	}
+	return nil, fmt.Errorf("scrub: unsupported media type %s", m.typ)
+}
+
+// exifTagGroups are the Exif tags not in MetadataExif. The GPS IFD and
+// IFD1 are handled as a whole.
+var exifTagGroups = map[TagKey]MetadataGroup{
+	{IFD0, 0x010e}:    MetadataComment,   // ImageDescription
+	{IFD0, 0x013b}:    MetadataOwner,     // Artist
+	{IFD0, 0x013c}:    MetadataOwner,     // HostComputer
+	{IFD0, 0x02bc}:    MetadataXMP,       // ApplicationNotes
+	{IFD0, 0x83bb}:    MetadataIPTC,      // IPTC-NAA
+	{IFD0, 0x8298}:    MetadataOwner,     // Copyright
+	{IFD0, 0x8773}:    MetadataICC,       // ICC_Profile
+	{IFD0, 0x9c9b}:    MetadataComment,   // XPTitle
+	{IFD0, 0x9c9c}:    MetadataComment,   // XPComment
+	{IFD0, 0x9c9d}:    MetadataOwner,     // XPAuthor
+	{IFD0, 0x9c9e}:    MetadataComment,   // XPKeywords
+	{IFD0, 0x9c9f}:    MetadataComment,   // XPSubject
+	{IFD0, 0xc62f}:    MetadataSerial,    // CameraSerialNumber
+	{ExifIFD, 0x927c}: MetadataMakerNote, // MakerNote
+	{ExifIFD, 0x9286}: MetadataComment,   // UserComment
+	{ExifIFD, 0xa420}: MetadataSerial,    // ImageUniqueID
+	{ExifIFD, 0xa430}: MetadataOwner,     // CameraOwnerName
+	{ExifIFD, 0xa431}: MetadataSerial,    // BodySerialNumber
+	{ExifIFD, 0xa435}: MetadataSerial,    // LensSerialNumber
+}
+
+// exifTagGroup returns the metadata group of a decoded Exif tag.
+func exifTagGroup(ifd IFD, id uint16) MetadataGroup {
+	switch ifd {
+	case GPSIFD:
+		return MetadataGPS
+	case IFD1:
+		return MetadataThumbnail
+	case MakerNoteIFD:
+		return MetadataMakerNote
+	}
+	if g, ok := exifTagGroups[TagKey{ifd, id}]; ok {
+		return g
+	}
+	return MetadataExif
+}
+
+// tiffScrubber removes tags from a TIFF stream in place. The removed
+// values are wiped last, sparing the bytes of the kept IFDs and values
+// they may overlap in broken streams.
+type tiffScrubber struct {
+	s         *scrubber
+	b         []byte
+	order     binary.ByteOrder
+	format    string
+	visited   map[uint32]bool
+	protected []bool
+	wiped     [][2]uint64
+}
+
+// scrubTIFF removes the tags of the groups the policy does not keep from
+// the TIFF stream b, in place.
+func (s *scrubber) scrubTIFF(b []byte, format string) error {
+	if len(b) < 8 {
+		return truncatedError(format, 0)
+	}
+	t := &tiffScrubber{s: s, b: b, format: format, visited: make(map[uint32]bool), protected: make([]bool, len(b))}
+	defer t.wipe()
+	t.protect(0, 8)
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return formatError(format, 0, "bad TIFF byte order")
+	}
+	ifd0 := t.order.Uint32(b[4:8])
+	next, err := t.ifd(ifd0, IFD0, 0)
+	if err != nil || next == 0 {
+		return err
+	}
+	if t.s.keep(MetadataThumbnail, "IFD1") {
+		_, err = t.ifd(next, IFD1, 0)
+		return err
+	}
+	t.zeroIFD(next, IFD1, 0)
+	// IFD0 may have lost entries: its next pointer follows the last one
+	n := uint32(t.order.Uint16(b[ifd0:]))
+	t.order.PutUint32(b[ifd0+2+12*n:], 0)
+	return nil
+}
+
+// entries returns the entries of the IFD at off.
+func (t *tiffScrubber) entries(off uint32) ([]byte, error) {
+	if uint64(off)+2 > uint64(len(t.b)) {
+		return nil, truncatedError(t.format, int64(off))
+	}
+	n := uint64(t.order.Uint16(t.b[off:]))
+	if uint64(off)+2+12*n+4 > uint64(len(t.b)) {
+		return nil, truncatedError(t.format, int64(off))
+	}
+	return t.b[off+2 : uint64(off)+2+12*n], nil
+}
+
+// valueRange returns the position of the value of entry when it is stored
+// out of the entry.
+func (t *tiffScrubber) valueRange(entry []byte) (start, end uint64, ok bool) {
+	typ := t.order.Uint16(entry[2:])
+	if typ == 0 || int(typ) >= len(tiffTypeSizes) {
+		return 0, 0, false
+	}
+	size := uint64(tiffTypeSizes[typ]) * uint64(t.order.Uint32(entry[4:]))
+	if size <= 4 {
+		return 0, 0, false
+	}
+	start = uint64(t.order.Uint32(entry[8:]))
+	end = start + size
+	if end > uint64(len(t.b)) {
+		end = uint64(len(t.b))
+	}
+	return start, end, start < end
+}
+
+func (t *tiffScrubber) protect(start, end uint64) {
+	for i := start; i < end && i < uint64(len(t.b)); i++ {
+		t.protected[i] = true
+	}
+}
+
+func (t *tiffScrubber) zero(start, end uint64) {
+	t.wiped = append(t.wiped, [2]uint64{start, end})
+}
+
+// wipe zeroes the removed bytes that are not protected.
+func (t *tiffScrubber) wipe() {
+	for _, w := range t.wiped {
+		for i := w[0]; i < w[1] && i < uint64(len(t.b)); i++ {
+			if !t.protected[i] {
+				t.b[i] = 0
+			}
+		}
+	}
+}
+
+func (t *tiffScrubber) zeroValue(entry []byte) {
+	if start, end, ok := t.valueRange(entry); ok {
+		t.zero(start, end)
+	}
+}
+
+// ifd removes the entries of the IFD at off that are not kept, recursing
+// into the sub-IFDs, and returns the offset of the next IFD.
+func (t *tiffScrubber) ifd(off uint32, ifd IFD, depth int) (uint32, error) {
+	if depth >= maxIFDDepth {
+		return 0, limitError(t.format, int64(off), "IFD depth")
+	}
+	if t.visited[off] {
+		return 0, formatError(t.format, int64(off), "IFD loop")
+	}
+	t.visited[off] = true
+	entries, err := t.entries(off)
+	if err != nil {
+		return 0, err
+	}
+	next := t.order.Uint32(t.b[off+2+uint32(len(entries)):])
+
+	var kept [][]byte
+	for i := 0; i < len(entries); i += 12 {
+		entry := entries[i : i+12]
+		id := t.order.Uint16(entry)
+		sub := t.order.Uint32(entry[8:])
+		switch {
+		case ifd == IFD0 && id == 0x8825:
+			if !t.s.keep(MetadataGPS, "GPS IFD") {
+				t.zeroIFD(sub, GPSIFD, depth+1)
+				continue
+			}
+			if _, err := t.ifd(sub, GPSIFD, depth+1); err != nil {
+				return 0, err
+			}
+		case ifd == IFD0 && id == 0x8769:
+			if _, err := t.ifd(sub, ExifIFD, depth+1); err != nil {
+				return 0, err
+			}
+		case ifd == ExifIFD && id == 0xa005:
+			if _, err := t.ifd(sub, InteropIFD, depth+1); err != nil {
+				return 0, err
+			}
+		default:
+			if g := exifTagGroup(ifd, id); g != MetadataExif && g != MetadataThumbnail && g != MetadataGPS &&
+				!t.s.keep(g, fmt.Sprintf("%s 0x%04x", ifd, id)) {
+				t.zeroValue(entry)
+				continue
+			}
+		}
+		kept = append(kept, append([]byte(nil), entry...))
+	}
+	for _, entry := range kept {
+		if start, end, ok := t.valueRange(entry); ok {
+			t.protect(start, end)
+		}
+	}
+	t.protect(uint64(off), uint64(off)+2+uint64(12*len(kept))+4)
+	if len(kept) == len(entries)/12 {
+		return next, nil
+	}
+
+	t.order.PutUint16(t.b[off:], uint16(len(kept)))
+	p := off + 2
+	for _, entry := range kept {
+		copy(t.b[p:], entry)
+		p += 12
+	}
+	t.order.PutUint32(t.b[p:], next)
+	t.zero(uint64(p)+4, uint64(off)+2+uint64(len(entries))+4)
+	return next, nil
+}
+
+// zeroIFD zeroes the IFD at off with its values, sub-IFDs and thumbnail.
+func (t *tiffScrubber) zeroIFD(off uint32, ifd IFD, depth int) {
+	if depth >= maxIFDDepth || t.visited[off] {
+		return
+	}
+	t.visited[off] = true
+	entries, err := t.entries(off)
+	if err != nil {
+		return
+	}
+	var thumbOffset, thumbLength uint64
+	for i := 0; i < len(entries); i += 12 {
+		entry := entries[i : i+12]
+		switch id := t.order.Uint16(entry); {
+		case id == 0x8769 || id == 0x8825 || id == 0xa005:
+			t.zeroIFD(t.order.Uint32(entry[8:]), ifd, depth+1)
+		case ifd == IFD1 && id == 0x0201:
+			thumbOffset = uint64(t.order.Uint32(entry[8:]))
+		case ifd == IFD1 && id == 0x0202:
+			thumbLength = uint64(t.order.Uint32(entry[8:]))
+		}
+		t.zeroValue(entry)
+	}
+	if thumbLength > 0 {
+		t.zero(thumbOffset, thumbOffset+thumbLength)
+	}
+	t.zero(uint64(off), uint64(off)+2+uint64(len(entries))+4)
+}
+
+// scrubExifPayload scrubs an Exif block that may start with the JPEG Exif
+// marker, as found in PNG eXIf and WebP EXIF chunks.
+func (s *scrubber) scrubExifPayload(b []byte, format string) error {
+	if bytes.HasPrefix(b, []byte(exifMarker)) {
+		b = b[len(exifMarker):]
+	}
+	return s.scrubTIFF(b, format)
+}
+
+// jpegSegmentGroup returns the metadata group of a JPEG marker segment,
+// or "" for the segments needed to decode the image.
+func jpegSegmentGroup(marker byte, payload []byte) (MetadataGroup, string) {
+	hasPrefix := func(s string) bool { return bytes.HasPrefix(payload, []byte(s)) }
+	switch {
+	case marker == 0xE1 && hasPrefix(exifMarker):
+		return MetadataExif, "APP1 Exif"
+	case marker == 0xE1 && (hasPrefix(xmpMarker) || hasPrefix("http://ns.adobe.com/xmp/extension/\x00")):
+		return MetadataXMP, "APP1 XMP"
+	case marker == 0xE2 && hasPrefix("ICC_PROFILE\x00"):
+		return MetadataICC, "APP2 ICC_PROFILE"
+	case marker == 0xE2 && hasPrefix("MPF\x00"):
+		return MetadataTrailer, "APP2 MPF"
+	case marker == 0xED:
+		return MetadataIPTC, "APP13"
+	case marker == 0xE0, marker == 0xEE && hasPrefix("Adobe"):
+		// JFIF and Adobe color transform
+		return "", ""
+	case marker >= 0xE1 && marker <= 0xEF:
+		return MetadataOther, fmt.Sprintf("APP%d", marker-0xE0)
+	case marker == 0xFE:
+		return MetadataComment, "COM"
+	}
+	return "", ""
+}
+
+func (s *scrubber) scrubJPEG(r io.ReadSeeker, size int64) ([]scrubPiece, error) {
+	pieces := []scrubPiece{{off: 0, n: 2}}
+	mpf := -1 // index of the kept MPF segment
+	var removedAfterMPF int64
+	scan := false
+	offset := int64(2)
+	for offset < size {
+		hdr, err := readAt(r, offset, 2)
+		if err != nil {
+			return nil, err
+		}
+		if hdr[0] != 0xFF {
+			return nil, formatError("jpeg", offset, "bad marker")
+		}
+		marker := hdr[1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			offset++
+			continue
+		case marker == 0xD9:
+			pieces = append(pieces, scrubPiece{off: offset, n: 2})
+			offset += 2
+			if offset < size && s.keep(MetadataTrailer, "data after EOI") {
+				pieces = append(pieces, scrubPiece{off: offset, n: size - offset})
+			}
+			offset = size
+			continue
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD7:
+			pieces = append(pieces, scrubPiece{off: offset, n: 2})
+			offset += 2
+			continue
+		}
+
+		lenBytes, err := readAt(r, offset+2, 2)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(binary.BigEndian.Uint16(lenBytes))
+		if n < 2 || offset+2+n > size {
+			return nil, formatError("jpeg", offset, "bad segment size")
+		}
+		seg := scrubPiece{off: offset, n: 2 + n}
+		if marker == 0xDA {
+			// copy the entropy coded data up to the next marker
+			end, err := jpegNextMarker(r, offset+2+n, size)
+			if err != nil {
+				return nil, err
+			}
+			pieces = append(pieces, scrubPiece{off: offset, n: end - offset})
+			offset, scan = end, true
+			continue
+		}
+
+		var payload []byte
+		if marker >= 0xE0 && marker <= 0xEF {
+			if payload, err = readAt(r, offset+4, int(n-2)); err != nil {
+				return nil, err
+			}
+		}
+		group, detail := jpegSegmentGroup(marker, payload)
+		switch {
+		case group == "":
+			pieces = append(pieces, seg)
+		case !s.keep(group, detail):
+			if mpf >= 0 {
+				removedAfterMPF += seg.n
+			}
+		case group == MetadataExif:
+			data := append([]byte{0xFF, marker, lenBytes[0], lenBytes[1]}, payload...)
+			if err := s.scrubTIFF(data[4+len(exifMarker):], "exif"); err != nil {
+				return nil, err
+			}
+			pieces = append(pieces, scrubPiece{data: data})
+		case group == MetadataTrailer:
+			pieces = append(pieces, scrubPiece{data: append([]byte{0xFF, marker, lenBytes[0], lenBytes[1]}, payload...)})
+			mpf = len(pieces) - 1
+		default:
+			pieces = append(pieces, seg)
+		}
+		offset += seg.n
+	}
+
+	if !scan {
+		return nil, formatError("jpeg", size, "no image data")
+	}
+	if mpf >= 0 && removedAfterMPF > 0 {
+		// the images follow the primary image, which got shorter
+		if err := patchMPF(pieces[mpf].data[8:], -removedAfterMPF); err != nil {
+			return nil, err
+		}
+	}
+	return pieces, nil
+}
+
+// jpegNextMarker returns the offset of the first marker at or after off
+// that is not a restart marker, skipping the entropy coded data, or size.
+func jpegNextMarker(r io.ReadSeeker, off, size int64) (int64, error) {
+	buf := make([]byte, 64<<10)
+	for off+1 < size {
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		data, err := readAt(r, off, int(n))
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i+1 < len(data); i++ {
+			if c := data[i+1]; data[i] == 0xFF && c != 0 && c != 0xFF && (c < 0xD0 || c > 0xD7) {
+				return off + int64(i), nil
+			}
+		}
+		// a 0xFF at the end of the block is examined again
+		off += n - 1
+	}
+	return size, nil
+}
+
+// patchMPF adds delta to the offsets of the images following the first
+// one in the MP Entry (0xb002) of the MPF TIFF stream b.
+func patchMPF(b []byte, delta int64) error {
+	t := &tiffScrubber{b: b, format: "mpf"}
+	if len(b) < 8 {
+		return truncatedError("mpf", 0)
+	}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return formatError("mpf", 0, "bad TIFF byte order")
+	}
+	entries, err := t.entries(t.order.Uint32(b[4:8]))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(entries); i += 12 {
+		entry := entries[i : i+12]
+		if t.order.Uint16(entry) != 0xb002 {
+			continue
+		}
+		start, end, ok := t.valueRange(entry)
+		if !ok {
+			return formatError("mpf", int64(i), "bad MP entry")
+		}
+		for p := start; p+16 <= end; p += 16 {
+			offset := int64(t.order.Uint32(b[p+8:]))
+			if offset == 0 {
+				continue
+			}
+			if offset += delta; offset <= 0 {
+				return formatError("mpf", int64(p), "bad image offset")
+			}
+			t.order.PutUint32(b[p+8:], uint32(offset))
+		}
+	}
+	return nil
+}
+
+// pngRenderingChunks are the ancillary PNG chunks needed to display the
+// image, including the APNG animation.
+var pngRenderingChunks = map[string]bool{
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "sBIT": true,
+	"bKGD": true, "pHYs": true, "hIST": true, "sPLT": true, "cICP": true,
+	"mDCv": true, "cLLi": true, "acTL": true, "fcTL": true, "fdAT": true,
+}
+
+func (s *scrubber) scrubPNG(r io.ReadSeeker, size int64) ([]scrubPiece, error) {
+	pieces := []scrubPiece{{off: 0, n: 8}}
+	for offset := int64(8); offset < size; {
+		hdr, err := readAt(r, offset, 8)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(binary.BigEndian.Uint32(hdr))
+		typ := string(hdr[4:8])
+		chunk := scrubPiece{off: offset, n: 12 + n}
+		if offset+chunk.n > size {
+			return nil, truncatedError("png", offset)
+		}
+
+		var group MetadataGroup
+		switch {
+		case typ == "IEND":
+			pieces = append(pieces, chunk)
+			if end := offset + chunk.n; end < size && s.keep(MetadataTrailer, "data after IEND") {
+				pieces = append(pieces, scrubPiece{off: end, n: size - end})
+			}
+			return pieces, nil
+		case typ == "eXIf":
+			group = MetadataExif
+		case typ == "iCCP":
+			group = MetadataICC
+		case typ == "tIME":
+			group = MetadataExif
+		case typ == "tEXt" || typ == "zTXt" || typ == "iTXt":
+			group = MetadataComment
+			keyword, err := readAt(r, offset+8, int(minInt64(n, 18)))
+			if err != nil {
+				return nil, err
+			}
+			if string(keyword) == "XML:com.adobe.xmp\x00" {
+				group = MetadataXMP
+			}
+		case hdr[4]&0x20 == 0 || pngRenderingChunks[typ]:
+			// critical chunk
+		default:
+			group = MetadataOther
+		}
+
+		switch {
+		case group == "":
+			pieces = append(pieces, chunk)
+		case !s.keep(group, typ):
+		case typ == "eXIf":
+			data, err := readAt(r, offset, int(chunk.n))
+			if err != nil {
+				return nil, err
+			}
+			if err := s.scrubExifPayload(data[8:8+n], "exif"); err != nil {
+				return nil, err
+			}
+			binary.BigEndian.PutUint32(data[8+n:], crc32.ChecksumIEEE(data[4:8+n]))
+			pieces = append(pieces, scrubPiece{data: data})
+		default:
+			pieces = append(pieces, chunk)
+		}
+		offset += chunk.n
+	}
+	return nil, truncatedError("png", size)
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// VP8X flags of the optional chunks
+const (
+	vp8xICC  = 0x20
+	vp8xExif = 0x08
+	vp8xXMP  = 0x04
+)
+
+func (s *scrubber) scrubWebP(r io.ReadSeeker, size int64) ([]scrubPiece, error) {
+	hdr, err := readAt(r, 0, 12)
+	if err != nil {
+		return nil, err
+	}
+	end := 8 + int64(binary.LittleEndian.Uint32(hdr[4:8]))
+	if end > size {
+		return nil, truncatedError("webp", 4)
+	}
+
+	var pieces []scrubPiece
+	vp8x := -1
+	var flags byte
+	for offset := int64(12); offset+8 <= end; {
+		c, err := readAt(r, offset, 8)
+		if err != nil {
+			return nil, err
+		}
+		typ := string(c[:4])
+		n := int64(binary.LittleEndian.Uint32(c[4:8]))
+		chunk := scrubPiece{off: offset, n: 8 + n + n&1}
+		if offset+chunk.n > end {
+			return nil, truncatedError("webp", offset)
+		}
+
+		var group MetadataGroup
+		var flag byte
+		switch typ {
+		case "VP8 ", "VP8L", "ALPH", "ANIM", "ANMF":
+		case "VP8X":
+			data, err := readAt(r, offset, int(chunk.n))
+			if err != nil {
+				return nil, err
+			}
+			if len(data) < 9 {
+				return nil, truncatedError("webp", offset)
+			}
+			chunk.data = data
+			vp8x = len(pieces)
+		case "ICCP":
+			group, flag = MetadataICC, vp8xICC
+		case "EXIF":
+			group, flag = MetadataExif, vp8xExif
+		case "XMP ":
+			group, flag = MetadataXMP, vp8xXMP
+		default:
+			group = MetadataOther
+		}
+
+		switch {
+		case group == "":
+			pieces = append(pieces, chunk)
+		case !s.keep(group, typ):
+		case typ == "EXIF":
+			data, err := readAt(r, offset, int(chunk.n))
+			if err != nil {
+				return nil, err
+			}
+			if err := s.scrubExifPayload(data[8:8+n], "exif"); err != nil {
+				return nil, err
+			}
+			pieces = append(pieces, scrubPiece{data: data})
+			flags |= flag
+		default:
+			pieces = append(pieces, chunk)
+			flags |= flag
+		}
+		offset += chunk.n
+	}
+
+	if vp8x >= 0 {
+		data := pieces[vp8x].data
+		data[8] = data[8]&^(vp8xICC|vp8xExif|vp8xXMP) | flags
+	}
+	riffSize := int64(4)
+	for _, p := range pieces {
+		riffSize += p.len()
+	}
+	riff := append([]byte("RIFF"), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(riff[4:], uint32(riffSize))
+	pieces = append([]scrubPiece{{data: append(riff, "WEBP"...)}}, pieces...)
+	if end < size && s.keep(MetadataTrailer, "data after RIFF") {
+		pieces = append(pieces, scrubPiece{off: end, n: size - end})
+	}
+	return pieces, nil
+}
+
+// xmpBoxUUID is the extended type of the BMFF uuid box holding XMP.
+const xmpBoxUUID = "be7acfcb97a942e89c71999491e3afac"
+
+// movItemGroups are the QuickTime user data and metadata items not in
+// MetadataQuickTime, by box type or mdta key. Keys holding "location" are
+// in MetadataGPS.
+var movItemGroups = map[string]MetadataGroup{
+	"\xa9xyz":                         MetadataGPS,
+	"\xa9ART":                         MetadataOwner,
+	"\xa9aut":                         MetadataOwner,
+	"\xa9cpy":                         MetadataOwner,
+	"aART":                            MetadataOwner,
+	"auth":                            MetadataOwner,
+	"cprt":                            MetadataOwner,
+	"com.apple.quicktime.artist":      MetadataOwner,
+	"com.apple.quicktime.author":      MetadataOwner,
+	"com.apple.quicktime.copyright":   MetadataOwner,
+	"\xa9cmt":                         MetadataComment,
+	"\xa9des":                         MetadataComment,
+	"\xa9nam":                         MetadataComment,
+	"desc":                            MetadataComment,
+	"com.apple.quicktime.comment":     MetadataComment,
+	"com.apple.quicktime.description": MetadataComment,
+	"com.apple.quicktime.title":       MetadataComment,
+	"XMP_":                            MetadataXMP,
+}
+
+// movItemGroup returns the metadata group of a QuickTime item.
+func movItemGroup(name string) MetadataGroup {
+	if g, ok := movItemGroups[name]; ok {
+		return g
+	}
+	if strings.Contains(strings.ToLower(name), "location") {
+		return MetadataGPS
+	}
+	return MetadataQuickTime
+}
+
+// movScrubber turns the QuickTime boxes that are not kept into free boxes.
+type movScrubber struct {
+	s     *scrubber
+	r     io.ReadSeeker
+	freed []movFreedBox
+}
+
+type movFreedBox struct {
+	*bmffBox
+	largeSize bool // the size is stored in 64 bits after the type
+}
+
+func (s *scrubber) scrubMOV(r io.ReadSeeker, size int64) ([]scrubPiece, error) {
+	m := &movScrubber{s: s, r: r}
+	err := walkBoxes(r, 0, size, func(b *bmffBox) error {
+		switch b.typ {
+		case "moov":
+			return m.container(b, "moov", 1)
+		case "udta":
+			return m.udta(b, b.typ, 1)
+		case "uuid":
+			m.uuid(b, b.typ)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pieces []scrubPiece
+	offset := int64(0)
+	for _, b := range m.freed {
+		pieces = append(pieces,
+			scrubPiece{off: offset, n: b.offset + 4 - offset},
+			scrubPiece{data: []byte("free")})
+		offset = b.offset + 8
+		if b.largeSize {
+			pieces = append(pieces, scrubPiece{off: offset, n: 8})
+			offset += 8
+		}
+		pieces = append(pieces, scrubPiece{n: b.end() - offset, zero: true})
+		offset = b.end()
+	}
+	return append(pieces, scrubPiece{off: offset, n: size - offset}), nil
+}
+
+// free frees b unless its group is kept.
+func (m *movScrubber) free(b *bmffBox, g MetadataGroup, detail string) {
+	if m.s.keep(g, detail) {
+		return
+	}
+	size, err := readAt(m.r, b.offset, 4)
+	m.freed = append(m.freed, movFreedBox{b, err == nil && binary.BigEndian.Uint32(size) == 1})
+}
+
+func (m *movScrubber) uuid(b *bmffBox, path string) {
+	if b.uuid == xmpBoxUUID {
+		m.free(b, MetadataXMP, path+" XMP")
+	} else {
+		m.free(b, MetadataOther, path+" "+b.uuid)
+	}
+}
+
+// container scrubs the metadata of moov and trak boxes.
+func (m *movScrubber) container(c *bmffBox, path string, depth int) error {
+	if depth >= maxBoxDepth {
+		return limitError("mov", c.offset, "box depth")
+	}
+	return walkBoxes(m.r, c.dataOffset(), c.end(), func(b *bmffBox) error {
+		p := path + "/" + b.typ
+		switch b.typ {
+		case "cmov":
+			return formatError("mov", b.offset, "compressed moov")
+		case "trak":
+			return m.container(b, p, depth+1)
+		case "udta":
+			return m.udta(b, p, depth+1)
+		case "meta":
+			return m.meta(b, p)
+		case "uuid":
+			m.uuid(b, p)
+		}
+		return nil
+	})
+}
+
+func (m *movScrubber) udta(udta *bmffBox, path string, depth int) error {
+	if depth >= maxBoxDepth {
+		return limitError("mov", udta.offset, "box depth")
+	}
+	return walkBoxes(m.r, udta.dataOffset(), udta.end(), func(b *bmffBox) error {
+		p := path + "/" + b.typ
+		switch b.typ {
+		case "meta":
+			return m.meta(b, p)
+		case "free", "skip":
+		case "uuid":
+			m.uuid(b, p)
+		default:
+			m.free(b, movItemGroup(b.typ), p)
+		}
+		return nil
+	})
+}
+
+// meta frees the ilst items of a meta box, named after their mdta key or
+// their type.
+func (m *movScrubber) meta(meta *bmffBox, path string) error {
+	start := meta.dataOffset()
+	if head, err := readAt(m.r, start, 8); err == nil && string(head[4:8]) != "hdlr" {
+		start += 4
+	}
+	var keys []string
+	return walkBoxes(m.r, start, meta.end(), func(b *bmffBox) error {
+		switch b.typ {
+		case "keys":
+			data, err := boxPayload(m.r, b, maxMOVHeaderSize)
+			if err != nil {
+				return err
+			}
+			keys, err = parseMOVKeys(data)
+			return err
+		case "ilst":
+			return walkBoxes(m.r, b.dataOffset(), b.end(), func(item *bmffBox) error {
+				name := item.typ
+				if index := int(binary.BigEndian.Uint32([]byte(item.typ))); index >= 1 && index <= len(keys) {
+					name = keys[index-1]
+				}
+				if name != "free" {
+					m.free(item, movItemGroup(name), path+"/"+name)
+				}
+				return nil
+			})
+		case "uuid":
+			m.uuid(b, path+"/uuid")
+		}
+		return nil
+	})
+}
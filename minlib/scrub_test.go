@@ -0,0 +1,253 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sensitiveTIFF returns an Exif TIFF stream with a date, GPS, serial
+// number, artist and thumbnail IFD.
+func sensitiveTIFF(order binary.ByteOrder) []byte {
+	return buildTIFF(order, &tiffIFD{
+		entries: []tiffEntry{asciiTag(0x010f, "NIKON CORPORATION"), asciiTag(0x013b, "Jane Roe"), shortTag(order, 0x0112, 6)},
+		subs: map[uint16]*tiffIFD{
+			0x8769: {entries: []tiffEntry{asciiTag(0x9003, "2021:03:04 10:11:12"), asciiTag(0xa431, "3012345")}},
+			0x8825: {entries: []tiffEntry{asciiTag(0x0001, "N"), rationalTag(order, 0x0002, 48, 1, 51, 1, 2400, 100)}},
+		},
+		next: &tiffIFD{entries: []tiffEntry{longTag(order, 0x0103, 6), undefinedTag(0x0200, []byte("thumbnail data"))}},
+	})
+}
+
+// checkScrubbedExif checks that the Exif data kept the date and the
+// orientation and lost the rest.
+func checkScrubbedExif(t *testing.T, x *Exif, data []byte) {
+	t.Helper()
+	if x.DateTimeOriginal.IsZero() || x.Orientation != 6 || x.Make != "NIKON CORPORATION" {
+		t.Errorf("lost Exif data: %+v", x)
+	}
+	if x.GPS != nil || x.SerialNumber != "" || x.Tag(IFD0, 0x013b) != nil || x.Tag(IFD1, 0x0103) != nil {
+		t.Errorf("Exif data left: %+v", x)
+	}
+	for _, s := range []string{"3012345", "Jane Roe", "thumbnail data"} {
+		if bytes.Contains(data, []byte(s)) {
+			t.Errorf("%q left in the output", s)
+		}
+	}
+}
+
+func TestScrubJPEG(t *testing.T) {
+	xmp := jpegSegment(0xE1, []byte(xmpMarker+`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"/></x:xmpmeta>`))
+	icc := jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01profile"))
+	data := buildJPEG(
+		jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")),
+		exifAPP1(sensitiveTIFF(binary.BigEndian)),
+		icc,
+		xmp,
+		jpegSegment(0xED, []byte("Photoshop 3.0\x00by Jane Roe")),
+		jpegSegment(0xFE, []byte("shot by Jane Roe")),
+	)
+	data = append(data, "trailing video"...)
+
+	if err := VerifyScrubbed(bytes.NewReader(data), int64(len(data)), DefaultScrubPolicy); !errors.As(err, new(*ScrubError)) {
+		t.Errorf("VerifyScrubbed(input) = %v, want a ScrubError", err)
+	}
+
+	var out bytes.Buffer
+	removed, err := Scrub(&out, bytes.NewReader(data), int64(len(data)), DefaultScrubPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[MetadataGroup]bool{MetadataGPS: true, MetadataSerial: true, MetadataOwner: true,
+		MetadataThumbnail: true, MetadataXMP: true, MetadataIPTC: true, MetadataComment: true, MetadataTrailer: true}
+	for _, item := range removed {
+		if !want[item.Group] {
+			t.Errorf("unexpected removal %v", item)
+		}
+		delete(want, item.Group)
+	}
+	if len(want) > 0 {
+		t.Errorf("not removed: %v", want)
+	}
+
+	scrubbed := out.Bytes()
+	x, err := DecodeExif(bytes.NewReader(scrubbed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScrubbedExif(t, x, scrubbed)
+	if !bytes.Contains(scrubbed, icc) || bytes.Contains(scrubbed, []byte(xmpMarker)) || bytes.Contains(scrubbed, []byte("trailing")) {
+		t.Error("wrong segments kept")
+	}
+	if !bytes.HasSuffix(scrubbed, data[bytes.LastIndex(data, []byte{0xFF, 0xDA}):len(data)-len("trailing video")]) {
+		t.Error("image data changed")
+	}
+	if err := VerifyScrubbed(bytes.NewReader(scrubbed), int64(len(scrubbed)), DefaultScrubPolicy); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScrubJPEGMultiPicture(t *testing.T) {
+	le := binary.LittleEndian
+	second := buildJPEG()
+	mpf := func(offset uint32) []byte {
+		entries := make([]byte, 32)
+		le.PutUint32(entries[4:], uint32(len(second)))
+		le.PutUint32(entries[20:], uint32(len(second)))
+		le.PutUint32(entries[24:], offset)
+		return jpegSegment(0xE2, append([]byte("MPF\x00"), buildTIFF(le, &tiffIFD{entries: []tiffEntry{
+			undefinedTag(0xb000, []byte("0100")), longTag(le, 0xb001, 2), undefinedTag(0xb002, entries),
+		}})...))
+	}
+	// secondOffset returns the offset of the second image read from the MPF
+	// segment and its actual offset, both relative to the MPF TIFF header.
+	secondOffset := func(data []byte) (uint32, uint32) {
+		header := bytes.Index(data, []byte("MPF\x00")) + 4
+		x, err := parseTIFF(bytes.NewReader(data[header:]), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return le.Uint32(x.Tag(IFD0, 0xb002).Value[24:]), uint32(bytes.LastIndex(data, []byte{0xFF, 0xD8}) - header)
+	}
+	data := append(buildJPEG(mpf(0), jpegSegment(0xFE, []byte("a comment"))), second...)
+	_, actual := secondOffset(data)
+	data = append(buildJPEG(mpf(actual), jpegSegment(0xFE, []byte("a comment"))), second...)
+
+	var out bytes.Buffer
+	policy := ScrubPolicy{Keep: []MetadataGroup{MetadataTrailer}}
+	if _, err := Scrub(&out, bytes.NewReader(data), int64(len(data)), policy); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := secondOffset(out.Bytes()); got != want || want == actual {
+		t.Errorf("got MPF offset %d, want %d", got, want)
+	}
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(append(c, typ...), data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+func TestScrubPNG(t *testing.T) {
+	ihdr := pngChunk("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0})
+	idat := pngChunk("IDAT", []byte("compressed pixels"))
+	data := bytes.Join([][]byte{
+		[]byte("\x89PNG\r\n\x1a\n"),
+		ihdr,
+		pngChunk("eXIf", sensitiveTIFF(binary.LittleEndian)),
+		pngChunk("tEXt", []byte("Author\x00Jane Roe")),
+		pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")),
+		pngChunk("prVt", []byte("private")),
+		idat,
+		pngChunk("IEND", nil),
+	}, nil)
+
+	var out bytes.Buffer
+	if _, err := Scrub(&out, bytes.NewReader(data), int64(len(data)), DefaultScrubPolicy); err != nil {
+		t.Fatal(err)
+	}
+	scrubbed := out.Bytes()
+	exifChunk := bytes.Index(scrubbed, []byte("eXIf"))
+	if exifChunk < 0 || !bytes.Contains(scrubbed, ihdr) || !bytes.Contains(scrubbed, idat) ||
+		bytes.Contains(scrubbed, []byte("tEXt")) || bytes.Contains(scrubbed, []byte("iTXt")) || bytes.Contains(scrubbed, []byte("prVt")) {
+		t.Fatal("wrong chunks kept")
+	}
+	n := int(binary.BigEndian.Uint32(scrubbed[exifChunk-4:]))
+	chunk := scrubbed[exifChunk : exifChunk+4+n+4]
+	if crc32.ChecksumIEEE(chunk[:4+n]) != binary.BigEndian.Uint32(chunk[4+n:]) {
+		t.Error("bad eXIf CRC")
+	}
+	x, err := parseTIFF(bytes.NewReader(chunk[4:4+n]), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScrubbedExif(t, x, scrubbed)
+	if err := VerifyScrubbed(bytes.NewReader(scrubbed), int64(len(scrubbed)), DefaultScrubPolicy); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScrubWebP(t *testing.T) {
+	vp8x := chunk("VP8X", []byte{vp8xICC | vp8xExif | vp8xXMP, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	vp8 := chunk("VP8 ", []byte("frame"))
+	iccp := chunk("ICCP", []byte("profile"))
+	data := chunk("RIFF", []byte("WEBP"), vp8x, iccp, vp8,
+		chunk("EXIF", sensitiveTIFF(binary.LittleEndian)), chunk("XMP ", []byte("<x:xmpmeta/>")))
+
+	var out bytes.Buffer
+	policy := ScrubPolicy{Keep: []MetadataGroup{MetadataICC}}
+	if _, err := Scrub(&out, bytes.NewReader(data), int64(len(data)), policy); err != nil {
+		t.Fatal(err)
+	}
+	vp8x[8] = vp8xICC
+	if want := chunk("RIFF", []byte("WEBP"), vp8x, iccp, vp8); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("got %q, want %q", out.Bytes(), want)
+	}
+}
+
+func TestScrubMOV(t *testing.T) {
+	created := time.Date(2019, 6, 5, 7, 19, 30, 0, time.UTC)
+	data := bytes.Join([][]byte{
+		box("ftyp", []byte("qt  "), be32(0)),
+		box("moov", mvhdV0(created),
+			box("udta", box("\xa9xyz", []byte("+48.8577+002.2950/")), box("\xa9mak", []byte("Apple"))),
+			movMeta("com.apple.quicktime.make", "Apple", "com.apple.quicktime.location.ISO6709", "+48.8577+002.2950+035.000/",
+				"com.apple.quicktime.author", "Jane Roe")),
+		box("mdat", []byte("samples")),
+	}, nil)
+
+	var out bytes.Buffer
+	if _, err := Scrub(&out, bytes.NewReader(data), int64(len(data)), DefaultScrubPolicy); err != nil {
+		t.Fatal(err)
+	}
+	scrubbed := out.Bytes()
+	if len(scrubbed) != len(data) {
+		t.Fatalf("size changed from %d to %d", len(data), len(scrubbed))
+	}
+	for _, s := range []string{"+48.8577", "Jane Roe"} {
+		if bytes.Contains(scrubbed, []byte(s)) {
+			t.Errorf("%q left in the output", s)
+		}
+	}
+	m, err := parseMOV(bytes.NewReader(scrubbed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.metadata) != 1 || m.metadata["com.apple.quicktime.make"] != "Apple" || !bytes.Contains(scrubbed, []byte("\xa9mak")) {
+		t.Errorf("unexpected metadata %v", m.metadata)
+	}
+	if got, err := ReaderOriginalTime(bytes.NewReader(scrubbed), int64(len(scrubbed))); err != nil || !got.Equal(created) {
+		t.Errorf("got time %v, %v; want %v", got, err, created)
+	}
+	if err := VerifyScrubbed(bytes.NewReader(scrubbed), int64(len(scrubbed)), DefaultScrubPolicy); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScrubFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "DSC_0001.JPG")
+	if err := os.WriteFile(p, buildJPEG(exifAPP1(sensitiveTIFF(binary.LittleEndian))), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScrubFile(p, p, DefaultScrubPolicy); err != nil {
+		t.Fatal(err)
+	}
+	if err := FileVerifyScrubbed(p, DefaultScrubPolicy); err != nil {
+		t.Error(err)
+	}
+	if fi, err := os.Stat(p); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("mode not preserved: %v, %v", fi, err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(p), ".*")); len(matches) > 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+}
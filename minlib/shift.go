@@ -0,0 +1,277 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// exifTimeLayout is the layout of the Exif date tags, always stored as 19
+// characters and a NUL.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// DateChange is a date rewritten by ShiftFileDates.
+type DateChange struct {
+	// Field names the tag or box holding the date, such as
+	// "DateTimeOriginal" or "tkhd modified".
+	Field string
+	// Offset is the position of the value in the file.
+	Offset   int64
+	Old, New time.Time
+
+	data []byte // encoded new value
+}
+
+func (c DateChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Field, c.Old, c.New)
+}
+
+// ShiftFileDates adds d to the dates of file p, the way
+// `exiftool -AllDates+=` does. For JPEG and TIFF based files the Exif
+// DateTimeOriginal, DateTimeDigitized (CreateDate) and DateTime
+// (ModifyDate) tags are shifted, for QuickTime and MP4 files the creation
+// and modification times of the mvhd, tkhd and mdhd boxes. d is truncated
+// to whole seconds.
+//
+// The values are rewritten in place with the same length and everything
+// else, including the owner, links and extended attributes of p, is left
+// untouched. Exif dates not in the standard 19 character format and unset
+// QuickTime times are skipped. With dryRun the file is not modified, nor
+// when d is 0 or no date is found, which returns no change. The changes
+// made, or planned, are returned.
+//
+// When a write fails, the changes written before are returned with the
+// error: those dates are already shifted and must not be shifted again.
+func ShiftFileDates(p string, d time.Duration, dryRun bool) ([]DateChange, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMediaReader(f, fi.Size(), p)
+	if err != nil {
+		return nil, err
+	}
+
+	d = d.Truncate(time.Second)
+	changes, err := m.dateShift(d)
+	if d == 0 {
+		changes = nil
+	}
+	if err != nil || dryRun || len(changes) == 0 {
+		return changes, err
+	}
+	w, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := writeDateChanges(w, changes)
+	if err == nil {
+		err = w.Sync()
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return changes[:n], err
+}
+
+// writeDateChanges writes the planned values to w. It returns the number
+// of changes written before an error.
+func writeDateChanges(w io.WriterAt, changes []DateChange) (int, error) {
+	for i, c := range changes {
+		if _, err := w.WriteAt(c.data, c.Offset); err != nil {
+			return i, err
+		}
+	}
+	return len(changes), nil
+}
+
+// dateShift plans the changes shifting the dates of m by d.
+func (m *mediaReader) dateShift(d time.Duration) ([]DateChange, error) {
+	switch m.typ {
+	case MediaJPEG:
+		offset, err := jpegExifOffset(m.reader())
+		if err != nil {
+			return nil, err
+		}
+		return exifDateShift(io.NewSectionReader(m.ra, offset, m.size-offset), offset, d)
+	case MediaTIFF:
+		return exifDateShift(m.reader(), 0, d)
+	case MediaQuickTime, MediaMP4, MediaM4A:
+		return movDateShift(m.reader(), d)
+	}
+	return nil, fmt.Errorf("shifting the dates of %s files is not supported", m.typ)
+}
+
+// jpegExifOffset returns the offset of the TIFF header of the Exif APP1
+// segment of the JPEG stream r.
+func jpegExifOffset(r io.ReadSeeker) (int64, error) {
+	soi, err := readAt(r, 0, 2)
+	if err != nil || string(soi) != "\xFF\xD8" {
+		return 0, formatError("jpeg", 0, "header error")
+	}
+	for offset := int64(2); ; {
+		hdr, err := readAt(r, offset, 4)
+		if err != nil {
+			return 0, err
+		}
+		if hdr[0] != 0xFF {
+			return 0, formatError("jpeg", offset, "bad marker")
+		}
+		if hdr[1] == 0xDA || hdr[1] == 0xD9 {
+			return 0, errors.New("exif: failed to find exif intro marker")
+		}
+		size := int64(binary.BigEndian.Uint16(hdr[2:4]))
+		if size < 2 {
+			return 0, formatError("jpeg", offset, "bad segment size")
+		}
+		if hdr[1] == 0xE1 && size >= 2+int64(len(exifMarker)) {
+			marker, err := readAt(r, offset+4, len(exifMarker))
+			if err != nil {
+				return 0, err
+			}
+			if string(marker) == exifMarker {
+				return offset + 4 + int64(len(exifMarker)), nil
+			}
+		}
+		offset += 2 + size
+	}
+}
+
+// exifDateTags are the tags shifted by ShiftFileDates.
+var exifDateTags = []struct {
+	key  TagKey
+	name string
+}{
+	{TagKey{ExifIFD, 0x9003}, "DateTimeOriginal"},
+	{TagKey{ExifIFD, 0x9004}, "DateTimeDigitized"},
+	{TagKey{IFD0, 0x0132}, "DateTime"},
+}
+
+// exifDateShift plans the changes of the Exif dates of the TIFF stream r,
+// which starts at offset in the file.
+func exifDateShift(r io.ReadSeeker, offset int64, d time.Duration) ([]DateChange, error) {
+	x, err := parseTIFF(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var changes []DateChange
+	for _, dt := range exifDateTags {
+		t := x.Tags[dt.key]
+		if t == nil || t.Type != TypeASCII || len(t.Value) < len(exifTimeLayout) {
+			continue
+		}
+		old, err := time.ParseInLocation(exifTimeLayout, string(t.Value[:len(exifTimeLayout)]), time.UTC)
+		if err != nil {
+			continue
+		}
+		shifted := old.Add(d)
+		s := shifted.Format(exifTimeLayout)
+		if len(s) != len(exifTimeLayout) || strings.HasPrefix(s, "-") {
+			return nil, fmt.Errorf("exif: %s shifted out of range", dt.name)
+		}
+		changes = append(changes, DateChange{
+			Field:  dt.name,
+			Offset: offset + t.Offset,
+			Old:    inLocation(old, time.Local),
+			New:    inLocation(shifted, time.Local),
+			data:   []byte(s),
+		})
+	}
+	return changes, nil
+}
+
+// movDateShift plans the changes of the creation and modification times of
+// the movie, track and media headers of r.
+func movDateShift(r io.ReadSeeker, d time.Duration) ([]DateChange, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	moov, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []*bmffBox
+	var collect func(start, end int64, depth int) error
+	collect = func(start, end int64, depth int) error {
+		if depth > maxBoxDepth {
+			return limitError("mov", start, "box nesting")
+		}
+		return walkBoxes(r, start, end, func(b *bmffBox) error {
+			switch b.typ {
+			case "cmov":
+				return errors.New("mov: moov atom is compressed")
+			case "mvhd", "tkhd", "mdhd":
+				headers = append(headers, b)
+			case "trak", "mdia":
+				return collect(b.dataOffset(), b.end(), depth+1)
+			}
+			return nil
+		})
+	}
+	if err := collect(moov.dataOffset(), moov.end(), 1); err != nil {
+		return nil, err
+	}
+
+	secs := int64(d / time.Second)
+	var changes []DateChange
+	for _, b := range headers {
+		data, err := boxPayload(r, b, maxMOVHeaderSize)
+		if err != nil {
+			return nil, err
+		}
+		c := &bmffCursor{b: data}
+		version := c.u8()
+		c.skip(3) // flags
+		var fieldSize int
+		switch version {
+		case 0:
+			fieldSize = 4
+		case 1:
+			fieldSize = 8
+		default:
+			return nil, formatError("mov", b.offset, fmt.Sprintf("unsupported %s version %d", b.typ, version))
+		}
+		for i, name := range []string{"created", "modified"} {
+			v := c.uint(fieldSize)
+			if c.err != nil {
+				return nil, truncatedError("mov", b.offset)
+			}
+			if v <= quickTimeEpochDelta {
+				continue
+			}
+			if v > math.MaxInt64/2 {
+				return nil, formatError("mov", b.offset, "invalid "+b.typ+" time")
+			}
+			shifted := int64(v) + secs
+			if shifted <= quickTimeEpochDelta || (fieldSize == 4 && shifted > math.MaxUint32) {
+				return nil, fmt.Errorf("mov: %s %s time shifted out of range", b.typ, name)
+			}
+			value := make([]byte, fieldSize)
+			if fieldSize == 4 {
+				binary.BigEndian.PutUint32(value, uint32(shifted))
+			} else {
+				binary.BigEndian.PutUint64(value, uint64(shifted))
+			}
+			changes = append(changes, DateChange{
+				Field:  b.typ + " " + name,
+				Offset: b.dataOffset() + 4 + int64(i*fieldSize),
+				Old:    time.Unix(int64(v)-quickTimeEpochDelta, 0),
+				New:    time.Unix(shifted-quickTimeEpochDelta, 0),
+				data:   value,
+			})
+		}
+	}
+	return changes, nil
+}
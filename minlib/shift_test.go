@@ -0,0 +1,188 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShiftJPEGDates(t *testing.T) {
+	le := binary.LittleEndian
+	tiff := buildTIFF(le, &tiffIFD{
+		entries: []tiffEntry{asciiTag(0x010f, "Canon"), asciiTag(0x0132, "2020:12:31 23:30:00")},
+		subs: map[uint16]*tiffIFD{
+			0x8769: {entries: []tiffEntry{
+				asciiTag(0x9003, "2020:12:31 23:00:00"),
+				asciiTag(0x9004, "2020:12:31 23:00:00"),
+				asciiTag(0x9011, "+01:00"),
+			}},
+		},
+	})
+	data := buildJPEG(jpegSegment(0xE0, []byte("JFIF\x00")), exifAPP1(tiff))
+	p := filepath.Join(t.TempDir(), "IMG_0001.JPG")
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := ShiftFileDates(p, 90*time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3: %v", len(changes), changes)
+	}
+	if got, _ := os.ReadFile(p); !bytes.Equal(got, data) {
+		t.Fatal("dry run modified the file")
+	}
+
+	link := filepath.Join(filepath.Dir(p), "link.jpg")
+	if err := os.Symlink(p, link); err != nil {
+		t.Fatal(err)
+	}
+	hardLink := filepath.Join(filepath.Dir(p), "hardlink.jpg")
+	if err := os.Link(p, hardLink); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ShiftFileDates(link, 90*time.Minute, false); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symbolic link replaced: %v, %v", fi, err)
+	}
+	if fi, err := os.Stat(hardLink); err != nil {
+		t.Fatal(err)
+	} else if pi, err := os.Stat(p); err != nil || !os.SameFile(fi, pi) {
+		t.Error("hard link detached")
+	}
+	got, _ := os.ReadFile(p)
+	if len(got) != len(data) {
+		t.Fatalf("file size changed from %d to %d", len(data), len(got))
+	}
+	diff := 0
+	for i := range got {
+		if got[i] != data[i] {
+			diff++
+		}
+	}
+	if diff == 0 || diff > 3*len(exifTimeLayout) {
+		t.Errorf("%d bytes changed", diff)
+	}
+
+	x, err := FileExif(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := time.FixedZone("", 3600)
+	if want := time.Date(2021, 1, 1, 0, 30, 0, 0, zone); !x.DateTimeOriginal.Equal(want) {
+		t.Errorf("DateTimeOriginal = %v, want %v", x.DateTimeOriginal, want)
+	}
+	if s := x.str(IFD0, 0x0132); s != "2021:01:01 01:00:00" {
+		t.Errorf("DateTime = %q", s)
+	}
+	if x.Make != "Canon" {
+		t.Errorf("Make = %q", x.Make)
+	}
+}
+
+func TestShiftMOVDates(t *testing.T) {
+	created := time.Date(2022, 7, 1, 8, 30, 0, 0, time.UTC)
+	mdhd := fullBox("mdhd", 0, 0, be32(uint32(qtTime(created))), be32(0), be32(600), be32(6000), make([]byte, 4))
+	data := bytes.Join([][]byte{
+		box("ftyp", []byte("qt  "), be32(0)),
+		box("moov", mvhdV0(created), box("trak", tkhdV1(created), box("mdia", mdhd))),
+	}, nil)
+	p := filepath.Join(t.TempDir(), "clip.mov")
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := ShiftFileDates(p, -2*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the modification time of mdhd is unset
+	if len(changes) != 5 {
+		t.Errorf("got %d changes, want 5: %v", len(changes), changes)
+	}
+	want := created.Add(-2 * time.Hour)
+	f, _ := os.Open(p)
+	defer f.Close()
+	m, err := parseMOV(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range m.timeCandidates() {
+		if !c.Time.Equal(want) {
+			t.Errorf("%s = %v, want %v", c.Detail, c.Time, want)
+		}
+	}
+	if h := m.tracks[0].mdhd; h.modified != 0 {
+		t.Errorf("mdhd modified = %d, want 0", h.modified)
+	}
+}
+
+func TestShiftZero(t *testing.T) {
+	tiff := buildTIFF(binary.LittleEndian, &tiffIFD{entries: []tiffEntry{asciiTag(0x0132, "2020:12:31 23:30:00")}})
+	p := filepath.Join(t.TempDir(), "IMG_0001.JPG")
+	if err := os.WriteFile(p, buildJPEG(exifAPP1(tiff)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := ShiftFileDates(p, 0, false); err != nil || len(changes) != 0 {
+		t.Fatalf("got %v, %v, want no changes", changes, err)
+	}
+	after, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || !after.ModTime().Equal(mtime) {
+		t.Error("file rewritten by a zero shift")
+	}
+}
+
+// failingWriter fails the writes after the first n.
+type failingWriter struct {
+	n      int
+	writes []int64
+}
+
+func (w *failingWriter) WriteAt(b []byte, off int64) (int, error) {
+	if len(w.writes) == w.n {
+		return 0, errors.New("disk full")
+	}
+	w.writes = append(w.writes, off)
+	return len(b), nil
+}
+
+func TestShiftWriteError(t *testing.T) {
+	changes := []DateChange{{Field: "DateTimeOriginal", Offset: 10}, {Field: "DateTimeDigitized", Offset: 40}, {Field: "DateTime", Offset: 70}}
+	w := &failingWriter{n: 1}
+	n, err := writeDateChanges(w, changes)
+	if err == nil || n != 1 || len(w.writes) != 1 {
+		t.Errorf("got %d changes written, %v, want 1 and an error", n, err)
+	}
+}
+
+func TestShiftUnsupported(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "image.png")
+	if err := os.WriteFile(p, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ShiftFileDates(p, time.Hour, true); err == nil {
+		t.Error("expected an error")
+	}
+}
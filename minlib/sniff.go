@@ -0,0 +1,280 @@
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MediaType is the MIME type of a media file.
+type MediaType string
+
+const (
+	MediaUnknown   MediaType = "application/octet-stream"
+	MediaJPEG      MediaType = "image/jpeg"
+	MediaTIFF      MediaType = "image/tiff" // also TIFF based raw formats
+	MediaPNG       MediaType = "image/png"
+	MediaWebP      MediaType = "image/webp"
+	MediaHEIC      MediaType = "image/heic"
+	MediaHEIF      MediaType = "image/heif"
+	MediaAVIF      MediaType = "image/avif"
+	MediaCR3       MediaType = "image/x-canon-cr3"
+	MediaRAF       MediaType = "image/x-fuji-raf"
+	MediaQuickTime MediaType = "video/quicktime"
+	MediaMP4       MediaType = "video/mp4"
+	MediaM4A       MediaType = "audio/mp4"
+	MediaAVI       MediaType = "video/x-msvideo"
+	MediaMatroska  MediaType = "video/x-matroska"
+	MediaWebM      MediaType = "video/webm"
+	MediaMPEGTS    MediaType = "video/mp2t"
+	MediaMP3       MediaType = "audio/mpeg"
+	MediaFLAC      MediaType = "audio/flac"
+	MediaOgg       MediaType = "audio/ogg"
+	MediaWAV       MediaType = "audio/wav"
+	MediaPDF       MediaType = "application/pdf"
+	MediaDOCX      MediaType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MediaXLSX      MediaType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	MediaPPTX      MediaType = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	MediaXMP       MediaType = "application/rdf+xml"
+)
+
+// sniffLen is the number of bytes examined by DetectMediaType.
+const sniffLen = 512
+
+var extMediaTypes = map[string]MediaType{
+	".jpg":  MediaJPEG,
+	".jpeg": MediaJPEG,
+	".tif":  MediaTIFF,
+	".tiff": MediaTIFF,
+	".arw":  MediaTIFF,
+	".nef":  MediaTIFF,
+	".cr2":  MediaTIFF,
+	".dng":  MediaTIFF,
+	".orf":  MediaTIFF,
+	".rw2":  MediaTIFF,
+	".pef":  MediaTIFF,
+	".png":  MediaPNG,
+	".webp": MediaWebP,
+	".heic": MediaHEIC,
+	".heif": MediaHEIF,
+	".avif": MediaAVIF,
+	".cr3":  MediaCR3,
+	".raf":  MediaRAF,
+	".mov":  MediaQuickTime,
+	".mp4":  MediaMP4,
+	".m4v":  MediaMP4,
+	".m4a":  MediaM4A,
+	".avi":  MediaAVI,
+	".mkv":  MediaMatroska,
+	".webm": MediaWebM,
+	".mts":  MediaMPEGTS,
+	".m2ts": MediaMPEGTS,
+	".ts":   MediaMPEGTS,
+	".mp3":  MediaMP3,
+	".flac": MediaFLAC,
+	".ogg":  MediaOgg,
+	".oga":  MediaOgg,
+	".opus": MediaOgg,
+	".wav":  MediaWAV,
+	".pdf":  MediaPDF,
+	".docx": MediaDOCX,
+	".xlsx": MediaXLSX,
+	".pptx": MediaPPTX,
+	".xmp":  MediaXMP,
+}
+
+// mediaTypeByExt returns the media type usually stored with the extension
+// of p.
+func mediaTypeByExt(p string) MediaType {
+	if t, ok := extMediaTypes[strings.ToLower(filepath.Ext(p))]; ok {
+		return t
+	}
+	return MediaUnknown
+}
+
+// DetectMediaType returns the media type of r from its magic bytes, reading
+// at most 512 bytes.
+func DetectMediaType(r io.Reader) (MediaType, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return MediaUnknown, err
+	}
+	return sniffMediaType(head[:n]), nil
+}
+
+// FileMediaType returns the media type of file p from its content, falling
+// back to its extension when the content is not recognized.
+func FileMediaType(p string) (MediaType, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return MediaUnknown, err
+	}
+	defer f.Close()
+	t, err := DetectMediaType(f)
+	if err != nil {
+		return MediaUnknown, err
+	}
+	if t == MediaUnknown {
+		t = mediaTypeByExt(p)
+	}
+	return t, nil
+}
+
+func sniffMediaType(head []byte) MediaType {
+	hasPrefix := func(s string) bool {
+		return bytes.HasPrefix(head, []byte(s))
+	}
+	switch {
+	case hasPrefix("\xFF\xD8\xFF"):
+		return MediaJPEG
+	case hasPrefix("II*\x00"), hasPrefix("MM\x00*"),
+		hasPrefix("IIRO"), hasPrefix("IIRS"), hasPrefix("MMOR"), hasPrefix("IIU\x00"):
+		return MediaTIFF
+	case hasPrefix("\x89PNG\r\n\x1a\n"):
+		return MediaPNG
+	case hasPrefix("FUJIFILMCCD-RAW"):
+		return MediaRAF
+	case hasPrefix("\x1A\x45\xDF\xA3"):
+		// EBML header, the DocType tells Matroska from WebM
+		docType := head
+		if len(docType) > 64 {
+			docType = docType[:64]
+		}
+		if bytes.Contains(docType, []byte("webm")) {
+			return MediaWebM
+		}
+		return MediaMatroska
+	case len(head) >= 12 && hasPrefix("RIFF"):
+		switch string(head[8:12]) {
+		case "AVI ", "AVIX":
+			return MediaAVI
+		case "WEBP":
+			return MediaWebP
+		case "WAVE":
+			return MediaWAV
+		}
+	case hasPrefix("ID3") && len(head) >= 10:
+		// FLAC files may start with an ID3 tag too
+		end := 10 + int(syncsafe(head[6:10]))
+		if end+4 <= len(head) && string(head[end:end+4]) == "fLaC" {
+			return MediaFLAC
+		}
+		return MediaMP3
+	case hasPrefix("fLaC"):
+		return MediaFLAC
+	case hasPrefix("OggS"):
+		return MediaOgg
+	case hasPrefix("%PDF-"):
+		return MediaPDF
+	case hasPrefix("PK\x03\x04"):
+		if t := sniffOOXML(head); t != MediaUnknown {
+			return t
+		}
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return sniffBMFFBrands(head)
+	case len(head) >= 8 && isQuickTimeAtom(string(head[4:8])):
+		// QuickTime files predating the ftyp atom
+		return MediaQuickTime
+	}
+	if isMPEGTS(head) {
+		return MediaMPEGTS
+	}
+	if len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 != 0 {
+		// MPEG audio frame sync of layer I, II or III, without ID3 tag
+		return MediaMP3
+	}
+	if isXMPPacket(head) {
+		return MediaXMP
+	}
+	return MediaUnknown
+}
+
+// sniffBMFFBrands tells the ISO-BMFF based formats from the major and
+// compatible brands of the ftyp box.
+func sniffBMFFBrands(head []byte) MediaType {
+	size := int(binary.BigEndian.Uint32(head[0:4]))
+	if size > len(head) || size < 16 {
+		size = 16
+	}
+	brands := []string{string(head[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+
+	heif := false
+	for _, brand := range brands {
+		switch brand {
+		case "heic", "heix", "heim", "heis", "hevc", "hevx":
+			return MediaHEIC
+		case "avif", "avis":
+			return MediaAVIF
+		case "crx ":
+			return MediaCR3
+		case "mif1", "msf1":
+			heif = true
+		}
+	}
+	if heif {
+		return MediaHEIF
+	}
+	switch brands[0] {
+	case "qt  ":
+		return MediaQuickTime
+	case "M4A ", "M4B ", "M4P ":
+		return MediaM4A
+	}
+	return MediaMP4
+}
+
+func isQuickTimeAtom(typ string) bool {
+	switch typ {
+	case "moov", "mdat", "wide", "free", "skip", "pnot":
+		return true
+	}
+	return false
+}
+
+// isMPEGTS looks for the sync byte of consecutive 188 byte packets, or 192
+// byte packets with a 4 byte timecode for M2TS.
+func isMPEGTS(head []byte) bool {
+	for _, layout := range []struct{ start, size int }{{0, 188}, {4, 192}} {
+		if len(head) < layout.start+2*layout.size+1 {
+			continue
+		}
+		if head[layout.start] == 0x47 && head[layout.start+layout.size] == 0x47 &&
+			head[layout.start+2*layout.size] == 0x47 {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffOOXML tells the Office Open XML documents from the part names in
+// the first entries of a zip archive. Other zip archives are unknown.
+func sniffOOXML(head []byte) MediaType {
+	if !bytes.Contains(head, []byte("[Content_Types].xml")) && !bytes.Contains(head, []byte("_rels/.rels")) &&
+		!bytes.Contains(head, []byte("docProps/")) {
+		return MediaUnknown
+	}
+	switch {
+	case bytes.Contains(head, []byte("word/")):
+		return MediaDOCX
+	case bytes.Contains(head, []byte("xl/")):
+		return MediaXLSX
+	case bytes.Contains(head, []byte("ppt/")):
+		return MediaPPTX
+	}
+	return MediaUnknown
+}
+
+// isXMPPacket looks for the packet wrapper or the root element of a
+// standalone XMP file.
+func isXMPPacket(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+	return bytes.HasPrefix(head, []byte("<?xpacket")) || bytes.HasPrefix(head, []byte("<x:xmpmeta"))
+}
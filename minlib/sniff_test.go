@@ -0,0 +1,110 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDetectMediaType(t *testing.T) {
+	ts := make([]byte, 3*188)
+	ts[0], ts[188], ts[376] = 0x47, 0x47, 0x47
+
+	cases := []struct {
+		data []byte
+		want MediaType
+	}{
+		{buildJPEG(), MediaJPEG},
+		{buildTIFF(binary.LittleEndian, &tiffIFD{}), MediaTIFF},
+		{[]byte("IIRO\x08\x00\x00\x00"), MediaTIFF},
+		{[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), MediaPNG},
+		{[]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), MediaWebP},
+		{[]byte("RIFF\x00\x00\x00\x00AVI LIST"), MediaAVI},
+		{box("ftyp", []byte("heic"), be32(0), []byte("mif1heic")), MediaHEIC},
+		{box("ftyp", []byte("mif1"), be32(0), []byte("mif1")), MediaHEIF},
+		{box("ftyp", []byte("avif"), be32(0)), MediaAVIF},
+		{box("ftyp", []byte("crx "), be32(1)), MediaCR3},
+		{box("ftyp", []byte("qt  "), be32(0)), MediaQuickTime},
+		{box("ftyp", []byte("isom"), be32(0), []byte("isomavc1")), MediaMP4},
+		{box("ftyp", []byte("M4A "), be32(0)), MediaM4A},
+		{box("moov", mvhdV0(time.Unix(0, 0))), MediaQuickTime},
+		{[]byte("\x1A\x45\xDF\xA3\x9f\x42\x82\x84webm"), MediaWebM},
+		{[]byte("\x1A\x45\xDF\xA3\x9f\x42\x82\x88matroska"), MediaMatroska},
+		{ts, MediaMPEGTS},
+		{[]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), MediaMP3},
+		{[]byte("\xFF\xFB\x90\x64"), MediaMP3},
+		{[]byte("fLaC\x00\x00\x00\x22"), MediaFLAC},
+		{[]byte("OggS\x00\x02"), MediaOgg},
+		{[]byte("RIFF\x00\x00\x00\x00WAVEfmt "), MediaWAV},
+		{[]byte("%PDF-1.7\n"), MediaPDF},
+		{[]byte("PK\x03\x04\x14\x00[Content_Types].xmlPK\x03\x04word/document.xml"), MediaDOCX},
+		{[]byte("PK\x03\x04\x14\x00notes.txt"), MediaUnknown},
+		{[]byte("plain text"), MediaUnknown},
+		{nil, MediaUnknown},
+	}
+	for i, c := range cases {
+		got, err := DetectMediaType(bytes.NewReader(c.data))
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%d: got %s, want %s", i, got, c.want)
+		}
+	}
+}
+
+func TestFileMediaTypeMisnamed(t *testing.T) {
+	dir := t.TempDir()
+	jpgTime := time.Date(2020, 2, 3, 4, 5, 6, 0, time.Local)
+	movTime := time.Date(2022, 7, 1, 8, 30, 0, 0, time.UTC)
+	jpg := buildJPEG(exifAPP1(testExifTIFF(binary.BigEndian, "2020:02:03 04:05:06")))
+	mov := bytes.Join([][]byte{box("ftyp", []byte("qt  "), be32(0)), box("moov", mvhdV0(movTime))}, nil)
+
+	cases := []struct {
+		name string
+		data []byte
+		typ  MediaType
+		want time.Time
+	}{
+		{"photo.png", jpg, MediaJPEG, jpgTime},
+		{"clip.mp4", mov, MediaQuickTime, movTime},
+		{"download", jpg, MediaJPEG, jpgTime},
+		{"noext", mov, MediaQuickTime, movTime},
+	}
+	for _, c := range cases {
+		p := filepath.Join(dir, c.name)
+		if err := os.WriteFile(p, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		typ, err := FileMediaType(p)
+		if err != nil || typ != c.typ {
+			t.Errorf("%s: FileMediaType = %s, %v, want %s", c.name, typ, err, c.typ)
+		}
+		got, err := FileOriginalTime(p)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFileMediaTypeExtensionFallback(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "clip.MTS")
+	if err := os.WriteFile(p, []byte("short"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	typ, err := FileMediaType(p)
+	if err != nil || typ != MediaMPEGTS {
+		t.Errorf("got %s, %v, want %s", typ, err, MediaMPEGTS)
+	}
+}
@@ -0,0 +1,138 @@
+package minlib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// The extractors read media files through a mediaReader. The path based
+// functions (FileExif, FileTime, ...) open files from the OS, the Reader
+// functions take an io.ReaderAt and its size, and the FS functions open
+// files from an fs.FS, such as a zip archive or an fstest.MapFS.
+
+// maxBufferedFileSize limits the size of files read into memory because
+// they do not support random access, such as compressed zip entries.
+const maxBufferedFileSize = 1 << 30
+
+// fileSystem is where media files and their sidecars are looked up.
+type fileSystem interface {
+	open(name string) (fs.File, error)
+	stat(name string) (fs.FileInfo, error)
+	readDir(name string) ([]fs.DirEntry, error)
+	split(name string) (dir, file string)
+	join(elem ...string) string
+}
+
+// osFS looks up OS paths.
+type osFS struct{}
+
+func (osFS) open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) readDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) split(name string) (string, string)         { return filepath.Split(name) }
+func (osFS) join(elem ...string) string                 { return filepath.Join(elem...) }
+
+// ioFS looks up slash separated names in an fs.FS.
+type ioFS struct {
+	fsys fs.FS
+}
+
+func (f ioFS) open(name string) (fs.File, error)          { return f.fsys.Open(name) }
+func (f ioFS) stat(name string) (fs.FileInfo, error)      { return fs.Stat(f.fsys, name) }
+func (f ioFS) readDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(f.fsys, name) }
+func (ioFS) split(name string) (string, string)           { return path.Split(name) }
+func (ioFS) join(elem ...string) string                   { return path.Join(elem...) }
+
+// isRegularFile reports whether name is a regular file of fsys.
+func isRegularFile(fsys fileSystem, name string) bool {
+	fi, err := fsys.stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// mediaReader gives random access to the content of a media file.
+type mediaReader struct {
+	ra   io.ReaderAt
+	size int64
+	typ  MediaType
+	// closer closes the file ra reads from.
+	closer io.Closer
+
+	// png and pngErr cache the result of parsePNG, which is walked once
+	// for the dates, the XMP packet and the tIME chunk.
+	png    *pngMetadata
+	pngErr error
+}
+
+// newMediaReader sniffs the media type of ra, falling back to the
+// extension of name when the content is not recognized.
+func newMediaReader(ra io.ReaderAt, size int64, name string) (*mediaReader, error) {
+	if size < 0 {
+		return nil, errors.New("negative size")
+	}
+	m := &mediaReader{ra: ra, size: size}
+	typ, err := DetectMediaType(m.reader())
+	if err != nil {
+		return nil, err
+	}
+	if typ == MediaUnknown && name != "" {
+		typ = mediaTypeByExt(name)
+	}
+	m.typ = typ
+	return m, nil
+}
+
+// reader returns a new reader positioned at the start of the file.
+func (m *mediaReader) reader() io.ReadSeeker {
+	return io.NewSectionReader(m.ra, 0, m.size)
+}
+
+// Close closes the file the content is read from, if any.
+func (m *mediaReader) Close() error {
+	if m.closer == nil {
+		return nil
+	}
+	return m.closer.Close()
+}
+
+// openMedia opens name in fsys. Files that do not implement io.ReaderAt
+// are read into memory.
+func openMedia(fsys fileSystem, name string) (*mediaReader, error) {
+	f, err := fsys.open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, errors.New(name + " is a directory")
+	}
+
+	if ra, ok := f.(io.ReaderAt); ok {
+		m, err := newMediaReader(ra, fi.Size(), name)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		m.closer = f
+		return m, nil
+	}
+
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxBufferedFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBufferedFileSize {
+		return nil, errors.New(name + " is too large to be read into memory")
+	}
+	return newMediaReader(bytes.NewReader(data), int64(len(data)), name)
+}
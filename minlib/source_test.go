@@ -0,0 +1,141 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// onlyReader hides the io.Seeker of the wrapped reader.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestExtractExifDateTimeWithoutSeeker(t *testing.T) {
+	want := time.Date(2020, 2, 3, 4, 5, 6, 0, time.Local)
+	tiff := testExifTIFF(binary.LittleEndian, "2020:02:03 04:05:06")
+	for name, data := range map[string][]byte{
+		"JPEG": buildJPEG(exifAPP1(tiff)),
+		"TIFF": tiff,
+	} {
+		got, err := ExtractExifDateTime(onlyReader{bytes.NewReader(data)})
+		if err != nil || !got.Equal(want) {
+			t.Errorf("%s: got %v, %v; want %v", name, got, err, want)
+		}
+	}
+}
+
+func TestDecodeExifAtOffset(t *testing.T) {
+	tiff := testExifTIFF(binary.BigEndian, "2020:02:03 04:05:06")
+	r := bytes.NewReader(append([]byte("garbage"), tiff...))
+	r.Seek(7, io.SeekStart)
+	x, err := DecodeExif(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Make != "Apple" {
+		t.Errorf("Make = %q", x.Make)
+	}
+}
+
+func TestReaderOriginalTime(t *testing.T) {
+	movTime := time.Date(2022, 7, 1, 8, 30, 0, 0, time.UTC)
+	jpgTime := time.Date(2020, 2, 3, 4, 5, 6, 0, time.Local)
+	cases := []struct {
+		data []byte
+		want time.Time
+	}{
+		{buildJPEG(exifAPP1(testExifTIFF(binary.BigEndian, "2020:02:03 04:05:06"))), jpgTime},
+		{bytes.Join([][]byte{box("ftyp", []byte("qt  "), be32(0)), box("moov", mvhdV0(movTime))}, nil), movTime},
+		{[]byte(testXMPElements), time.Date(2017, 1, 2, 3, 4, 5, 0, time.Local)},
+	}
+	for i, c := range cases {
+		got, err := ReaderOriginalTime(bytes.NewReader(c.data), int64(len(c.data)))
+		if err != nil || !got.Equal(c.want) {
+			t.Errorf("%d: got %v, %v; want %v", i, got, err, c.want)
+		}
+	}
+
+	x, err := ReaderExif(bytes.NewReader(cases[0].data), int64(len(cases[0].data)))
+	if err != nil || x.Make != "Apple" {
+		t.Errorf("ReaderExif() = %v, %v", x, err)
+	}
+	if _, err := ReaderOriginalTime(bytes.NewReader(nil), 0); err == nil {
+		t.Error("expected an error for empty input")
+	}
+}
+
+func TestFSOriginalTime(t *testing.T) {
+	mtime := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dcim/IMG_0001.JPG":     {Data: buildJPEG(exifAPP1(testExifTIFF(binary.LittleEndian, "2020:02:03 04:05:06")))},
+		"dcim/clip.mkv":         {Data: []byte("no metadata"), ModTime: mtime},
+		"dcim/clip.mkv.xmp":     {Data: []byte(testXMPElements)},
+		"dcim/IMG_20190102.bin": {Data: []byte("no metadata"), ModTime: mtime},
+		"dcim/unknown.bin":      {Data: []byte("no metadata"), ModTime: mtime},
+	}
+	cases := []struct {
+		name   string
+		want   time.Time
+		source TimeSource
+	}{
+		{"dcim/IMG_0001.JPG", time.Date(2020, 2, 3, 4, 5, 6, 0, time.Local), SourceExif},
+		{"dcim/clip.mkv", time.Date(2017, 1, 2, 3, 4, 5, 0, time.Local), SourceXMP},
+		{"dcim/IMG_20190102.bin", time.Date(2019, 1, 2, 0, 0, 0, 0, time.Local), SourceFilename},
+		{"dcim/unknown.bin", mtime, SourceMtime},
+	}
+	for _, c := range cases {
+		r, err := ResolveFSTime(fsys, c.name)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !r.Time.Equal(c.want) || r.Source != c.source {
+			t.Errorf("%s: got %v from %s, want %v from %s", c.name, r.Time, r.Source, c.want, c.source)
+		}
+		if c.source == SourceMtime {
+			continue
+		}
+		if got, err := FSOriginalTime(fsys, c.name); err != nil || !got.Equal(c.want) {
+			t.Errorf("%s: FSOriginalTime() = %v, %v", c.name, got, err)
+		}
+	}
+}
+
+func TestResolveFSTimeZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{
+		"Takeout/Google Photos/IMG_1234.jpg":      buildJPEG(),
+		"Takeout/Google Photos/IMG_1234.jpg.json": []byte(testTakeoutJSON),
+	} {
+		// compressed entries do not implement io.ReaderAt
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ResolveFSTime(zr, "Takeout/Google Photos/IMG_1234.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1546300800, 0); !r.Time.Equal(want) || r.Source != SourceSidecar {
+		t.Errorf("got %v from %s, want %v from the Takeout sidecar", r.Time, r.Source, want)
+	}
+}
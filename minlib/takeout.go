@@ -0,0 +1,173 @@
+package minlib
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google Takeout exports every photo with a JSON sidecar holding the
+// metadata Google Photos knows about it. The sidecar of "IMG_1234.jpg" is
+// "IMG_1234.jpg.json" (or "IMG_1234.jpg.supplemental-metadata.json"), with
+// these quirks:
+//   - the name before ".json" is truncated to 46 characters, giving names
+//     such as "a_very_long_file_name.jp.json"
+//   - the duplicate counter moves behind the extension:
+//     "IMG_1234(1).jpg" -> "IMG_1234.jpg(1).json"
+//   - edited copies share the sidecar of the original:
+//     "IMG_1234-edited.jpg" -> "IMG_1234.jpg.json"
+
+const takeoutMaxStem = 46
+
+const maxTakeoutSize = 1 << 20
+
+// TakeoutMetadata is the content of a Google Takeout JSON sidecar.
+type TakeoutMetadata struct {
+	Title          string
+	Description    string
+	PhotoTakenTime time.Time
+	CreationTime   time.Time
+	// GeoData is nil when Google Photos has no location for the photo.
+	GeoData *GPSInfo
+}
+
+type takeoutTimestamp struct {
+	Timestamp string `json:"timestamp"`
+}
+
+func (t takeoutTimestamp) time() time.Time {
+	secs, err := strconv.ParseInt(strings.TrimSpace(t.Timestamp), 10, 64)
+	if err != nil || secs <= 0 {
+		return zeroTime
+	}
+	return time.Unix(secs, 0)
+}
+
+type takeoutGeoData struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+func (g *takeoutGeoData) info() *GPSInfo {
+	if g == nil || (g.Latitude == 0 && g.Longitude == 0) {
+		return nil
+	}
+	return &GPSInfo{
+		Latitude:    g.Latitude,
+		Longitude:   g.Longitude,
+		HasPosition: true,
+		Altitude:    g.Altitude,
+		HasAltitude: g.Altitude != 0,
+	}
+}
+
+// ParseTakeoutJSON decodes a Google Takeout JSON sidecar.
+func ParseTakeoutJSON(data []byte) (*TakeoutMetadata, error) {
+	var v struct {
+		Title          string           `json:"title"`
+		Description    string           `json:"description"`
+		PhotoTakenTime takeoutTimestamp `json:"photoTakenTime"`
+		CreationTime   takeoutTimestamp `json:"creationTime"`
+		GeoData        *takeoutGeoData  `json:"geoData"`
+		GeoDataExif    *takeoutGeoData  `json:"geoDataExif"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	m := &TakeoutMetadata{
+		Title:          v.Title,
+		Description:    v.Description,
+		PhotoTakenTime: v.PhotoTakenTime.time(),
+		CreationTime:   v.CreationTime.time(),
+		GeoData:        v.GeoData.info(),
+	}
+	if m.GeoData == nil {
+		m.GeoData = v.GeoDataExif.info()
+	}
+	return m, nil
+}
+
+var takeoutDuplicate = regexp.MustCompile(`^(.*)(\(\d+\))$`)
+
+// truncateTakeoutStem truncates a sidecar name (without ".json") the way
+// Google Takeout does.
+func truncateTakeoutStem(s string) string {
+	r := []rune(s)
+	if len(r) > takeoutMaxStem {
+		return string(r[:takeoutMaxStem])
+	}
+	return s
+}
+
+// takeoutSidecarNames returns the candidate sidecar names of the media
+// file name, most likely first.
+func takeoutSidecarNames(name string) []string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	var dup string
+	if m := takeoutDuplicate.FindStringSubmatch(base); m != nil {
+		base, dup = m[1], m[2]
+	}
+	bases := []string{base}
+	if edited := strings.TrimSuffix(base, "-edited"); edited != base {
+		bases = append(bases, edited)
+	}
+
+	var names []string
+	for _, b := range bases {
+		for _, stem := range []string{b + ext, b + ext + ".supplemental-metadata", b} {
+			names = append(names, truncateTakeoutStem(stem)+dup+".json")
+		}
+		if dup != "" {
+			names = append(names, truncateTakeoutStem(b+dup+ext)+".json")
+		}
+	}
+	return names
+}
+
+// FindTakeoutSidecar returns the path of the Google Takeout JSON sidecar of
+// the media file p.
+func FindTakeoutSidecar(p string) (string, bool) {
+	return findTakeoutSidecar(osFS{}, p)
+}
+
+func findTakeoutSidecar(fsys fileSystem, p string) (string, bool) {
+	dir, name := fsys.split(p)
+	for _, candidate := range takeoutSidecarNames(name) {
+		candidate = fsys.join(dir, candidate)
+		if isRegularFile(fsys, candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// FileTakeoutMetadata returns the content of the Google Takeout sidecar of
+// the media file p.
+func FileTakeoutMetadata(p string) (*TakeoutMetadata, error) {
+	return takeoutMetadata(osFS{}, p)
+}
+
+func takeoutMetadata(fsys fileSystem, p string) (*TakeoutMetadata, error) {
+	sidecar, ok := findTakeoutSidecar(fsys, p)
+	if !ok {
+		return nil, errors.New("takeout: no JSON sidecar")
+	}
+	f, err := fsys.open(sidecar)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxTakeoutSize))
+	if err != nil {
+		return nil, err
+	}
+	return ParseTakeoutJSON(data)
+}
@@ -0,0 +1,74 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTakeoutJSON = `{
+  "title": "IMG_1234.jpg",
+  "photoTakenTime": {"timestamp": "1546300800", "formatted": "Jan 1, 2019, 12:00:00 AM UTC"},
+  "creationTime": {"timestamp": "1600000000"},
+  "geoData": {"latitude": 0.0, "longitude": 0.0, "altitude": 0.0},
+  "geoDataExif": {"latitude": 48.8566, "longitude": 2.3522, "altitude": 35.0}
+}`
+
+func TestFindTakeoutSidecar(t *testing.T) {
+	long := strings.Repeat("x", 39) + ".jpg" // "long" + long is 47 characters
+	cases := []struct {
+		media, sidecar string
+	}{
+		{"IMG_1234.jpg", "IMG_1234.jpg.json"},
+		{"IMG_1234(1).jpg", "IMG_1234.jpg(1).json"},
+		{"IMG_1234-edited.jpg", "IMG_1234.jpg.json"},
+		{"IMG_5678.jpg", "IMG_5678.jpg.supplemental-metadata.json"},
+		{"IMG_9012.HEIC", "IMG_9012.json"},
+		{"long" + long, truncateTakeoutStem("long"+long) + ".json"},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, c.sidecar), []byte(testTakeoutJSON), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := FindTakeoutSidecar(filepath.Join(dir, c.media))
+		if !ok || filepath.Base(got) != c.sidecar {
+			t.Errorf("FindTakeoutSidecar(%q) = %q, %v; want %q", c.media, got, ok, c.sidecar)
+		}
+	}
+	if got := truncateTakeoutStem("long" + long); !strings.HasSuffix(got, ".jp") {
+		t.Errorf("unexpected truncation %q", got)
+	}
+}
+
+func TestTakeoutFileTime(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "IMG_20200101_000000.jpg")
+	if err := os.WriteFile(p, buildJPEG(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p+".json", []byte(testTakeoutJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FileTime(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1546300800, 0); !got.Equal(want) {
+		t.Errorf("FileTime() = %v, want the Takeout time %v", got, want)
+	}
+
+	m, err := FileTakeoutMetadata(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.GeoData == nil || m.GeoData.Latitude != 48.8566 || m.Title != "IMG_1234.jpg" {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+}
@@ -0,0 +1,227 @@
+package minlib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"strings"
+	"time"
+)
+
+// VideoInfo describes the streams of a video file. Zero values are
+// unknown.
+type VideoInfo struct {
+	Duration time.Duration
+	// Width and Height are the size of the video frames, before rotation.
+	Width, Height int
+	// Matrix is the transformation matrix of the video track, as stored
+	// in the QuickTime tkhd box: a, b, u, c, d, v, x, y, w.
+	Matrix [9]float64
+	// Rotation is the clockwise rotation of the matrix in degrees: 0, 90,
+	// 180 or 270.
+	Rotation int
+	// VideoCodec and AudioCodec name the coding of the first video and
+	// audio streams: the sample description format of MP4 and QuickTime
+	// files ("avc1", "hvc1", "mp4a" ...), the FourCC of AVI video streams
+	// ("H264", "MJPG" ...) and the name of AVI audio formats ("pcm",
+	// "mp3" ...).
+	VideoCodec, AudioCodec string
+	// FrameRate is the number of frames per second of the video stream.
+	FrameRate float64
+	// BitRate is the average number of bits per second of the file.
+	BitRate int64
+}
+
+// FileVideoInfo returns the properties of the MP4, QuickTime or AVI file p.
+func FileVideoInfo(p string) (*VideoInfo, error) {
+	return fileVideoInfo(osFS{}, p)
+}
+
+// FSVideoInfo returns the properties of the MP4, QuickTime or AVI file name
+// of fsys.
+func FSVideoInfo(fsys fs.FS, name string) (*VideoInfo, error) {
+	return fileVideoInfo(ioFS{fsys}, name)
+}
+
+// ReaderVideoInfo returns the properties of the MP4, QuickTime or AVI file
+// in the size bytes of r.
+func ReaderVideoInfo(r io.ReaderAt, size int64) (*VideoInfo, error) {
+	m, err := newMediaReader(r, size, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.videoInfo()
+}
+
+func fileVideoInfo(fsys fileSystem, name string) (*VideoInfo, error) {
+	m, err := openMedia(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return m.videoInfo()
+}
+
+func (m *mediaReader) videoInfo() (*VideoInfo, error) {
+	var v *VideoInfo
+	switch m.typ {
+	case MediaQuickTime, MediaMP4, MediaM4A:
+		mov, err := parseMOV(m.reader())
+		if err != nil {
+			return nil, err
+		}
+		v = mov.videoInfo()
+	case MediaAVI:
+		avi, err := parseAVI(m.reader())
+		if err != nil {
+			return nil, err
+		}
+		v = avi.videoInfo()
+	default:
+		return nil, fmt.Errorf("video info of %s files is not supported", m.typ)
+	}
+	if v.Duration > 0 {
+		v.BitRate = int64(float64(m.size) * 8 / v.Duration.Seconds())
+	}
+	return v, nil
+}
+
+// seconds returns the duration of n units of scale per second.
+func seconds(n uint64, scale uint32) time.Duration {
+	if scale == 0 {
+		return 0
+	}
+	return time.Duration(float64(n) / float64(scale) * float64(time.Second))
+}
+
+func (m *movMovie) videoInfo() *VideoInfo {
+	v := &VideoInfo{Duration: seconds(m.mvhd.duration, m.mvhd.timescale)}
+	for _, trak := range m.tracks {
+		switch {
+		case trak.handler == "vide" && v.VideoCodec == "":
+			v.VideoCodec = trak.format
+			v.Width, v.Height = trak.width, trak.height
+			if h := trak.tkhd; h != nil {
+				if h.width > 0 && h.height > 0 && (v.Width == 0 || v.Height == 0) {
+					v.Width, v.Height = int(h.width>>16), int(h.height>>16)
+				}
+				v.setMatrix(h.matrix)
+			}
+			if h := trak.mdhd; h != nil && h.duration > 0 && h.timescale > 0 {
+				v.FrameRate = float64(trak.samples) * float64(h.timescale) / float64(h.duration)
+			}
+		case trak.handler == "soun" && v.AudioCodec == "":
+			v.AudioCodec = trak.format
+		}
+	}
+	return v
+}
+
+// setMatrix sets the matrix and the rotation it describes. The rotation is
+// only set for matrices rotating by a multiple of 90 degrees.
+func (v *VideoInfo) setMatrix(matrix [9]int32) {
+	for i, x := range matrix {
+		if i%3 == 2 {
+			// u, v and w are 2.30 fixed point
+			v.Matrix[i] = float64(x) / (1 << 30)
+		} else {
+			v.Matrix[i] = float64(x) / (1 << 16)
+		}
+	}
+	a, b := v.Matrix[0], v.Matrix[1]
+	degrees := math.Atan2(b, a) * 180 / math.Pi
+	if r := math.Round(degrees/90) * 90; math.Abs(r-degrees) < 1 {
+		v.Rotation = (int(r) + 360) % 360
+	}
+}
+
+// aviAudioFormats names the WAVEFORMATEX format tags.
+var aviAudioFormats = map[uint16]string{
+	0x0001: "pcm",
+	0x0002: "adpcm",
+	0x0006: "alaw",
+	0x0007: "ulaw",
+	0x0011: "ima-adpcm",
+	0x0055: "mp3",
+	0x00ff: "aac",
+	0x2000: "ac3",
+	0x2001: "dts",
+}
+
+// videoInfo reads the main header and the stream headers and formats.
+// avih: MicroSecPerFrame, MaxBytesPerSec, PaddingGranularity, Flags,
+// TotalFrames, InitialFrames, Streams, SuggestedBufferSize, Width, Height
+// strh: fccType, fccHandler, Flags, Priority, Language, InitialFrames,
+// Scale, Rate, Start, Length ...
+func (m *aviMetadata) videoInfo() *VideoInfo {
+	le := binary.LittleEndian
+	v := &VideoInfo{}
+	var frames uint32
+	if len(m.avih) >= 40 {
+		frames = le.Uint32(m.avih[16:20])
+		if perFrame := le.Uint32(m.avih[0:4]); perFrame > 0 {
+			v.FrameRate = 1e6 / float64(perFrame)
+		}
+		v.Width, v.Height = int(le.Uint32(m.avih[32:36])), int(le.Uint32(m.avih[36:40]))
+	}
+	if m.dmlhFrames > frames {
+		// TotalFrames only counts the frames of the first RIFF chunk
+		frames = m.dmlhFrames
+	}
+
+	for _, s := range m.streams {
+		if len(s.strh) < 28 {
+			continue
+		}
+		switch string(s.strh[0:4]) {
+		case "vids":
+			if v.VideoCodec != "" {
+				continue
+			}
+			v.VideoCodec = fourCC(s.strh[4:8])
+			if len(s.strf) >= 20 {
+				// BITMAPINFOHEADER: Size, Width, Height, Planes, BitCount,
+				// Compression
+				if codec := fourCC(s.strf[16:20]); codec != "" {
+					v.VideoCodec = codec
+				}
+				if v.Width == 0 || v.Height == 0 {
+					v.Width = int(int32(le.Uint32(s.strf[4:8])))
+					// top-down bitmaps have a negative height
+					v.Height = int(math.Abs(float64(int32(le.Uint32(s.strf[8:12])))))
+				}
+			}
+			if scale, rate := le.Uint32(s.strh[20:24]), le.Uint32(s.strh[24:28]); scale > 0 && rate > 0 {
+				v.FrameRate = float64(rate) / float64(scale)
+			}
+		case "auds":
+			if v.AudioCodec != "" || len(s.strf) < 2 {
+				continue
+			}
+			tag := le.Uint16(s.strf[0:2])
+			if name, ok := aviAudioFormats[tag]; ok {
+				v.AudioCodec = name
+			} else {
+				v.AudioCodec = fmt.Sprintf("0x%04x", tag)
+			}
+		}
+	}
+	if frames > 0 && v.FrameRate > 0 {
+		v.Duration = time.Duration(float64(frames) / v.FrameRate * float64(time.Second))
+	}
+	return v
+}
+
+// fourCC returns the printable code b, without the padding spaces and
+// NULs.
+func fourCC(b []byte) string {
+	s := strings.TrimRight(string(b), " \x00")
+	for _, c := range s {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// movTrak returns a trak box with a version 0 tkhd holding matrix and size,
+// an mdhd of duration units of timescale and the first sample description
+// of format.
+func movTrak(handler, format string, matrix [9]int32, width, height uint16, timescale, duration, samples uint32) []byte {
+	var m []byte
+	for _, x := range matrix {
+		m = append(m, be32(uint32(x))...)
+	}
+	tkhd := fullBox("tkhd", 0, 3, be32(0), be32(0), be32(1), be32(0), be32(duration),
+		make([]byte, 16), m, be32(uint32(width)<<16), be32(uint32(height)<<16))
+	mdhd := fullBox("mdhd", 0, 0, be32(0), be32(0), be32(timescale), be32(duration), be32(0))
+	hdlr := fullBox("hdlr", 0, 0, be32(0), []byte(handler), make([]byte, 13))
+	entry := box(format, make([]byte, 6), []byte{0, 1}, make([]byte, 16), be16(width), be16(height), make([]byte, 50))
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, be32(1), entry),
+		fullBox("stts", 0, 0, be32(1), be32(samples), be32(duration/samples)),
+		fullBox("stsz", 0, 0, be32(0), be32(samples), bytes.Repeat(be32(1000), int(samples))))
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", stbl)))
+}
+
+func TestMOVVideoInfo(t *testing.T) {
+	identity := [9]int32{1 << 16, 0, 0, 0, 1 << 16, 0, 0, 0, 1 << 30}
+	rotate90 := [9]int32{0, 1 << 16, 0, -1 << 16, 0, 0, 1080 << 16, 0, 1 << 30}
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mvhd := fullBox("mvhd", 0, 0, be32(uint32(qtTime(created))), be32(uint32(qtTime(created))),
+		be32(1000), be32(2000), make([]byte, 80))
+	data := bytes.Join([][]byte{
+		box("ftyp", []byte("isom"), be32(0)),
+		box("moov", mvhd,
+			movTrak("soun", "mp4a", identity, 0, 0, 48000, 96000, 94),
+			movTrak("vide", "avc1", rotate90, 1920, 1080, 30000, 60060, 60)),
+		box("mdat", make([]byte, 1000)),
+	}, nil)
+
+	v, err := ReaderVideoInfo(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Duration != 2*time.Second || v.Width != 1920 || v.Height != 1080 || v.Rotation != 90 ||
+		v.VideoCodec != "avc1" || v.AudioCodec != "mp4a" {
+		t.Errorf("unexpected video info %+v", v)
+	}
+	if v.FrameRate < 29.97 || v.FrameRate > 29.98 {
+		t.Errorf("got frame rate %v, want 29.97", v.FrameRate)
+	}
+	if v.Matrix[1] != 1 || v.Matrix[3] != -1 || v.Matrix[6] != 1080 || v.Matrix[8] != 1 {
+		t.Errorf("unexpected matrix %v", v.Matrix)
+	}
+	if want := int64(len(data)) * 8 / 2; v.BitRate != want {
+		t.Errorf("got bit rate %d, want %d", v.BitRate, want)
+	}
+
+	// the dates are still read from files with a broken sample table
+	broken := bytes.Replace(data, []byte("stsd"), []byte("stsX"), 1)
+	copy(broken[bytes.Index(broken, []byte("stsX"))-4:], be32(0xffff))
+	if _, err := ReaderOriginalTime(bytes.NewReader(broken), int64(len(broken))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAVIVideoInfo(t *testing.T) {
+	le := binary.LittleEndian
+	u32 := func(vs ...uint32) []byte {
+		var b []byte
+		for _, v := range vs {
+			b = le.AppendUint32(b, v)
+		}
+		return b
+	}
+	// 25 fps, 100 frames in the first RIFF chunk, 250 in the whole file
+	avih := chunk("avih", u32(40000, 0, 0, 0x10, 100, 0, 2, 0, 640, 480, 0, 0, 0, 0))
+	vids := chunk("LIST", []byte("strl"),
+		chunk("strh", []byte("vidsmjpg"), u32(0, 0, 0, 1, 25, 0, 250, 0, 0, 0), make([]byte, 16)),
+		chunk("strf", u32(40, 640, 480), []byte{1, 0, 24, 0}, []byte("MJPG"), make([]byte, 20)))
+	auds := chunk("LIST", []byte("strl"),
+		chunk("strh", []byte("auds\x00\x00\x00\x00"), u32(0, 0, 0, 1, 8000, 0, 20000, 0, 0, 0), make([]byte, 16)),
+		chunk("strf", []byte{1, 0, 1, 0}, u32(8000, 16000), []byte{2, 0, 16, 0}))
+	odml := chunk("LIST", []byte("odml"), chunk("dmlh", u32(250), make([]byte, 244)))
+	data := chunk("RIFF", []byte("AVI "),
+		chunk("LIST", []byte("hdrl"), avih, vids, auds, odml),
+		chunk("LIST", []byte("movi"), chunk("00dc", []byte("frame"))))
+	data = append(data, chunk("RIFF", []byte("AVIX"), chunk("LIST", []byte("movi")))...)
+
+	v, err := ReaderVideoInfo(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := VideoInfo{
+		Duration:   10 * time.Second,
+		Width:      640,
+		Height:     480,
+		VideoCodec: "MJPG",
+		AudioCodec: "pcm",
+		FrameRate:  25,
+		BitRate:    int64(len(data)) * 8 / 10,
+	}
+	if *v != want {
+		t.Errorf("got %+v, want %+v", *v, want)
+	}
+}
@@ -0,0 +1,62 @@
+package minlib
+
+import (
+	"bytes"
+	"io"
+)
+
+// WebP: https://developers.google.com/speed/webp/docs/riff_container
+// A RIFF WEBP chunk holds the image chunks and, in the extended format, a
+// VP8X chunk and the optional EXIF and "XMP " chunks. The EXIF chunk holds
+// a TIFF stream; some writers keep the "Exif\0\0" prefix of JPEG.
+
+// webpMetadata holds the metadata chunks of a WebP file. Empty fields were
+// not found.
+type webpMetadata struct {
+	exif []byte // TIFF stream of the EXIF chunk
+	xmp  []byte
+}
+
+// parseWebP reads the EXIF and XMP chunks of a WebP file.
+func parseWebP(r io.ReadSeeker) (*webpMetadata, error) {
+	size, err := streamSize(r)
+	if err != nil {
+		return nil, err
+	}
+	riff, err := readRIFFChunkHeader(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if riff.id != "RIFF" || riff.list != "WEBP" {
+		return nil, formatError("riff", 0, "not a WebP file")
+	}
+
+	m := &webpMetadata{}
+	err = walkRIFFChunks(r, riff.childOffset(), riff.end(), func(c *riffChunk) error {
+		switch {
+		case c.id == "EXIF" && m.exif == nil:
+			if c.size > maxExifChunkSize {
+				return limitError("riff", c.offset, "EXIF chunk size")
+			}
+			b, err := readAt(r, c.dataOffset(), int(c.size))
+			if err != nil {
+				return err
+			}
+			m.exif = bytes.TrimPrefix(b, []byte(exifMarker))
+		case c.id == "XMP " && m.xmp == nil:
+			if c.size > maxXMPSize {
+				return limitError("riff", c.offset, "XMP chunk size")
+			}
+			b, err := readAt(r, c.dataOffset(), int(c.size))
+			if err != nil {
+				return err
+			}
+			m.xmp = b
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,40 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestWebPMetadata(t *testing.T) {
+	data := chunk("RIFF", []byte("WEBP"),
+		chunk("VP8X", make([]byte, 10)),
+		chunk("VP8 ", []byte("frame")),
+		chunk("EXIF", append([]byte(exifMarker), testExifTIFF(binary.BigEndian, "2021:03:04 10:11:12")...)),
+		chunk("XMP ", []byte(testXMPElements)))
+	r, size := bytes.NewReader(data), int64(len(data))
+
+	got, err := ReaderOriginalTime(r, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2021, 3, 4, 10, 11, 12, 0, time.Local); !got.Equal(want) {
+		t.Errorf("original time: got %v, want %v", got, want)
+	}
+	x, err := ReaderXMP(r, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Keywords) != 2 {
+		t.Errorf("XMP keywords: got %v", x.Keywords)
+	}
+
+	data = chunk("RIFF", []byte("WEBP"), chunk("VP8L", []byte("frame")))
+	if _, err := ReaderExif(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("WebP without EXIF: got no error")
+	}
+}
@@ -0,0 +1,284 @@
+package minlib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XMP Specification Part 1: https://www.adobe.com/devnet/xmp.html
+// Properties are written either as attributes of rdf:Description or as
+// child elements; arrays use rdf:Bag/rdf:Seq/rdf:Alt with rdf:li items.
+
+const (
+	nsXMP       = "http://ns.adobe.com/xap/1.0/"
+	nsExif      = "http://ns.adobe.com/exif/1.0/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+const maxXMPSize = 16 << 20
+
+// maxXMPDepth limits the nesting of XML elements in an XMP packet.
+const maxXMPDepth = 256
+
+// XMP is the decoded subset of an XMP packet.
+type XMP struct {
+	CreateDate       time.Time // xmp:CreateDate
+	ModifyDate       time.Time // xmp:ModifyDate
+	DateTimeOriginal time.Time // exif:DateTimeOriginal
+	DateCreated      time.Time // photoshop:DateCreated
+	Rating           int       // xmp:Rating, -1 for rejected
+	Keywords         []string  // dc:subject
+}
+
+// OriginalTime returns exif:DateTimeOriginal, falling back to
+// photoshop:DateCreated and xmp:CreateDate.
+func (x *XMP) OriginalTime() (time.Time, error) {
+	candidates := x.timeCandidates()
+	if len(candidates) == 0 {
+		return zeroTime, &ErrNoOriginalTime{"no date in XMP"}
+	}
+	return candidates[0].Time, nil
+}
+
+func (x *XMP) timeCandidates() []TimeCandidate {
+	var candidates []TimeCandidate
+	for _, c := range []TimeCandidate{
+		{x.DateTimeOriginal, SourceXMP, "exif:DateTimeOriginal"},
+		{x.DateCreated, SourceXMP, "photoshop:DateCreated"},
+		{x.CreateDate, SourceXMP, "xmp:CreateDate"},
+	} {
+		if !c.Time.IsZero() {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+func (x *XMP) set(name xml.Name, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	parseDate := func(t *time.Time) {
+		if v, err := parseISOTime(value); err == nil {
+			*t = v
+		}
+	}
+	switch name.Space + name.Local {
+	case nsXMP + "CreateDate":
+		parseDate(&x.CreateDate)
+	case nsXMP + "ModifyDate":
+		parseDate(&x.ModifyDate)
+	case nsExif + "DateTimeOriginal":
+		parseDate(&x.DateTimeOriginal)
+	case nsPhotoshop + "DateCreated":
+		parseDate(&x.DateCreated)
+	case nsXMP + "Rating":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			x.Rating = int(v)
+		}
+	}
+}
+
+// ParseXMP decodes an XMP packet.
+func ParseXMP(data []byte) (*XMP, error) {
+	x := &XMP{}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+
+	var stack []xml.Name
+	inSubject := func() bool {
+		for _, n := range stack {
+			if n.Space == nsDC && n.Local == "subject" {
+				return true
+			}
+		}
+		return false
+	}
+	found := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if found {
+				break
+			}
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Space == nsRDF && tok.Name.Local == "RDF" {
+				found = true
+			}
+			if len(stack) >= maxXMPDepth {
+				return nil, limitError("xmp", d.InputOffset(), "element nesting")
+			}
+			for _, attr := range tok.Attr {
+				x.set(attr.Name, attr.Value)
+			}
+			stack = append(stack, tok.Name)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			if top.Space == nsRDF && top.Local == "li" {
+				if inSubject() {
+					if kw := strings.TrimSpace(string(tok)); kw != "" {
+						x.Keywords = append(x.Keywords, kw)
+					}
+				} else if len(stack) >= 3 {
+					// single-valued properties wrapped in an array
+					x.set(stack[len(stack)-3], string(tok))
+				}
+			} else {
+				x.set(top, string(tok))
+			}
+		}
+	}
+	if !found {
+		return nil, formatError("xmp", -1, "no rdf:RDF element")
+	}
+	return x, nil
+}
+
+// FindXMPSidecar returns the path of the .xmp sidecar of p, named either
+// after the base name of p ("IMG_0001.xmp") or after its full name
+// ("IMG_0001.CR2.xmp").
+func FindXMPSidecar(p string) (string, bool) {
+	return findXMPSidecar(osFS{}, p)
+}
+
+func findXMPSidecar(fsys fileSystem, p string) (string, bool) {
+	base := strings.TrimSuffix(p, filepath.Ext(p))
+	for _, candidate := range []string{base + ".xmp", base + ".XMP", p + ".xmp", p + ".XMP"} {
+		if candidate != p && isRegularFile(fsys, candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// FileXMP returns the XMP metadata embedded in p (JPEG APP1, TIFF tag
+// 0x02bc, or p itself for .xmp files), falling back to its sidecar.
+func FileXMP(p string) (*XMP, error) {
+	return fileXMP(osFS{}, p)
+}
+
+// FSXMP returns the XMP metadata of the file name of fsys, see FileXMP.
+func FSXMP(fsys fs.FS, name string) (*XMP, error) {
+	return fileXMP(ioFS{fsys}, name)
+}
+
+// ReaderXMP returns the XMP metadata embedded in the size bytes of r.
+func ReaderXMP(r io.ReaderAt, size int64) (*XMP, error) {
+	m, err := newMediaReader(r, size, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.xmp()
+}
+
+func fileXMP(fsys fileSystem, name string) (*XMP, error) {
+	m, err := openMedia(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	x, err := m.xmp()
+	if err == nil {
+		return x, nil
+	}
+	if sidecar, ok := findXMPSidecar(fsys, name); ok {
+		return sidecarXMP(fsys, sidecar)
+	}
+	return nil, err
+}
+
+// sidecarXMP decodes the .xmp file name.
+func sidecarXMP(fsys fileSystem, name string) (*XMP, error) {
+	f, err := fsys.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxXMPSize))
+	if err != nil {
+		return nil, err
+	}
+	return ParseXMP(data)
+}
+
+// xmp returns the XMP metadata embedded in m.
+func (m *mediaReader) xmp() (*XMP, error) {
+	data, err := m.xmpPacket()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("xmp: no XMP metadata")
+	}
+	return ParseXMP(data)
+}
+
+// xmpPacket returns the XMP packet embedded in m, or nil.
+func (m *mediaReader) xmpPacket() ([]byte, error) {
+	switch m.typ {
+	case MediaXMP:
+		return io.ReadAll(io.LimitReader(m.reader(), maxXMPSize))
+	case MediaJPEG:
+		return jpegXMP(m.reader())
+	case MediaPNG:
+		png, err := m.parsedPNG()
+		if err != nil {
+			return nil, err
+		}
+		return png.xmp, nil
+	case MediaWebP:
+		webp, err := parseWebP(m.reader())
+		if err != nil {
+			return nil, err
+		}
+		return webp.xmp, nil
+	case MediaTIFF:
+		x, err := m.exif()
+		if err != nil {
+			return nil, err
+		}
+		if t := x.Tag(IFD0, 0x02bc); t != nil {
+			return t.Value, nil
+		}
+	}
+	return nil, nil
+}
+
+// jpegXMP returns the XMP packet of the JPEG stream r, or nil.
+func jpegXMP(r io.Reader) ([]byte, error) {
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil {
+		return nil, err
+	}
+	if string(soi) != "\xFF\xD8" {
+		return nil, errors.New("header error")
+	}
+	app1, err := readJPEGAPP1(r)
+	if err != nil {
+		return nil, err
+	}
+	return app1.xmp, nil
+}
@@ -0,0 +1,104 @@
+//go:build !exif
+// +build !exif
+
+package minlib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testXMPAttributes = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmp:CreateDate="2018-05-06T07:08:09.50+02:00"
+    xmp:Rating="4"
+    photoshop:DateCreated="2018-05-06T07:08:09+02:00"/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+const testXMPElements = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <exif:DateTimeOriginal>2017-01-02T03:04:05</exif:DateTimeOriginal>
+   <xmp:Rating>-1</xmp:Rating>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>beach</rdf:li>
+     <rdf:li>family</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestParseXMP(t *testing.T) {
+	x, err := ParseXMP([]byte(testXMPAttributes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2018, 5, 6, 7, 8, 9, 5e8, time.FixedZone("", 2*3600))
+	if !x.CreateDate.Equal(want) || x.Rating != 4 {
+		t.Errorf("unexpected XMP %+v", x)
+	}
+	if got, _ := x.OriginalTime(); !got.Equal(want.Truncate(time.Second)) {
+		t.Errorf("OriginalTime() = %v, want photoshop:DateCreated", got)
+	}
+
+	x, err = ParseXMP([]byte(testXMPElements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2017, 1, 2, 3, 4, 5, 0, time.Local); !x.DateTimeOriginal.Equal(want) {
+		t.Errorf("DateTimeOriginal = %v, want %v", x.DateTimeOriginal, want)
+	}
+	if x.Rating != -1 || !reflect.DeepEqual(x.Keywords, []string{"beach", "family"}) {
+		t.Errorf("unexpected rating %d or keywords %q", x.Rating, x.Keywords)
+	}
+
+	if _, err := ParseXMP([]byte("<html></html>")); err == nil {
+		t.Error("expected an error without rdf:RDF")
+	}
+}
+
+func TestXMPOriginalTime(t *testing.T) {
+	dir := t.TempDir()
+	want := time.Date(2017, 1, 2, 3, 4, 5, 0, time.Local)
+
+	// JPEG with a non-Exif APP1 segment first and XMP only
+	jpg := filepath.Join(dir, "edited.jpg")
+	data := buildJPEG(
+		jpegSegment(0xE1, []byte("unknown\x00data")),
+		jpegSegment(0xE1, append([]byte(xmpMarker), testXMPElements...)))
+	if err := os.WriteFile(jpg, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := FileOriginalTime(jpg); err != nil || !got.Equal(want) {
+		t.Errorf("JPEG: got %v, %v; want %v", got, err, want)
+	}
+
+	// file without metadata and a sidecar
+	clip := filepath.Join(dir, "clip.mkv")
+	if err := os.WriteFile(clip, []byte("no metadata"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "clip.mkv.xmp"), []byte(testXMPElements), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := FileOriginalTime(clip); err != nil || !got.Equal(want) {
+		t.Errorf("sidecar: got %v, %v; want %v", got, err, want)
+	}
+	if p, ok := FindXMPSidecar(clip); !ok || filepath.Base(p) != "clip.mkv.xmp" {
+		t.Errorf("FindXMPSidecar() = %q, %v", p, ok)
+	}
+}
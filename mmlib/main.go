@@ -122,7 +122,7 @@ func walkDirectory(dir string, tasks chan string, db *bolt.DB) (int, map[string]
 		ext := strings.ToLower(filepath.Ext(info.Name()))
 		// fmt.Printf("ext: %s\n", ext)
 		switch ext {
-		case ".jpg", ".jpeg", ".png", ".arw", ".nef", ".avi", ".mp4", ".mov", ".m4v", ".m4a", ".gif":
+		case ".jpg", ".jpeg", ".png", ".arw", ".nef", ".avi", ".mp4", ".mov", ".m4v", ".m4a", ".gif", ".webp":
 			// need to archive
 			// log.Println("put ", path)
 
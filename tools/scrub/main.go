@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mindeng/go/minlib"
+)
+
+var keep = flag.String("keep", groupList(minlib.DefaultScrubPolicy.Keep), "comma separated metadata groups kept, among "+groupList(minlib.MetadataGroups))
+var outDir = flag.String("o", "", "directory the scrubbed files are written to, instead of replacing them")
+var dryRun = flag.Bool("n", false, "only print the metadata that would be removed")
+var verify = flag.Bool("verify", false, "only check that the files hold no metadata but the kept groups")
+
+func groupList(groups []minlib.MetadataGroup) string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = string(g)
+	}
+	return strings.Join(names, ",")
+}
+
+func parsePolicy(s string) (minlib.ScrubPolicy, error) {
+	var policy minlib.ScrubPolicy
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		g := minlib.MetadataGroup(name)
+		known := false
+		for _, k := range minlib.MetadataGroups {
+			known = known || k == g
+		}
+		if !known {
+			return policy, fmt.Errorf("unknown metadata group %q", name)
+		}
+		policy.Keep = append(policy.Keep, g)
+	}
+	return policy, nil
+}
+
+func scrub(path string, policy minlib.ScrubPolicy) ([]minlib.ScrubbedItem, error) {
+	if *verify {
+		return nil, minlib.FileVerifyScrubbed(path, policy)
+	}
+	if *dryRun {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return minlib.Scrub(io.Discard, f, fi.Size(), policy)
+	}
+	dst := path
+	if *outDir != "" {
+		dst = filepath.Join(*outDir, filepath.Base(path))
+	}
+	return minlib.ScrubFile(path, dst, policy)
+}
+
+func main() {
+	flag.Parse()
+	policy, err := parsePolicy(*keep)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	status := 0
+	for _, path := range flag.Args() {
+		removed, err := scrub(path, policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", err, path)
+			status = 1
+			continue
+		}
+		for _, item := range removed {
+			fmt.Printf("%s: removed %v\n", path, item)
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mindeng/go/minlib"
+)
+
+var shift = flag.Duration("shift", 0, "time added to the dates, such as 1h30m or -26h")
+var dryRun = flag.Bool("n", false, "only print the planned changes")
+
+func main() {
+	flag.Parse()
+	status := 0
+	for _, path := range flag.Args() {
+		// changes written before an error are returned with it
+		changes, err := minlib.ShiftFileDates(path, *shift, *dryRun)
+		for _, c := range changes {
+			fmt.Printf("%s: %v\n", path, c)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", err, path)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}